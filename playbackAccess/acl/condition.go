@@ -0,0 +1,213 @@
+// Package acl evaluates the access control conditions stored with protected videos.
+//
+// Conditions use the Lit Protocol unified access control condition format produced by
+// the webapp's access control builder: a list whose entries are conditions, "and"/"or"
+// operators, or nested lists (groups). Decoding is strict: every condition must map to
+// one of the builder's rules on a chain the service is configured with, so that a bad
+// configuration is reported when a video is loaded rather than silently denying playback.
+package acl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Version is the newest version of the condition format this package understands.
+// Version 1 is the Lit Protocol unified access control condition format.
+const Version = 1
+
+// Logical operators joining conditions.
+const (
+	OperatorAnd = "and"
+	OperatorOr  = "or"
+)
+
+// Condition types.
+const (
+	ConditionEVMBasic    = "evmBasic"
+	ConditionEVMContract = "evmContract"
+)
+
+// Parameter placeholders substituted at evaluation time.
+const (
+	ParamUserAddress     = ":userAddress"
+	ParamCurrentActionID = ":currentActionIpfsId"
+)
+
+// ErrMalformed is returned for condition trees that cannot be decoded or evaluated.
+var ErrMalformed = errors.New("malformed access control conditions")
+
+// ConditionError describes why a condition tree was rejected.
+// It unwraps to ErrMalformed.
+type ConditionError struct {
+	// Path locates the offending entry as dot-separated indexes, e.g. "2.0";
+	// it is empty for problems with the tree as a whole.
+	Path    string
+	Message string
+}
+
+// Error implements the error interface.
+func (e *ConditionError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("%s: %s", ErrMalformed, e.Message)
+	}
+	return fmt.Sprintf("%s: condition %s: %s", ErrMalformed, e.Path, e.Message)
+}
+
+// Unwrap returns ErrMalformed.
+func (e *ConditionError) Unwrap() error {
+	return ErrMalformed
+}
+
+func conditionErrorf(path, format string, args ...interface{}) *ConditionError {
+	return &ConditionError{Path: path, Message: fmt.Sprintf(format, args...)}
+}
+
+// Conditions is a decoded condition tree.
+type Conditions []Node
+
+// Node is one entry of a condition list. Exactly one of Group, Operator or
+// Rule is set.
+type Node struct {
+	Group    Conditions
+	Operator string
+	Rule     Rule
+}
+
+// Decode decodes and validates a condition tree whose conditions refer to chains.
+// Conditions on any other chain are rejected.
+func Decode(data []byte, chains Chains) (Conditions, error) {
+	return decodeList(data, "", chains)
+}
+
+// Rules returns the conditions of the tree, depth first.
+func (c Conditions) Rules() []Rule {
+	var rules []Rule
+	for _, node := range c {
+		switch {
+		case node.Group != nil:
+			rules = append(rules, node.Group.Rules()...)
+		case node.Rule != nil:
+			rules = append(rules, node.Rule)
+		}
+	}
+	return rules
+}
+
+// MarshalJSON encodes the tree in the Lit Protocol format it was decoded from.
+func (n Node) MarshalJSON() ([]byte, error) {
+	switch {
+	case n.Group != nil:
+		return json.Marshal(n.Group)
+	case n.Rule != nil:
+		return json.Marshal(n.Rule.condition())
+	default:
+		return json.Marshal(map[string]string{"operator": n.Operator})
+	}
+}
+
+// decodeList decodes the group at path. Operators must separate consecutive
+// entries, and groups may not be empty.
+func decodeList(data []byte, path string, chains Chains) (Conditions, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, conditionErrorf(path, "expected a list of conditions")
+	}
+	if len(raw) == 0 {
+		return nil, conditionErrorf(path, "empty group")
+	}
+
+	nodes := make(Conditions, 0, len(raw))
+	for i, entry := range raw {
+		entryPath := strconv.Itoa(i)
+		if path != "" {
+			entryPath = path + "." + entryPath
+		}
+
+		node, err := decodeNode(entry, entryPath, chains)
+		if err != nil {
+			return nil, err
+		}
+
+		// Entries must alternate between operands and operators
+		isOperator := node.Operator != ""
+		if isOperator != (i%2 == 1) {
+			if isOperator {
+				return nil, conditionErrorf(entryPath, "operator %q must follow a condition", node.Operator)
+			}
+			return nil, conditionErrorf(entryPath, "conditions must be joined by an operator")
+		}
+		nodes = append(nodes, node)
+	}
+
+	if last := nodes[len(nodes)-1]; last.Operator != "" {
+		return nil, conditionErrorf(path, "trailing operator %q", last.Operator)
+	}
+	return nodes, nil
+}
+
+// decodeNode decodes an array as a group, an object with an "operator" key as an
+// operator, and any other object as a condition.
+func decodeNode(data []byte, path string, chains Chains) (Node, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		group, err := decodeList(data, path, chains)
+		return Node{Group: group}, err
+	}
+
+	var operator struct {
+		Operator *string `json:"operator"`
+	}
+	if err := json.Unmarshal(data, &operator); err != nil {
+		return Node{}, conditionErrorf(path, "expected a condition, operator or group")
+	}
+	if operator.Operator != nil {
+		switch *operator.Operator {
+		case OperatorAnd, OperatorOr:
+			return Node{Operator: *operator.Operator}, nil
+		default:
+			return Node{}, conditionErrorf(path, "invalid operator %q", *operator.Operator)
+		}
+	}
+
+	var c condition
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return Node{}, conditionErrorf(path, "invalid condition: %v", err)
+	}
+
+	rule, err := newRule(&c, chains)
+	if err != nil {
+		return Node{}, conditionErrorf(path, "%v", err)
+	}
+	return Node{Rule: rule}, nil
+}
+
+// condition is a single condition in Lit Protocol format.
+//
+// evmBasic conditions call a standard method (balanceOf) on a token contract
+// described by StandardContractType, with Method and Parameters. evmContract
+// conditions call FunctionName with FunctionParams on an arbitrary contract.
+type condition struct {
+	ConditionType        string          `json:"conditionType"`
+	ContractAddress      string          `json:"contractAddress"`
+	StandardContractType string          `json:"standardContractType,omitempty"`
+	Method               string          `json:"method,omitempty"`
+	Parameters           []string        `json:"parameters,omitempty"`
+	FunctionName         string          `json:"functionName,omitempty"`
+	FunctionParams       []string        `json:"functionParams,omitempty"`
+	FunctionABI          json.RawMessage `json:"functionAbi,omitempty"`
+	Chain                string          `json:"chain"`
+	ReturnValueTest      returnValueTest `json:"returnValueTest"`
+}
+
+// returnValueTest compares the value returned by a condition's call with Value.
+type returnValueTest struct {
+	Key        string `json:"key,omitempty"`
+	Comparator string `json:"comparator"`
+	Value      string `json:"value"`
+}
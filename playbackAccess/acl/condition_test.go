@@ -0,0 +1,40 @@
+package acl
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestDecodeChains(t *testing.T) {
+	videoNFT := common.HexToAddress("0x00000000000000000000000000000000000000c1")
+	chains := Chains{"optimism": {ID: 10, VideoNFT: videoNFT}}
+
+	balanceOf := func(chain, contract string) []byte {
+		return []byte(`[{"conditionType":"evmBasic","contractAddress":"` + contract + `","standardContractType":"ERC1155","chain":"` + chain + `","method":"balanceOf","parameters":[":userAddress","7"],"returnValueTest":{"comparator":">","value":"0"}}]`)
+	}
+
+	// Chains come from the table, not a built-in list
+	conditions, err := Decode(balanceOf("optimism", videoNFT.Hex()), chains)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if rules := conditions.Rules(); len(rules) != 1 || rules[0].Kind() != KindOwner {
+		t.Fatalf("rules = %+v, want an owner rule", rules)
+	}
+
+	conditions, err = Decode(balanceOf("optimism", "0x00000000000000000000000000000000000000c2"), chains)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if rules := conditions.Rules(); len(rules) != 1 || rules[0].Kind() != KindToken {
+		t.Fatalf("rules = %+v, want a token rule", rules)
+	}
+
+	_, err = Decode(balanceOf("base", videoNFT.Hex()), chains)
+	var conditionErr *ConditionError
+	if !errors.As(err, &conditionErr) || !errors.Is(err, ErrMalformed) || conditionErr.Path != "0" {
+		t.Fatalf("Decode of an unconfigured chain = %v, want a ConditionError at 0", err)
+	}
+}
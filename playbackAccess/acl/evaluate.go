@@ -0,0 +1,224 @@
+package acl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/loop/playbackAccess/contracts"
+)
+
+// ErrUnsupportedChain is returned by a ChainReader for chains it cannot read.
+var ErrUnsupportedChain = errors.New("unsupported chain")
+
+// ChainReader reads the chain state that conditions depend on.
+// Chains are identified by the names used in conditions, e.g. "base".
+type ChainReader interface {
+	// BalanceOf returns the balance of owner in the token contract implementing standard
+	// (ERC20, ERC721 or ERC1155). id is only used for ERC1155 tokens.
+	BalanceOf(ctx context.Context, chain, standard string, contract, owner common.Address, id *big.Int) (*big.Int, error)
+	// HasPurchasedVideo reports whether purchaser bought the video with tokenId
+	// from the PurchaseManager at contract.
+	HasPurchasedVideo(ctx context.Context, chain string, contract common.Address, tokenId *big.Int, purchaser common.Address) (bool, error)
+}
+
+// RuleResult is the outcome of a single condition.
+type RuleResult struct {
+	// Path locates the condition in the tree as dot-separated indexes, e.g. "2.0".
+	Path     string `json:"path"`
+	Kind     string `json:"kind"`
+	Chain    string `json:"chain,omitempty"`
+	Contract string `json:"contract,omitempty"`
+	TokenId  string `json:"tokenId,omitempty"`
+	Passed   bool   `json:"passed"`
+	// Skipped is set when the condition could not change the decision and was not read.
+	Skipped bool `json:"skipped,omitempty"`
+	// Value is the value returned by the chain, when it was read.
+	Value  string `json:"value,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Decision is the result of evaluating a condition tree for one viewer.
+type Decision struct {
+	Allowed bool         `json:"allowed"`
+	Rules   []RuleResult `json:"rules"`
+}
+
+// Evaluator evaluates condition trees against chain state.
+type Evaluator struct {
+	reader ChainReader
+}
+
+// NewEvaluator returns an Evaluator that reads chain state through reader.
+func NewEvaluator(reader ChainReader) *Evaluator {
+	return &Evaluator{reader: reader}
+}
+
+// Evaluate decides whether user satisfies the conditions.
+//
+// Entries of a list are combined left to right by the operators between them, and
+// nested lists are evaluated as a single operand. Conditions that cannot change the
+// outcome are skipped without reading the chain.
+//
+// litAction conditions only restrict decryption to the playback Lit Action, which
+// performs the checks this evaluator performs itself; they are always satisfied here.
+//
+// An error is returned when the tree is malformed or chain state could not be read;
+// rules on chains the reader cannot read fail and deny access.
+func (e *Evaluator) Evaluate(ctx context.Context, nodes Conditions, user common.Address) (*Decision, error) {
+	ev := &evaluation{Evaluator: e, user: user}
+	allowed, err := ev.list(ctx, nodes, "", false)
+	if err != nil {
+		return nil, err
+	}
+	return &Decision{Allowed: allowed, Rules: ev.results}, nil
+}
+
+// evaluation holds the state of a single Evaluate call.
+type evaluation struct {
+	*Evaluator
+	user    common.Address
+	results []RuleResult
+}
+
+// list evaluates a group. When skip is set, its conditions are recorded as
+// skipped and the result is meaningless.
+func (ev *evaluation) list(ctx context.Context, nodes Conditions, path string, skip bool) (bool, error) {
+	var (
+		result  bool
+		have    bool
+		pending string
+	)
+
+	for i, node := range nodes {
+		nodePath := strconv.Itoa(i)
+		if path != "" {
+			nodePath = path + "." + nodePath
+		}
+
+		if node.Group == nil && node.Rule == nil {
+			if node.Operator != OperatorAnd && node.Operator != OperatorOr {
+				return false, conditionErrorf(nodePath, "invalid operator %q", node.Operator)
+			}
+			if !have || pending != "" {
+				return false, conditionErrorf(nodePath, "operator %q must follow a condition", node.Operator)
+			}
+			pending = node.Operator
+			continue
+		}
+		if have && pending == "" {
+			return false, conditionErrorf(nodePath, "conditions must be joined by an operator")
+		}
+
+		// The operand cannot change the result once an "and" is false or an "or" is true
+		skipNode := skip || (have && ((pending == OperatorAnd && !result) || (pending == OperatorOr && result)))
+
+		var value bool
+		var err error
+		if node.Group != nil {
+			value, err = ev.list(ctx, node.Group, nodePath, skipNode)
+		} else {
+			value, err = ev.rule(ctx, node.Rule, nodePath, skipNode)
+		}
+		if err != nil {
+			return false, err
+		}
+
+		switch {
+		case !have:
+			result, have = value, true
+		case skipNode:
+		case pending == OperatorAnd:
+			result = result && value
+		default:
+			result = result || value
+		}
+		pending = ""
+	}
+
+	if !have {
+		return false, conditionErrorf(path, "empty group")
+	}
+	if pending != "" {
+		return false, conditionErrorf(path, "trailing operator %q", pending)
+	}
+	return result, nil
+}
+
+// rule evaluates a single rule and records its result.
+func (ev *evaluation) rule(ctx context.Context, rule Rule, path string, skip bool) (bool, error) {
+	res := RuleResult{Path: path, Kind: rule.Kind(), Chain: rule.ChainName()}
+
+	var err error
+	switch r := rule.(type) {
+	case *LitActionRule:
+		if !skip {
+			res.Passed = true
+			res.Reason = "enforced by this service"
+		}
+	case *TokenRule:
+		res.Contract = r.Contract.Hex()
+		if r.Standard == contracts.ERC1155 {
+			res.TokenId = r.TokenId.String()
+		}
+		if !skip {
+			err = ev.balanceOf(ctx, r.Chain, r.Standard, r.Contract, r.TokenId, r.Threshold, &res)
+		}
+	case *OwnerRule:
+		res.Contract = r.Contract.Hex()
+		res.TokenId = r.TokenId.String()
+		if !skip {
+			err = ev.balanceOf(ctx, r.Chain, contracts.ERC1155, r.Contract, r.TokenId, r.Threshold, &res)
+		}
+	case *PaywallRule:
+		res.Contract = r.Contract.Hex()
+		res.TokenId = r.TokenId.String()
+		if !skip {
+			err = ev.hasPurchased(ctx, r, &res)
+		}
+	default:
+		return false, conditionErrorf(path, "unsupported rule %T", rule)
+	}
+	if err != nil {
+		return false, fmt.Errorf("condition %s: %w", path, err)
+	}
+
+	res.Skipped = skip
+	ev.results = append(ev.results, res)
+	return res.Passed, nil
+}
+
+// balanceOf evaluates a token balance rule.
+func (ev *evaluation) balanceOf(ctx context.Context, chain, standard string, contract common.Address, tokenId *big.Int, threshold Threshold, res *RuleResult) error {
+	balance, err := ev.reader.BalanceOf(ctx, chain, standard, contract, ev.user, tokenId)
+	if errors.Is(err, ErrUnsupportedChain) {
+		res.Reason = err.Error()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	res.Value = balance.String()
+	res.Passed = threshold.test(balance)
+	return nil
+}
+
+// hasPurchased evaluates a paywall rule.
+func (ev *evaluation) hasPurchased(ctx context.Context, r *PaywallRule, res *RuleResult) error {
+	purchased, err := ev.reader.HasPurchasedVideo(ctx, r.Chain, r.Contract, r.TokenId, ev.user)
+	if errors.Is(err, ErrUnsupportedChain) {
+		res.Reason = err.Error()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	res.Value = strconv.FormatBool(purchased)
+	res.Passed = purchased
+	return nil
+}
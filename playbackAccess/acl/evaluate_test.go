@@ -0,0 +1,142 @@
+package acl
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/loop/playbackAccess/internal/evmtest"
+)
+
+func TestEvaluate(t *testing.T) {
+	videoNFT := common.HexToAddress("0x00000000000000000000000000000000000000c1")
+	purchaseManager := common.HexToAddress("0x00000000000000000000000000000000000000b0")
+	owner := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	buyer := common.HexToAddress("0x00000000000000000000000000000000000000a2")
+	stranger := common.HexToAddress("0x00000000000000000000000000000000000000a3")
+	tokenId := big.NewInt(42)
+
+	backend := simulated.NewBackend(types.GenesisAlloc{
+		videoNFT: {
+			Code:    evmtest.ERC1155(),
+			Storage: map[common.Hash]common.Hash{evmtest.BalanceSlot(tokenId, owner): common.BigToHash(big.NewInt(1))},
+			Balance: big.NewInt(0),
+		},
+		purchaseManager: {
+			Code:    evmtest.PurchaseManager(),
+			Storage: map[common.Hash]common.Hash{evmtest.PurchaseSlot(tokenId, buyer): evmtest.Purchased},
+			Balance: big.NewInt(0),
+		},
+	})
+	t.Cleanup(func() { backend.Close() })
+	evaluator := NewEvaluator(NewRPCReader(map[string]ethereum.ContractCaller{"base": backend.Client()}))
+
+	ownerRule := Node{Rule: &OwnerRule{Chain: "base", Contract: videoNFT, TokenId: tokenId, Threshold: Threshold{Comparator: ">", Value: big.NewInt(0)}}}
+	paywallRule := Node{Rule: &PaywallRule{Chain: "base", Contract: purchaseManager, TokenId: tokenId}}
+	litActionRule := Node{Rule: &LitActionRule{Chain: "base", IPFSID: "QmPlaybackAction"}}
+	otherChainRule := Node{Rule: &OwnerRule{Chain: "optimism", Contract: videoNFT, TokenId: tokenId, Threshold: Threshold{Comparator: ">", Value: big.NewInt(0)}}}
+	and, or := Node{Operator: OperatorAnd}, Node{Operator: OperatorOr}
+
+	tests := []struct {
+		name       string
+		conditions Conditions
+		user       common.Address
+		allowed    bool
+		// skipped lists the paths of the rules that were not read
+		skipped []string
+	}{
+		{"owner", Conditions{ownerRule}, owner, true, nil},
+		{"owner, stranger", Conditions{ownerRule}, stranger, false, nil},
+		{"paywall", Conditions{paywallRule}, buyer, true, nil},
+		{"paywall, stranger", Conditions{paywallRule}, stranger, false, nil},
+		{"owner or paywall, owner", Conditions{ownerRule, or, paywallRule}, owner, true, []string{"2"}},
+		{"owner or paywall, buyer", Conditions{ownerRule, or, paywallRule}, buyer, true, nil},
+		{"owner or paywall, stranger", Conditions{ownerRule, or, paywallRule}, stranger, false, nil},
+		{"owner and paywall, owner", Conditions{ownerRule, and, paywallRule}, owner, false, nil},
+		{"owner and paywall, buyer", Conditions{ownerRule, and, paywallRule}, buyer, false, []string{"2"}},
+		{"group, buyer", Conditions{litActionRule, and, {Group: Conditions{ownerRule, or, paywallRule}}}, buyer, true, nil},
+		{"group, stranger", Conditions{litActionRule, and, {Group: Conditions{ownerRule, or, paywallRule}}}, stranger, false, nil},
+		{"skipped group", Conditions{ownerRule, or, {Group: Conditions{litActionRule, and, paywallRule}}}, owner, true, []string{"2.0", "2.2"}},
+		{"left to right", Conditions{ownerRule, or, paywallRule, and, ownerRule}, buyer, false, nil},
+		{"unsupported chain or paywall", Conditions{otherChainRule, or, paywallRule}, buyer, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := evaluator.Evaluate(context.Background(), tt.conditions, tt.user)
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+			if decision.Allowed != tt.allowed {
+				t.Errorf("Allowed = %v, want %v (rules %+v)", decision.Allowed, tt.allowed, decision.Rules)
+			}
+			if len(decision.Rules) != len(tt.conditions.Rules()) {
+				t.Errorf("%d rule results, want one per rule: %+v", len(decision.Rules), decision.Rules)
+			}
+			var skipped []string
+			for _, res := range decision.Rules {
+				if res.Skipped {
+					skipped = append(skipped, res.Path)
+				}
+			}
+			if strings.Join(skipped, ",") != strings.Join(tt.skipped, ",") {
+				t.Errorf("skipped rules = %v, want %v", skipped, tt.skipped)
+			}
+		})
+	}
+
+	// Results report what was read
+	decision, err := evaluator.Evaluate(context.Background(), Conditions{otherChainRule, or, ownerRule, or, paywallRule}, buyer)
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	if res := decision.Rules[0]; res.Passed || !strings.Contains(res.Reason, "unsupported chain") {
+		t.Errorf("rule on an unsupported chain = %+v, want failed with a reason", res)
+	}
+	if res := decision.Rules[1]; res.Kind != KindOwner || res.Value != "0" || res.TokenId != "42" || res.Contract != videoNFT.Hex() {
+		t.Errorf("owner rule = %+v", res)
+	}
+	if res := decision.Rules[2]; res.Kind != KindPaywall || !res.Passed || res.Value != "true" {
+		t.Errorf("paywall rule = %+v", res)
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	backend := simulated.NewBackend(types.GenesisAlloc{})
+	t.Cleanup(func() { backend.Close() })
+	evaluator := NewEvaluator(NewRPCReader(map[string]ethereum.ContractCaller{"base": backend.Client()}))
+
+	rule := Node{Rule: &LitActionRule{Chain: "base", IPFSID: "QmPlaybackAction"}}
+	tests := []struct {
+		name       string
+		conditions Conditions
+		path       string
+	}{
+		{"empty", Conditions{}, ""},
+		{"missing operator", Conditions{rule, rule}, "1"},
+		{"leading operator", Conditions{{Operator: OperatorOr}, rule}, "0"},
+		{"trailing operator", Conditions{rule, {Operator: OperatorAnd}}, ""},
+		{"invalid operator", Conditions{rule, {Operator: "xor"}, rule}, "1"},
+		{"empty group", Conditions{rule, {Operator: OperatorAnd}, {Group: Conditions{}}}, "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := evaluator.Evaluate(context.Background(), tt.conditions, common.Address{})
+			var conditionErr *ConditionError
+			if !errors.As(err, &conditionErr) || !errors.Is(err, ErrMalformed) || conditionErr.Path != tt.path {
+				t.Fatalf("Evaluate = %v, want a ConditionError at %q", err, tt.path)
+			}
+		})
+	}
+
+	// Chain state that cannot be read is an error, not a denial
+	paywall := Node{Rule: &PaywallRule{Chain: "base", Contract: common.HexToAddress("0x00000000000000000000000000000000000000b0"), TokenId: big.NewInt(42)}}
+	if _, err := evaluator.Evaluate(context.Background(), Conditions{paywall}, common.Address{}); err == nil || errors.Is(err, ErrMalformed) {
+		t.Fatalf("Evaluate of a paywall without a contract = %v, want a read error", err)
+	}
+}
@@ -0,0 +1,54 @@
+package acl
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/loop/playbackAccess/contracts"
+)
+
+// RPCReader is a ChainReader backed by JSON-RPC clients.
+type RPCReader struct {
+	callers map[string]ethereum.ContractCaller
+}
+
+// NewRPCReader returns a ChainReader that reads each chain through the client
+// registered for its name. Any JSON-RPC client (ethclient.Client) or go-ethereum's
+// simulated backend can be used.
+func NewRPCReader(callers map[string]ethereum.ContractCaller) *RPCReader {
+	return &RPCReader{callers: callers}
+}
+
+// BalanceOf implements ChainReader.
+func (r *RPCReader) BalanceOf(ctx context.Context, chain, standard string, contract, owner common.Address, id *big.Int) (*big.Int, error) {
+	caller, err := r.caller(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := contracts.NewToken(standard, contract, caller)
+	if err != nil {
+		return nil, err
+	}
+	return token.BalanceOf(ctx, owner, id)
+}
+
+// HasPurchasedVideo implements ChainReader.
+func (r *RPCReader) HasPurchasedVideo(ctx context.Context, chain string, contract common.Address, tokenId *big.Int, purchaser common.Address) (bool, error) {
+	caller, err := r.caller(chain)
+	if err != nil {
+		return false, err
+	}
+	return contracts.NewPurchaseManager(contract, caller).HasPurchasedVideo(ctx, tokenId, purchaser)
+}
+
+func (r *RPCReader) caller(chain string) (ethereum.ContractCaller, error) {
+	caller, ok := r.callers[chain]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedChain, chain)
+	}
+	return caller, nil
+}
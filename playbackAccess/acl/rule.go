@@ -0,0 +1,286 @@
+package acl
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/loop/playbackAccess/contracts"
+)
+
+// Rule kinds. They mirror the rule types of the webapp's access control builder.
+const (
+	KindToken     = "token"
+	KindOwner     = "owner"
+	KindPaywall   = "paywall"
+	KindLitAction = "litAction"
+)
+
+// Chain is a chain that conditions may refer to.
+type Chain struct {
+	ID int64
+	// VideoNFT is the VideoNFT contract deployed on the chain; ERC1155 rules on it are owner rules.
+	VideoNFT common.Address
+}
+
+// Chains lists the chains conditions may refer to, by the names the webapp uses,
+// e.g. "baseSepolia". The service builds it from its configured chains.
+type Chains map[string]Chain
+
+// hasPurchasedVideoABI is the functionAbi paywall conditions carry.
+var hasPurchasedVideoABI = json.RawMessage(`{"inputs":[{"type":"uint256","name":"tokenId"},{"type":"address","name":"purchaser"}],"name":"hasPurchasedVideo","outputs":[{"type":"bool","name":""}],"stateMutability":"view","type":"function"}`)
+
+// Rule is a single condition: a *TokenRule, *OwnerRule, *PaywallRule or *LitActionRule.
+type Rule interface {
+	// Kind returns the builder rule type, e.g. KindToken.
+	Kind() string
+	// ChainName returns the name of the chain the rule reads.
+	ChainName() string
+	condition() *condition
+}
+
+// Threshold is the balance test of token and owner rules.
+type Threshold struct {
+	Comparator string
+	Value      *big.Int
+}
+
+// TokenRule requires a balance of an ERC-20, ERC-721 or ERC-1155 token.
+// TokenId is required for ERC-1155 tokens and ignored otherwise.
+type TokenRule struct {
+	Chain     string
+	Standard  string
+	Contract  common.Address
+	TokenId   *big.Int
+	Threshold Threshold
+}
+
+// OwnerRule requires holding the video's VideoNFT (ERC-1155) token.
+type OwnerRule struct {
+	Chain     string
+	Contract  common.Address
+	TokenId   *big.Int
+	Threshold Threshold
+}
+
+// PaywallRule requires having bought the video from the PurchaseManager at Contract.
+type PaywallRule struct {
+	Chain    string
+	Contract common.Address
+	TokenId  *big.Int
+}
+
+// LitActionRule restricts decryption to the Lit Action published at IPFSID.
+type LitActionRule struct {
+	Chain  string
+	IPFSID string
+}
+
+// Kind implements Rule.
+func (r *TokenRule) Kind() string { return KindToken }
+
+// Kind implements Rule.
+func (r *OwnerRule) Kind() string { return KindOwner }
+
+// Kind implements Rule.
+func (r *PaywallRule) Kind() string { return KindPaywall }
+
+// Kind implements Rule.
+func (r *LitActionRule) Kind() string { return KindLitAction }
+
+// ChainName implements Rule.
+func (r *TokenRule) ChainName() string { return r.Chain }
+
+// ChainName implements Rule.
+func (r *OwnerRule) ChainName() string { return r.Chain }
+
+// ChainName implements Rule.
+func (r *PaywallRule) ChainName() string { return r.Chain }
+
+// ChainName implements Rule.
+func (r *LitActionRule) ChainName() string { return r.Chain }
+
+func (r *TokenRule) condition() *condition {
+	return balanceOfCondition(r.Chain, r.Standard, r.Contract, r.TokenId, r.Threshold)
+}
+
+func (r *OwnerRule) condition() *condition {
+	return balanceOfCondition(r.Chain, contracts.ERC1155, r.Contract, r.TokenId, r.Threshold)
+}
+
+func (r *PaywallRule) condition() *condition {
+	return &condition{
+		ConditionType:   ConditionEVMContract,
+		ContractAddress: r.Contract.Hex(),
+		FunctionName:    "hasPurchasedVideo",
+		FunctionParams:  []string{r.TokenId.String(), ParamUserAddress},
+		FunctionABI:     hasPurchasedVideoABI,
+		Chain:           r.Chain,
+		ReturnValueTest: returnValueTest{Comparator: "=", Value: "true"},
+	}
+}
+
+func (r *LitActionRule) condition() *condition {
+	return &condition{
+		ConditionType:   ConditionEVMBasic,
+		Parameters:      []string{ParamCurrentActionID},
+		Chain:           r.Chain,
+		ReturnValueTest: returnValueTest{Comparator: "=", Value: r.IPFSID},
+	}
+}
+
+func balanceOfCondition(chain, standard string, contract common.Address, tokenId *big.Int, threshold Threshold) *condition {
+	params := []string{ParamUserAddress}
+	if tokenId != nil {
+		params = append(params, tokenId.String())
+	}
+	return &condition{
+		ConditionType:        ConditionEVMBasic,
+		ContractAddress:      contract.Hex(),
+		StandardContractType: standard,
+		Method:               "balanceOf",
+		Parameters:           params,
+		Chain:                chain,
+		ReturnValueTest:      returnValueTest{Comparator: threshold.Comparator, Value: threshold.Value.String()},
+	}
+}
+
+// newRule validates a decoded condition and returns the rule it expresses.
+func newRule(c *condition, chains Chains) (Rule, error) {
+	chain, ok := chains[c.Chain]
+	if !ok {
+		return nil, fmt.Errorf("unknown chain %q", c.Chain)
+	}
+
+	switch {
+	case c.ConditionType == ConditionEVMBasic && len(c.Parameters) == 1 && c.Parameters[0] == ParamCurrentActionID:
+		if c.ReturnValueTest.Comparator != "=" || c.ReturnValueTest.Value == "" {
+			return nil, fmt.Errorf("litAction condition must compare the action with \"=\"")
+		}
+		return &LitActionRule{Chain: c.Chain, IPFSID: c.ReturnValueTest.Value}, nil
+
+	case c.ConditionType == ConditionEVMBasic && c.Method == "balanceOf":
+		return newBalanceRule(c, chain)
+
+	case c.ConditionType == ConditionEVMContract && c.FunctionName == "hasPurchasedVideo":
+		contract, err := parseAddress(c.ContractAddress)
+		if err != nil {
+			return nil, err
+		}
+		if len(c.FunctionParams) != 2 || c.FunctionParams[1] != ParamUserAddress {
+			return nil, fmt.Errorf("hasPurchasedVideo parameters must be [tokenId, %q]", ParamUserAddress)
+		}
+		tokenId, err := parseTokenId(c.FunctionParams[0])
+		if err != nil {
+			return nil, err
+		}
+		if c.ReturnValueTest.Comparator != "=" || c.ReturnValueTest.Value != "true" {
+			return nil, fmt.Errorf("hasPurchasedVideo must be tested with \"=\" \"true\"")
+		}
+		return &PaywallRule{Chain: c.Chain, Contract: contract, TokenId: tokenId}, nil
+
+	case c.ConditionType == ConditionEVMBasic || c.ConditionType == ConditionEVMContract:
+		return nil, fmt.Errorf("unsupported %s condition", c.ConditionType)
+
+	default:
+		return nil, fmt.Errorf("unsupported conditionType %q", c.ConditionType)
+	}
+}
+
+// newBalanceRule validates a balanceOf condition.
+func newBalanceRule(c *condition, chain Chain) (Rule, error) {
+	contract, err := parseAddress(c.ContractAddress)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Parameters) == 0 || c.Parameters[0] != ParamUserAddress {
+		return nil, fmt.Errorf("balanceOf must be read for %q", ParamUserAddress)
+	}
+
+	var tokenId *big.Int
+	switch c.StandardContractType {
+	case contracts.ERC20:
+		if len(c.Parameters) != 1 {
+			return nil, fmt.Errorf("ERC20 balanceOf takes no tokenId")
+		}
+	case contracts.ERC721:
+		// The builder always passes a tokenId; ERC-721 balances count every token
+		if len(c.Parameters) > 2 {
+			return nil, fmt.Errorf("too many balanceOf parameters")
+		}
+		if len(c.Parameters) == 2 {
+			if tokenId, err = parseTokenId(c.Parameters[1]); err != nil {
+				return nil, err
+			}
+		}
+	case contracts.ERC1155:
+		if len(c.Parameters) != 2 {
+			return nil, fmt.Errorf("missing tokenId for ERC1155")
+		}
+		if tokenId, err = parseTokenId(c.Parameters[1]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported standardContractType %q", c.StandardContractType)
+	}
+
+	threshold, err := parseThreshold(c.ReturnValueTest)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.StandardContractType == contracts.ERC1155 && contract == chain.VideoNFT {
+		return &OwnerRule{Chain: c.Chain, Contract: contract, TokenId: tokenId, Threshold: threshold}, nil
+	}
+	return &TokenRule{Chain: c.Chain, Standard: c.StandardContractType, Contract: contract, TokenId: tokenId, Threshold: threshold}, nil
+}
+
+func parseAddress(s string) (common.Address, error) {
+	if !common.IsHexAddress(s) {
+		return common.Address{}, fmt.Errorf("invalid contract address %q", s)
+	}
+	return common.HexToAddress(s), nil
+}
+
+func parseTokenId(s string) (*big.Int, error) {
+	id, ok := new(big.Int).SetString(s, 10)
+	if !ok || id.Sign() < 0 {
+		return nil, fmt.Errorf("invalid tokenId %q", s)
+	}
+	return id, nil
+}
+
+func parseThreshold(test returnValueTest) (Threshold, error) {
+	switch test.Comparator {
+	case ">=", ">", "=", "==", "!=", "<=", "<":
+	default:
+		return Threshold{}, fmt.Errorf("unsupported comparator %q", test.Comparator)
+	}
+	value, ok := new(big.Int).SetString(test.Value, 10)
+	if !ok || value.Sign() < 0 {
+		return Threshold{}, fmt.Errorf("invalid balance %q", test.Value)
+	}
+	return Threshold{Comparator: test.Comparator, Value: value}, nil
+}
+
+// test reports whether balance satisfies the threshold.
+func (t Threshold) test(balance *big.Int) bool {
+	cmp := balance.Cmp(t.Value)
+	switch t.Comparator {
+	case ">=":
+		return cmp >= 0
+	case ">":
+		return cmp > 0
+	case "=", "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<=":
+		return cmp <= 0
+	case "<":
+		return cmp < 0
+	default:
+		return false
+	}
+}
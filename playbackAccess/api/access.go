@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/loop/playbackAccess/acl"
+	"github.com/loop/playbackAccess/db"
+	"github.com/loop/playbackAccess/model"
+)
+
+// Access handles GET /v1/videos/{tokenId}/access. It runs the same checks as
+// playback on the credentials in the Authorization header and reports whether
+// the viewer may play the video: with a link to play it, or with the reason they
+// may not, which the player maps to a lock screen. Credentials are a playback
+// session, "Bearer <token>", or an authSig, "AuthSig <base64url JSON>". The
+// authorization is only verified: checking access changes nothing and issues no
+// session, so the same authSig can then be sent to playback.
+//
+// Denials are successful responses; only failures to complete the check are sent
+// as errors.
+func (s *Server) Access(w http.ResponseWriter, r *http.Request) {
+	tokenId := r.PathValue("tokenId")
+	if !isTokenId(tokenId) {
+		s.HandleErr(w, http.StatusNotFound, "Video not found", nil, "VIDEO_NOT_FOUND", nil)
+		return
+	}
+
+	authSig, err := authorizationAuthSig(r.Header.Get("Authorization"))
+	if err != nil {
+		s.HandleErr(w, http.StatusBadRequest, err.Error(), err, "BAD_REQUEST", nil)
+		return
+	}
+	req := model.RequestBody{TokenId: tokenId, AuthSig: authSig}
+
+	// The status is the viewer's own and changes as they sign in and unlock
+	w.Header().Set("Cache-Control", "private, no-store")
+
+	videoStore, err := GetVideoMetadata(s.rdb, s.dbClient, s.aclChains, tokenId)
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrVideoNotFound):
+			// Videos are only served once ready; tell those still processing, and
+			// those that never will be, apart
+			if status, statusErr := s.dbClient.GetVideoStatus(r.Context(), tokenId); statusErr == nil {
+				if status == "failed" {
+					SendSuccessResponse(w, http.StatusOK, model.AccessStatus{Reason: model.ReasonVideoFailed, Code: "VIDEO_FAILED"})
+					return
+				}
+				SendSuccessResponse(w, http.StatusOK, model.AccessStatus{Reason: model.ReasonVideoNotReady, Code: "VIDEO_NOT_READY"})
+				return
+			} else if !errors.Is(statusErr, db.ErrVideoNotFound) {
+				s.HandleErr(w, http.StatusInternalServerError, "Error fetching video status", statusErr, "INTERNAL_ERROR_DB", nil)
+				return
+			}
+			s.HandleErr(w, http.StatusNotFound, "Video not found", err, "VIDEO_NOT_FOUND", nil)
+		case errors.Is(err, acl.ErrMalformed):
+			s.HandleErr(w, http.StatusInternalServerError, "Invalid access conditions", err, "INVALID_ACCESS_CONDITIONS", err.Error())
+		default:
+			s.HandleErr(w, http.StatusInternalServerError, "Error fetching video metadata", err, "INTERNAL_ERROR", nil)
+		}
+		return
+	}
+
+	granted, accessErr := s.verifyAuthorization(r.Context(), &req, videoStore)
+	if accessErr != nil {
+		if accessErr.reason == "" {
+			s.sendAccessError(w, accessErr)
+			return
+		}
+		SendSuccessResponse(w, http.StatusOK, model.AccessStatus{Reason: accessErr.reason, Code: accessErr.code})
+		return
+	}
+
+	link, err := s.videoLink(r.Context(), tokenId, videoStore, s.linkExpiry(videoStore.Visibility, granted.exp))
+	if err != nil {
+		s.HandleErr(w, http.StatusInternalServerError, "Failed to create public shared link", err, "INTERNAL_ERROR", nil)
+		return
+	}
+
+	SendSuccessResponse(w, http.StatusOK, model.AccessStatus{
+		SignedUrl: &link.Src,
+		Access:    true,
+		Type:      link.Type,
+		ExpiresAt: link.NotAfter.UnixMilli(),
+	})
+}
+
+// authorizationAuthSig returns the authSig carried by an Authorization header
+// value: a session token, "Bearer <token>", or an authSig encoded as base64url
+// JSON, "AuthSig <encoded>". An empty header carries no credentials.
+func authorizationAuthSig(header string) (model.AuthSig, error) {
+	var authSig model.AuthSig
+	if header == "" {
+		return authSig, nil
+	}
+
+	scheme, credentials, _ := strings.Cut(header, " ")
+	credentials = strings.TrimSpace(credentials)
+	switch {
+	case strings.EqualFold(scheme, "Bearer"):
+		authSig.Sig = credentials
+		authSig.DerivedVia = "loop.session"
+	case strings.EqualFold(scheme, "AuthSig"):
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(credentials, "="))
+		if err != nil {
+			return authSig, fmt.Errorf("malformed AuthSig credentials: %w", err)
+		}
+		if err := json.Unmarshal(decoded, &authSig); err != nil {
+			return authSig, fmt.Errorf("malformed AuthSig credentials: %w", err)
+		}
+	default:
+		return authSig, fmt.Errorf("unsupported authorization scheme %q", scheme)
+	}
+	return authSig, nil
+}
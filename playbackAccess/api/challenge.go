@@ -0,0 +1,236 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/loop/playbackAccess/auth"
+	"github.com/loop/playbackAccess/model"
+	"github.com/loop/playbackAccess/redis"
+	redisgo "github.com/redis/go-redis/v9"
+)
+
+// challengeMethods lists the derivedVia methods whose signed messages carry a challenge nonce.
+var challengeMethods = map[string]bool{
+	"lit.action":     true,
+	"loop.web3.auth": true,
+	"siwe":           true,
+	"eip712":         true,
+}
+
+// legacyNonceMethods lists the challenge methods whose existing clients sign nonces of
+// their own: the Lit action's random nonce and the blockhash Lit requires of
+// loop.web3.auth messages. With challenges.allowLegacyNonces, such nonces are
+// accepted once each instead of being rejected as not issued.
+var legacyNonceMethods = map[string]bool{
+	"lit.action":     true,
+	"loop.web3.auth": true,
+}
+
+// clientNonceMethods lists the challenge methods whose messages may instead carry a
+// nonce of the signer's own, whatever challenges.allowLegacyNonces says: SIWE
+// messages signed through Privy carry Privy's nonce and are accepted as they are.
+// handleSIWE consumes such nonces once each, for as long as the message is valid.
+var clientNonceMethods = map[string]bool{
+	"siwe": true,
+}
+
+var (
+	// errChallengeNotIssued is returned when a nonce was never issued or its challenge has expired.
+	errChallengeNotIssued = errors.New("nonce was not issued by this service or has expired")
+	// errChallengeRedeemed is returned when a challenge was already used.
+	errChallengeRedeemed = errors.New("challenge was already used")
+	// errChallengeMismatch is returned when a challenge was issued for a different request.
+	errChallengeMismatch = errors.New("challenge was issued for a different request")
+	// errMalformedMessage is returned when the nonce cannot be read from the signed message.
+	errMalformedMessage = errors.New("malformed signed message")
+)
+
+// CreateChallenge issues a single-use nonce for a signed playback request.
+// The nonce is stored with a short TTL and bound to the address, tokenId and
+// derivedVia it was requested for; a signed message carrying it is only
+// accepted for that same combination. Requests are rate limited per client.
+func (s *Server) CreateChallenge(w http.ResponseWriter, r *http.Request) {
+	allowed, retryAfter, err := s.rdb.Allow(r.Context(), "challenge:client:"+clientAddress(r), s.cfg.Challenges.RateLimit, time.Duration(s.cfg.Challenges.RateWindow))
+	if err != nil {
+		s.HandleErr(w, http.StatusInternalServerError, "Error checking rate limit", err, "INTERNAL_ERROR_REDIS", nil)
+		return
+	}
+	if !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		s.HandleErr(w, http.StatusTooManyRequests, "Too many challenge requests", nil, "RATE_LIMITED", nil)
+		return
+	}
+
+	var req model.ChallengeRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.HandleErr(w, http.StatusBadRequest, "Failed to read request body", err, "BAD_REQUEST", nil)
+		return
+	}
+
+	if !common.IsHexAddress(req.Address) {
+		s.HandleErr(w, http.StatusBadRequest, "Invalid address", nil, "BAD_REQUEST", nil)
+		return
+	}
+	if !isTokenId(req.TokenId) {
+		s.HandleErr(w, http.StatusBadRequest, "Invalid tokenId", nil, "BAD_REQUEST", nil)
+		return
+	}
+	if !challengeMethods[req.DerivedVia] {
+		s.HandleErr(w, http.StatusBadRequest, "Unsupported derivedVia", nil, "BAD_REQUEST", nil)
+		return
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		s.HandleErr(w, http.StatusInternalServerError, "Failed to generate nonce", err, "INTERNAL_ERROR", nil)
+		return
+	}
+
+	challenge := &model.Challenge{
+		Nonce:      nonce,
+		Address:    strings.ToLower(req.Address),
+		TokenId:    req.TokenId,
+		DerivedVia: req.DerivedVia,
+		ExpiresAt:  time.Now().Add(time.Duration(s.cfg.Challenges.TTL)).UnixMilli(),
+	}
+
+	if err := s.rdb.SetChallenge(r.Context(), challenge); err != nil {
+		s.HandleErr(w, http.StatusInternalServerError, "Failed to store challenge", err, "INTERNAL_ERROR_REDIS", nil)
+		return
+	}
+
+	SendSuccessResponse(w, http.StatusCreated, challenge)
+}
+
+// checkChallenge checks that the challenge nonce carried by signedMessage was issued
+// for this address, tokenId and derivedVia and has not been used. Committing a
+// redeems the challenge.
+// For lit.action the bound address is the viewer's userAddress in the message,
+// since the message itself is signed by the video's Lit-held key.
+func (s *Server) checkChallenge(ctx context.Context, a *authorization, derivedVia, signedMessage, tokenId, authSigAddress string) error {
+	nonce, address, err := challengeNonce(derivedVia, signedMessage, authSigAddress)
+	if err != nil {
+		return err
+	}
+
+	challenge, err := s.rdb.GetChallenge(ctx, nonce)
+	if err != nil {
+		return challengeLookupError(err)
+	}
+
+	if challenge.DerivedVia != derivedVia ||
+		challenge.TokenId != tokenId ||
+		!strings.EqualFold(challenge.Address, address) {
+		return errChallengeMismatch
+	}
+
+	// Of concurrent requests with the same challenge, only one redeems it
+	a.onCommit(func(ctx context.Context) *accessError {
+		if _, err := s.rdb.RedeemChallenge(ctx, nonce); err != nil {
+			return challengeError(challengeLookupError(err))
+		}
+		return nil
+	})
+	return nil
+}
+
+// challengeLookupError returns the error for a challenge that could not be
+// looked up or redeemed with err.
+func challengeLookupError(err error) error {
+	switch {
+	case err == redisgo.Nil:
+		return errChallengeNotIssued
+	case errors.Is(err, redis.ErrChallengeRedeemed):
+		return errChallengeRedeemed
+	default:
+		return err
+	}
+}
+
+// checkLegacyNonce accepts the nonce of a legacy lit.action or loop.web3.auth
+// message that was not issued as a challenge, at most once. lit.action nonces are
+// checked by handleLitAction along with the rest of the message; loop.web3.auth
+// nonces are checked here, and consumed until the message expires when a is
+// committed.
+func (s *Server) checkLegacyNonce(ctx context.Context, a *authorization, derivedVia, signedMessage string) error {
+	if derivedVia != "loop.web3.auth" {
+		return nil
+	}
+
+	msg, err := auth.ParseSIWEMessage(signedMessage)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errMalformedMessage, err)
+	}
+
+	// Without an expiration time, the message is accepted for as long as a SIWE message
+	now := time.Now()
+	siweCfg := s.cfg.SIWE
+	exp := msg.IssuedAt.Add(time.Duration(siweCfg.MaxAge + siweCfg.ClockSkew))
+	if msg.ExpirationTime != nil {
+		exp = msg.ExpirationTime.Add(time.Duration(siweCfg.ClockSkew))
+	}
+	if now.After(exp) {
+		return errMessageExpired
+	}
+
+	return s.useNonce(ctx, a, fmt.Sprintf("nonce:loop.web3.auth:%s", msg.Nonce), exp, errNonceReused, challengeError)
+}
+
+// challengeNonce extracts the nonce from a signed message, along with the address
+// the challenge must be bound to.
+func challengeNonce(derivedVia, signedMessage, authSigAddress string) (nonce, address string, err error) {
+	switch derivedVia {
+	case "lit.action", "eip712":
+		var msg model.SignedMessage
+		if err := json.Unmarshal([]byte(signedMessage), &msg); err != nil {
+			return "", "", fmt.Errorf("%w: %v", errMalformedMessage, err)
+		}
+		if derivedVia == "lit.action" {
+			return msg.Nonce, msg.UserAddress, nil
+		}
+		return msg.Nonce, authSigAddress, nil
+
+	case "siwe", "loop.web3.auth":
+		msg, err := auth.ParseSIWEMessage(signedMessage)
+		if err != nil {
+			return "", "", fmt.Errorf("%w: %v", errMalformedMessage, err)
+		}
+		return msg.Nonce, authSigAddress, nil
+	}
+
+	return "", "", fmt.Errorf("%w: unsupported derivedVia", errMalformedMessage)
+}
+
+// newNonce returns a random 128-bit nonce in hex, which also satisfies the
+// EIP-4361 alphanumeric nonce grammar.
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// isTokenId reports whether s is a decimal token ID.
+func isTokenId(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/loop/playbackAccess/config"
+	"github.com/loop/playbackAccess/model"
+)
+
+func TestCreateChallengeRateLimit(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Challenges.RateLimit = 2
+	})
+	router := NewRouter(s)
+
+	body := model.ChallengeRequestBody{Address: "0x00000000000000000000000000000000000000aa", TokenId: "42", DerivedVia: "siwe"}
+	for i := 0; i < 2; i++ {
+		if w := do(t, router, http.MethodPost, "/v1/challenges", body, nil); w.Code != http.StatusCreated {
+			t.Fatalf("challenge %d = %d %s", i, w.Code, w.Body.String())
+		}
+	}
+	w := do(t, router, http.MethodPost, "/v1/challenges", body, nil)
+	if w.Code != http.StatusTooManyRequests || errorCode(t, w) != "RATE_LIMITED" {
+		t.Fatalf("challenge over the limit = %d %s, want 429 RATE_LIMITED", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After")
+	}
+}
+
+// loopAuthRequest returns a request with a loop.web3.auth message carrying nonce,
+// signed with key as the Lit session callback does.
+func loopAuthRequest(t *testing.T, key *ecdsa.PrivateKey, nonce string) model.RequestBody {
+	t.Helper()
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	now := time.Now().UTC()
+	message := fmt.Sprintf("www.getloop.xyz wants you to sign in with your Ethereum account:\n%s\n\nURI: lit:session:1\nVersion: 1\nChain ID: 84532\nNonce: %s\nIssued At: %s\nExpiration Time: %s",
+		address.Hex(), nonce, now.Format(time.RFC3339), now.Add(time.Hour).Format(time.RFC3339))
+	sig, err := crypto.Sign(accounts.TextHash([]byte(message)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+	return model.RequestBody{AuthSig: model.AuthSig{
+		Sig:           hexutil.Encode(sig),
+		DerivedVia:    "loop.web3.auth",
+		SignedMessage: message,
+		Address:       address.Hex(),
+	}}
+}
+
+func TestAccessDoesNotUseChallenge(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	address := crypto.PubkeyToAddress(key.PublicKey)
+
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Challenges.AllowLegacyNonces = false
+	})
+	router := NewRouter(s)
+	cacheVideo(t, s, "42", &model.VideoStore{Id: "video-42", Visibility: "protected"})
+	grantAccess(t, s, "42", strings.ToLower(address.Hex()))
+
+	req := loopAuthRequest(t, key, issueChallenge(t, router, address.Hex(), "42", "loop.web3.auth"))
+	encoded, err := json.Marshal(req.AuthSig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{"Authorization": {"AuthSig " + base64.RawURLEncoding.EncodeToString(encoded)}}
+
+	// Checking access leaves the challenge to playback, however often it is checked
+	for i := 0; i < 2; i++ {
+		w := do(t, router, http.MethodGet, "/v1/videos/42/access", nil, header)
+		if w.Code != http.StatusOK {
+			t.Fatalf("access = %d %s", w.Code, w.Body.String())
+		}
+		var status model.AccessStatus
+		decodeData(t, w, &status)
+		if !status.Access || status.SignedUrl == nil {
+			t.Fatalf("access = %+v, want access", status)
+		}
+		if strings.Contains(w.Body.String(), `"session"`) {
+			t.Fatalf("access issued a session: %s", w.Body.String())
+		}
+	}
+
+	if w := do(t, router, http.MethodPost, "/v1/videos/42/playback", req, nil); w.Code != http.StatusOK {
+		t.Fatalf("playback after checking access = %d %s", w.Code, w.Body.String())
+	}
+	w := do(t, router, http.MethodGet, "/v1/videos/42/access", nil, header)
+	var status model.AccessStatus
+	decodeData(t, w, &status)
+	if status.Access || status.Reason != model.ReasonNonceReused {
+		t.Fatalf("access after playback = %+v, want reason %s", status, model.ReasonNonceReused)
+	}
+}
+
+func TestPlaybackLegacyNonce(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	address := crypto.PubkeyToAddress(key.PublicKey)
+
+	signedRequest := func(nonce string) model.RequestBody {
+		return loopAuthRequest(t, key, nonce)
+	}
+	blockhash := "0x" + strings.Repeat("ab", 32)
+
+	t.Run("allowed", func(t *testing.T) {
+		s := newTestServer(t, func(cfg *config.Config) {
+			cfg.Challenges.AllowLegacyNonces = true
+		})
+		router := NewRouter(s)
+		cacheVideo(t, s, "42", &model.VideoStore{Id: "video-42", Visibility: "protected"})
+		grantAccess(t, s, "42", strings.ToLower(address.Hex()))
+
+		req := signedRequest(blockhash)
+		if w := do(t, router, http.MethodPost, "/v1/videos/42/playback", req, nil); w.Code != http.StatusOK {
+			t.Fatalf("playback = %d %s", w.Code, w.Body.String())
+		}
+		w := do(t, router, http.MethodPost, "/v1/videos/42/playback", req, nil)
+		if w.Code != http.StatusUnauthorized || errorCode(t, w) != "CHALLENGE_INVALID" {
+			t.Fatalf("replayed playback = %d %s, want 401 CHALLENGE_INVALID", w.Code, w.Body.String())
+		}
+
+		// Issued challenges are still bound to their request
+		nonce := issueChallenge(t, router, address.Hex(), "7", "loop.web3.auth")
+		w = do(t, router, http.MethodPost, "/v1/videos/42/playback", signedRequest(nonce), nil)
+		if w.Code != http.StatusUnauthorized || errorCode(t, w) != "CHALLENGE_MISMATCH" {
+			t.Fatalf("playback with another video's challenge = %d %s, want 401 CHALLENGE_MISMATCH", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("disallowed", func(t *testing.T) {
+		s := newTestServer(t, func(cfg *config.Config) {
+			cfg.Challenges.AllowLegacyNonces = false
+		})
+		router := NewRouter(s)
+		cacheVideo(t, s, "42", &model.VideoStore{Id: "video-42", Visibility: "protected"})
+		grantAccess(t, s, "42", strings.ToLower(address.Hex()))
+
+		w := do(t, router, http.MethodPost, "/v1/videos/42/playback", signedRequest(blockhash), nil)
+		if w.Code != http.StatusUnauthorized || errorCode(t, w) != "CHALLENGE_INVALID" {
+			t.Fatalf("playback = %d %s, want 401 CHALLENGE_INVALID", w.Code, w.Body.String())
+		}
+		nonce := issueChallenge(t, router, address.Hex(), "42", "loop.web3.auth")
+		req := signedRequest(nonce)
+		if w := do(t, router, http.MethodPost, "/v1/videos/42/playback", req, nil); w.Code != http.StatusOK {
+			t.Fatalf("playback with a challenge = %d %s", w.Code, w.Body.String())
+		}
+
+		// Reused challenges are told from expired ones
+		w = do(t, router, http.MethodPost, "/v1/videos/42/playback", req, nil)
+		if w.Code != http.StatusUnauthorized || errorCode(t, w) != "CHALLENGE_REUSED" {
+			t.Fatalf("replayed playback = %d %s, want 401 CHALLENGE_REUSED", w.Code, w.Body.String())
+		}
+		req.TokenId = "42"
+		videoStore := &model.VideoStore{Id: "video-42", Visibility: "protected"}
+		if _, accessErr := s.authorize(context.Background(), &req, videoStore); accessErr == nil || accessErr.reason != model.ReasonNonceReused {
+			t.Errorf("authorize with a reused challenge = %+v, want reason %s", accessErr, model.ReasonNonceReused)
+		}
+
+		nonce = issueChallenge(t, router, address.Hex(), "42", "loop.web3.auth")
+		if err := s.rdb.Del(context.Background(), "challenge:"+nonce).Err(); err != nil {
+			t.Fatal(err)
+		}
+		req = signedRequest(nonce)
+		req.TokenId = "42"
+		if _, accessErr := s.authorize(context.Background(), &req, videoStore); accessErr == nil || accessErr.code != "CHALLENGE_INVALID" || accessErr.reason != model.ReasonGrantExpired {
+			t.Errorf("authorize with an expired challenge = %+v, want CHALLENGE_INVALID with reason %s", accessErr, model.ReasonGrantExpired)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/loop/playbackAccess/acl"
+	"github.com/loop/playbackAccess/db"
+	"github.com/loop/playbackAccess/links"
+	"github.com/loop/playbackAccess/model"
+)
+
+// maxFilenameLength is the length, in characters, of the longest download filename without extension.
+const maxFilenameLength = 100
+
+// Download handles POST /v1/videos/{tokenId}/download. It runs the same
+// authorization as playback on the authSig in the body and, if the creator allows
+// downloads of the video, returns a short-lived link that downloads its original
+// file as an attachment named after the video's title.
+func (s *Server) Download(w http.ResponseWriter, r *http.Request) {
+	tokenId := r.PathValue("tokenId")
+	if !isTokenId(tokenId) {
+		s.HandleErr(w, http.StatusNotFound, "Video not found", nil, "VIDEO_NOT_FOUND", nil)
+		return
+	}
+
+	req, ok := s.decodeVideoRequest(w, r, tokenId)
+	if !ok {
+		return
+	}
+
+	videoStore, err := GetVideoMetadata(s.rdb, s.dbClient, s.aclChains, tokenId)
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrVideoNotFound):
+			s.HandleErr(w, http.StatusNotFound, "Video not found", err, "VIDEO_NOT_FOUND", nil)
+		case errors.Is(err, acl.ErrMalformed):
+			s.HandleErr(w, http.StatusInternalServerError, "Invalid access conditions", err, "INVALID_ACCESS_CONDITIONS", err.Error())
+		default:
+			s.HandleErr(w, http.StatusInternalServerError, "Error fetching video metadata", err, "INTERNAL_ERROR", nil)
+		}
+		return
+	}
+
+	// Checked first so that a refused download does not use up the viewer's challenge
+	if !videoStore.IsDownloadable {
+		s.HandleErr(w, http.StatusForbidden, "The creator does not allow downloads of this video", nil, "DOWNLOAD_NOT_ALLOWED", nil)
+		return
+	}
+	source := downloadSource(videoStore)
+	if source == nil {
+		s.HandleErr(w, http.StatusNotFound, "The video has no downloadable file", nil, "DOWNLOAD_UNAVAILABLE", nil)
+		return
+	}
+
+	granted, accessErr := s.authorize(r.Context(), req, videoStore)
+	if accessErr != nil {
+		s.sendAccessError(w, accessErr)
+		return
+	}
+
+	filename := downloadFilename(videoStore.Title, tokenId, source)
+	link, err := s.downloads.DownloadLink(r.Context(), source.Id, filename, s.downloadExpiry(granted.exp))
+	if err != nil {
+		s.HandleErr(w, http.StatusInternalServerError, "Failed to create download link", err, "INTERNAL_ERROR", nil)
+		return
+	}
+
+	SendSuccessResponse(w, http.StatusOK, model.Download{
+		Src:         link.Src,
+		Type:        source.Type,
+		Filename:    filename,
+		FilenameSet: link.Filename == filename,
+		ExpiresAt:   link.NotAfter.UnixMilli(),
+	})
+}
+
+// downloadExpiry returns when a download link for access that ends at accessExp
+// (zero if unknown) should stop working: like playable links, but after at most
+// the download link lifetime.
+func (s *Server) downloadExpiry(accessExp time.Time) time.Time {
+	now := time.Now()
+	exp := now.Add(time.Duration(s.cfg.Links.DownloadExpiration))
+	if !accessExp.IsZero() && accessExp.Before(exp) {
+		exp = accessExp
+	}
+	if floor := now.Add(time.Duration(s.cfg.Links.MinExpiration)); exp.Before(floor) {
+		exp = floor
+	}
+	return exp
+}
+
+// downloadSource returns the file of the video to download: its original MP4,
+// or else its original upload in another format. The HLS renditions made from
+// it cannot be downloaded as a single file.
+func downloadSource(videoStore *model.VideoStore) *model.MediaSource {
+	var original *model.MediaSource
+	for i := range videoStore.Sources {
+		source := &videoStore.Sources[i]
+		if source.Id == "" || strings.EqualFold(source.Type, links.HLSType) {
+			continue
+		}
+		if strings.EqualFold(source.Type, "video/mp4") {
+			return source
+		}
+		if original == nil && strings.HasPrefix(source.Type, "video/") {
+			original = source
+		}
+	}
+	return original
+}
+
+// downloadFilename returns the name of the downloaded file: the video's title,
+// without characters that file systems reject, and the source's extension.
+func downloadFilename(title, tokenId string, source *model.MediaSource) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, title)
+	name = strings.Trim(name, " .")
+	if runes := []rune(name); len(runes) > maxFilenameLength {
+		name = strings.TrimSpace(string(runes[:maxFilenameLength]))
+	}
+	if name == "" {
+		name = "video-" + tokenId
+	}
+
+	ext := path.Ext(source.Id)
+	if ext == "" {
+		if strings.EqualFold(source.Type, "video/mp4") {
+			ext = ".mp4"
+		} else if exts, err := mime.ExtensionsByType(source.Type); err == nil && len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	return name + ext
+}
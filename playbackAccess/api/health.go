@@ -0,0 +1,10 @@
+package api
+
+import (
+	"net/http"
+)
+
+// ChainHealth reports the head block and RPC provider health of every configured chain.
+func (s *Server) ChainHealth(w http.ResponseWriter, r *http.Request) {
+	SendSuccessResponse(w, http.StatusOK, s.chains.Health())
+}
@@ -4,27 +4,40 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math/big"
 	"net/http"
-	"os"
 	"runtime/debug"
 	"strings"
 	"time"
 
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/loop/playbackAccess/acl"
 	"github.com/loop/playbackAccess/auth"
 	"github.com/loop/playbackAccess/db"
+	"github.com/loop/playbackAccess/links"
 	"github.com/loop/playbackAccess/model"
 	"github.com/loop/playbackAccess/redis"
-	"github.com/loop/playbackAccess/storj"
 	redisgo "github.com/redis/go-redis/v9"
 )
 
 var ctx = context.Background()
 
+var (
+	// errMessageExpired is returned when a signed lit.action or EIP-712 message has expired.
+	errMessageExpired = errors.New("expired")
+	// errNonceReused is returned when the nonce of a signed message has already been used.
+	errNonceReused = errors.New("nonce already used")
+)
+
 // GetVideoMetadata retrieves video metadata from Redis cache or PostgreSQL database.
 // It first attempts to fetch the metadata from Redis. If not found, it queries the
-// database and caches the result in Redis for future requests.
+// database and caches the result in Redis for future requests. The video's access
+// conditions are decoded against chains; malformed ones fail with acl.ErrMalformed.
 //
 // Flow:
 // 1. Construct Redis key using tokenId
@@ -32,9 +45,11 @@ var ctx = context.Background()
 // 3. If found in Redis, parse and return
 // 4. If not in Redis, query database
 // 5. Cache database result in Redis
-// 6. Return metadata
-func GetVideoMetadata(rdb *redis.Client, dbClient *db.Client, tokenId string) (*model.VideoStore, error) {
-	tokenKey := fmt.Sprintf("token:%s", tokenId)
+// 6. Decode access conditions and return metadata
+func GetVideoMetadata(rdb *redis.Client, dbClient *db.Client, chains acl.Chains, tokenId string) (*model.VideoStore, error) {
+	// The version changes with the fields of VideoStore, so that entries cached
+	// without them are not read
+	tokenKey := fmt.Sprintf("token:v2:%s", tokenId)
 
 	// Try to get metadata from Redis first
 	videoStoreStr, err := rdb.GetVideoMetadata(tokenKey)
@@ -43,7 +58,7 @@ func GetVideoMetadata(rdb *redis.Client, dbClient *db.Client, tokenId string) (*
 		if err := json.Unmarshal([]byte(videoStoreStr), &videoStore); err != nil {
 			return nil, fmt.Errorf("error parsing video metadata from Redis: %w", err)
 		}
-		return &videoStore, nil
+		return decodeConditions(&videoStore, chains)
 	}
 
 	// If not in Redis, try database
@@ -58,34 +73,186 @@ func GetVideoMetadata(rdb *redis.Client, dbClient *db.Client, tokenId string) (*
 			log.Printf("Warning: failed to cache video metadata in Redis: %v", err)
 		}
 
-		return videoStore, nil
+		return decodeConditions(videoStore, chains)
 	}
 
 	return nil, fmt.Errorf("error fetching video metadata from Redis: %w", err)
 }
 
-// Handler handles video playback access requests.
-// It processes incoming requests, verifies authentication,
-// checks access permissions, and generates video access links.
-func Handler(w http.ResponseWriter, r *http.Request) {
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+// decodeConditions decodes the access conditions of videoStore, if it has any, against chains.
+func decodeConditions(videoStore *model.VideoStore, chains acl.Chains) (*model.VideoStore, error) {
+	if videoStore.PlaybackAccess == nil {
+		return videoStore, nil
+	}
+	conditions, err := acl.Decode(videoStore.PlaybackAccess.ACL, chains)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing access conditions: %w", err)
+	}
+	videoStore.PlaybackAccess.Conditions = conditions
+	return videoStore, nil
+}
+
+// Handler serves POST /, the playback endpoint of players built before the
+// versioned API, which name the video by the tokenId in the body. It responds
+// like Playback.
+func (s *Server) Handler(w http.ResponseWriter, r *http.Request) {
+	var req model.RequestBody
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.HandleErr(w, http.StatusBadRequest, "Failed to read request body", err, "BAD_REQUEST", nil)
+		return
+	}
+
+	s.playback(w, r, &req)
+}
+
+// Playback handles POST /v1/videos/{tokenId}/playback. It processes incoming
+// requests, verifies authentication, checks access permissions, and generates
+// video access links.
+func (s *Server) Playback(w http.ResponseWriter, r *http.Request) {
+	tokenId := r.PathValue("tokenId")
+	if !isTokenId(tokenId) {
+		s.HandleErr(w, http.StatusNotFound, "Video not found", nil, "VIDEO_NOT_FOUND", nil)
 		return
 	}
 
-	if r.Method != http.MethodPost {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	req, ok := s.decodeVideoRequest(w, r, tokenId)
+	if !ok {
 		return
 	}
 
+	s.playback(w, r, req)
+}
+
+// decodeVideoRequest reads the body of a request to an endpoint of the video with
+// tokenId: an authSig and, optionally, the same tokenId. Requests for public videos
+// may have no body. It sends the error response and returns false if the body is invalid.
+func (s *Server) decodeVideoRequest(w http.ResponseWriter, r *http.Request, tokenId string) (*model.RequestBody, bool) {
 	var req model.RequestBody
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		HandleErr(w, http.StatusBadRequest, "Failed to read request body", err, "BAD_REQUEST", nil)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.HandleErr(w, http.StatusBadRequest, "Failed to read request body", err, "BAD_REQUEST", nil)
+		return nil, false
+	}
+	if req.TokenId != "" && req.TokenId != tokenId {
+		s.HandleErr(w, http.StatusBadRequest, "tokenId does not match the URL", nil, "BAD_REQUEST", nil)
+		return nil, false
+	}
+	req.TokenId = tokenId
+	return &req, true
+}
+
+// playback authorizes req and sends a playable source for its video.
+func (s *Server) playback(w http.ResponseWriter, r *http.Request, req *model.RequestBody) {
+	tokenId := req.TokenId
+	visibility := "protected"
+	var videoStore *model.VideoStore
+
+	// Check token and get video metadata if tokenId is provided
+	if req.TokenId != "" {
+		var err error
+		videoStore, err = GetVideoMetadata(s.rdb, s.dbClient, s.aclChains, req.TokenId)
+		if err != nil {
+			switch {
+			case errors.Is(err, db.ErrVideoNotFound):
+				s.HandleErr(w, http.StatusNotFound, "Video not found", err, "VIDEO_NOT_FOUND", nil)
+			case errors.Is(err, acl.ErrMalformed):
+				s.HandleErr(w, http.StatusInternalServerError, "Invalid access conditions", err, "INVALID_ACCESS_CONDITIONS", err.Error())
+			default:
+				s.HandleErr(w, http.StatusInternalServerError, "Error fetching video metadata", err, "INTERNAL_ERROR", nil)
+			}
+			return
+		}
+
+		visibility = videoStore.Visibility
+	}
+
+	granted, accessErr := s.authorize(r.Context(), req, videoStore)
+	if accessErr != nil {
+		s.sendAccessError(w, accessErr)
 		return
 	}
 
-	log.Printf("Request body: %+v", req)
+	// Viewers who signed get a session so they need not sign again; public videos
+	// need none, and sessions are not extended by using them
+	var session *model.Session
+	if !granted.public && !granted.fromSession {
+		session = s.issueSession(granted.address, tokenId, granted.derivedVia, granted.exp)
+	}
+	s.CreateAndSendPublicSharedLink(w, tokenId, videoStore, s.linkExpiry(visibility, granted.exp), session)
+}
+
+// access is the outcome of a successful authorization.
+type access struct {
+	// public is set for public videos, which need no authorization
+	public bool
+	// fromSession is set when a session token stood in for a signature
+	fromSession bool
+	// address is the viewer's lowercase address
+	address    string
+	derivedVia string
+	// exp is when the access expires, if known; neither sessions nor links outlive it
+	exp time.Time
+}
+
+// accessError is an authorization failure, sent with HandleErr.
+type accessError struct {
+	status  int
+	message string
+	err     error
+	code    string
+	details interface{}
+	// reason is why the viewer was denied access, as reported by the access-status
+	// endpoint; it is empty when authorization could not be completed
+	reason string
+}
+
+// sendAccessError sends e as the standard error response.
+func (s *Server) sendAccessError(w http.ResponseWriter, e *accessError) {
+	s.HandleErr(w, e.status, e.message, e.err, e.code, e.details)
+}
+
+// authorization is a verified request for access. Verifying a request changes
+// nothing; its challenge and nonces are used up, and the access it was granted is
+// recorded, only when the authorization is committed.
+type authorization struct {
+	access
+	// effects commit the authorization, in order
+	effects []func(ctx context.Context) *accessError
+}
 
+// onCommit adds effect to those run when the authorization is committed.
+func (a *authorization) onCommit(effect func(ctx context.Context) *accessError) {
+	a.effects = append(a.effects, effect)
+}
+
+// authorize checks that the authSig of req grants access to the video with req's
+// tokenId, described by videoStore (nil if unknown), and commits the authorization.
+// Every endpoint that releases a video authorizes its requests.
+func (s *Server) authorize(ctx context.Context, req *model.RequestBody, videoStore *model.VideoStore) (*access, *accessError) {
+	a, accessErr := s.verifyAuthorization(ctx, req, videoStore)
+	if accessErr != nil {
+		return nil, accessErr
+	}
+	return s.commitAuthorization(ctx, a)
+}
+
+// commitAuthorization runs the effects of a. Of concurrent requests verified with
+// the same challenge or nonce, only the first to commit succeeds.
+func (s *Server) commitAuthorization(ctx context.Context, a *authorization) (*access, *accessError) {
+	for _, effect := range a.effects {
+		if accessErr := effect(ctx); accessErr != nil {
+			return nil, accessErr
+		}
+	}
+	return &a.access, nil
+}
+
+// verifyAuthorization checks that the authSig of req grants access to the video
+// with req's tokenId, described by videoStore (nil if unknown), without using up
+// its challenge or nonce. Every endpoint runs the same checks: public videos are
+// open to everyone; otherwise the viewer presents a session, a Privy identity token
+// or a signature, and must have stored access, an access grant, satisfy the video's
+// conditions or have bought it.
+func (s *Server) verifyAuthorization(ctx context.Context, req *model.RequestBody, videoStore *model.VideoStore) (*authorization, *accessError) {
 	authSig := req.AuthSig
 	tokenId := req.TokenId
 	sig := authSig.Sig
@@ -94,91 +261,250 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	authSigAddress := strings.ToLower(authSig.Address)
 
 	log.Printf("AuthSig Address: %s", authSigAddress)
-	videoId := ""
-	visibility := "protected"
 
-	// Initialize Redis client
-	rdb, err := redis.NewClient()
-	if err != nil {
-		HandleErr(w, http.StatusInternalServerError, "Failed to initialize Redis client", err, "INTERNAL_ERROR", nil)
-		return
+	// Handle public videos
+	if videoStore != nil && videoStore.Visibility == "public" {
+		return &authorization{access: access{public: true}}, nil
 	}
 
-	// Initialize database client
-	dbClient, err := db.NewClient()
-	if err != nil {
-		HandleErr(w, http.StatusInternalServerError, "Failed to initialize database client", err, "INTERNAL_ERROR", nil)
-		return
+	// Without credentials the viewer has yet to sign in
+	if sig == "" {
+		return nil, &accessError{http.StatusUnauthorized, "Sign in to watch this video", nil, "AUTH_REQUIRED", nil, model.ReasonNotLoggedIn}
 	}
-	defer dbClient.Close()
 
-	// Check token and get video metadata if tokenId is provided
-	if req.TokenId != "" {
-		videoStore, err := GetVideoMetadata(rdb, dbClient, req.TokenId)
+	// A session token stands in for a signature until it expires
+	if derivedVia == "loop.session" {
+		claims, err := s.verifySession(sig, tokenId, authSigAddress)
 		if err != nil {
-			HandleErr(w, http.StatusInternalServerError, "Error fetching video metadata", err, "INTERNAL_ERROR", nil)
-			return
+			errCode := "UNAUTHORIZED_SESSION"
+			var sessionErr *auth.SessionError
+			if errors.As(err, &sessionErr) {
+				errCode = sessionErr.Code
+			}
+			reason := model.ReasonSignatureInvalid
+			if errCode == auth.SessionCodeExpired {
+				reason = model.ReasonGrantExpired
+			}
+			return nil, &accessError{http.StatusUnauthorized, err.Error(), err, errCode, nil, reason}
 		}
-
-		videoId = videoStore.Id
-		visibility = videoStore.Visibility
+		// Sessions do not outlive the access they were issued for
+		return &authorization{access: access{fromSession: true, address: claims.Subject, derivedVia: derivedVia, exp: time.Unix(claims.ExpiresAt, 0)}}, nil
 	}
 
-	// Handle public videos
-	if visibility == "public" {
-		CreateAndSendPublicSharedLink(w, videoId)
-		return
+	if derivedVia == "privy" {
+		// A Privy identity token stands in for a signature; the viewer is the user's wallet
+		address, err := s.verifyPrivyToken(ctx, sig, authSigAddress)
+		if err != nil {
+			var privyErr *auth.PrivyError
+			switch {
+			case errors.As(err, &privyErr):
+				// An expired identity token means the viewer has been signed out
+				reason := model.ReasonSignatureInvalid
+				if privyErr.Code == auth.PrivyCodeExpired {
+					reason = model.ReasonNotLoggedIn
+				}
+				return nil, &accessError{http.StatusUnauthorized, err.Error(), err, privyErr.Code, nil, reason}
+			case errors.Is(err, db.ErrUserNotFound):
+				return nil, &accessError{http.StatusUnauthorized, "No Loop account for this Privy user", err, "PRIVY_USER_NOT_FOUND", nil, model.ReasonNotLoggedIn}
+			default:
+				return nil, &accessError{http.StatusBadGateway, "Error verifying identity token", err, "INTERNAL_ERROR_PRIVY", nil, ""}
+			}
+		}
+		authSigAddress = address
+	} else {
+		// Verify signature, falling back to EIP-1271 for smart-contract wallets
+		digest, err := s.signedDigest(derivedVia, signedMessage)
+		if err != nil {
+			return nil, &accessError{http.StatusBadRequest, err.Error(), err, "BAD_REQUEST", nil, model.ReasonSignatureInvalid}
+		}
+		validSig, err := s.sigVerifier.VerifyHash(ctx, digest, sig, authSigAddress)
+		if err != nil {
+			return nil, &accessError{http.StatusBadGateway, "Error verifying signature", err, "INTERNAL_ERROR_RPC", nil, ""}
+		}
+		if !validSig {
+			return nil, &accessError{http.StatusUnauthorized, "Unauthorized", nil, "UNAUTHORIZED", nil, model.ReasonSignatureInvalid}
+		}
 	}
 
-	// Verify signature
-	if !auth.VerifySignature(signedMessage, sig, authSigAddress) {
-		HandleErr(w, http.StatusUnauthorized, "Unauthorized", nil, "UNAUTHORIZED", nil)
-		return
+	a := &authorization{access: access{address: authSigAddress, derivedVia: derivedVia}}
+
+	// Require a server-issued challenge nonce bound to this address, video and method
+	if challengeMethods[derivedVia] {
+		err := s.checkChallenge(ctx, a, derivedVia, signedMessage, tokenId, authSigAddress)
+		if errors.Is(err, errChallengeNotIssued) {
+			switch {
+			case clientNonceMethods[derivedVia]:
+				// The nonce is checked with the rest of the message
+				err = nil
+			case legacyNonceMethods[derivedVia] && s.cfg.Challenges.AllowLegacyNonces:
+				// Clients that predate challenges sign nonces of their own
+				err = s.checkLegacyNonce(ctx, a, derivedVia, signedMessage)
+			}
+		}
+		if err != nil {
+			return nil, challengeError(err)
+		}
 	}
 
-	isAuthorized := false
-
 	// Handle different authentication methods
 	switch derivedVia {
 	case "lit.action":
-		if err := handleLitAction(r.Context(), rdb, signedMessage); err != nil {
-			HandleErr(w, http.StatusUnauthorized, err.Error(), err, "UNAUTHORIZED_LIT_ACTION", nil)
-			return
+		// The message is signed by the video's Lit-held key on behalf of the viewer
+		if err := s.handleLitAction(ctx, a, signedMessage, tokenId, authSigAddress, videoStore); err != nil {
+			return nil, litActionError(err)
+		}
+
+	case "eip712":
+		if err := s.handleEIP712(ctx, a, signedMessage, tokenId, authSigAddress); err != nil {
+			return nil, eip712Error(err)
+		}
+		// The typed message proves the caller controls the address;
+		// access itself is granted the same way as for loop.web3.auth.
+		if accessErr := s.checkAccess(ctx, tokenId, authSigAddress, videoStore, a); accessErr != nil {
+			return nil, accessErr
+		}
+
+	case "siwe":
+		if err := s.handleSIWE(ctx, a, signedMessage, tokenId, authSigAddress); err != nil {
+			return nil, siweError(err)
+		}
+		// Likewise, a verified SIWE message proves control of the address
+		if accessErr := s.checkAccess(ctx, tokenId, authSigAddress, videoStore, a); accessErr != nil {
+			return nil, accessErr
 		}
-		isAuthorized = true
-		// videoId is set in handleLitAction
 
-	case "loop.web3.auth":
-		accessKey := fmt.Sprintf("access:%s:%s", tokenId, authSigAddress)
-		val, err := rdb.GetAccess(accessKey)
+	case "loop.web3.auth", "privy":
+		if accessErr := s.checkAccess(ctx, tokenId, authSigAddress, videoStore, a); accessErr != nil {
+			return nil, accessErr
+		}
+
+	default:
+		return nil, &accessError{http.StatusUnauthorized, "Unauthorized", nil, "UNAUTHORIZED", nil, model.ReasonSignatureInvalid}
+	}
+
+	return a, nil
+}
+
+// checkAccess checks that the viewer at address, who has proven control of it, may
+// watch the video with tokenId: they have stored access or an access grant, satisfy
+// the video's conditions or have bought it. It records when the access ends in a.
+func (s *Server) checkAccess(ctx context.Context, tokenId, address string, videoStore *model.VideoStore, a *authorization) *accessError {
+	accessKey := redis.AccessKey(tokenId, address)
+	val, err := s.rdb.GetAccess(accessKey)
+	if err != nil {
+		if err != redisgo.Nil {
+			return &accessError{http.StatusInternalServerError, "Error checking access", err, "INTERNAL_ERROR_REDIS", nil, ""}
+		}
+
+		// Purchases recorded by the indexer outlive their cached access records
+		hasGrant, err := s.checkGrant(ctx, a, tokenId, address)
 		if err != nil {
-			if err == redisgo.Nil {
-				HandleErr(w, http.StatusUnauthorized, "Unauthorized", nil, "UNAUTHORIZED", nil)
+			return &accessError{http.StatusInternalServerError, "Error checking access grants", err, "INTERNAL_ERROR_DB", nil, ""}
+		}
+		if hasGrant {
+			val = "granted"
+		} else {
+			// No stored access; the viewer may satisfy the video's conditions on-chain
+			decision, err := s.evaluateConditions(ctx, a, videoStore, tokenId, address)
+			if err != nil {
+				if errors.Is(err, acl.ErrMalformed) {
+					return &accessError{http.StatusInternalServerError, "Invalid access conditions", err, "INVALID_ACCESS_CONDITIONS", err.Error(), ""}
+				}
+				return &accessError{http.StatusBadGateway, "Error checking access conditions", err, "INTERNAL_ERROR_RPC", nil, ""}
+			}
+			if decision != nil && !decision.Allowed {
+				return &accessError{http.StatusUnauthorized, "Unauthorized", nil, "UNAUTHORIZED", decision.Rules, model.ReasonNotUnlocked}
+			}
+			if decision != nil {
+				val = "conditions"
 			} else {
-				HandleErr(w, http.StatusInternalServerError, "Error checking access", err, "INTERNAL_ERROR_REDIS", nil)
+				// Without evaluable conditions, the viewer may still have bought the video
+				purchased, err := s.checkPurchase(ctx, a, tokenId, address)
+				if err != nil {
+					return &accessError{http.StatusBadGateway, "Error checking purchase", err, "INTERNAL_ERROR_RPC", nil, ""}
+				}
+				if !purchased {
+					return &accessError{http.StatusUnauthorized, "Unauthorized", nil, "UNAUTHORIZED", nil, model.ReasonNotUnlocked}
+				}
+				val = "purchased"
 			}
-			return
 		}
-		log.Printf("Access value: %s\n", val)
-		isAuthorized = true
+	} else {
+		// Stored access, e.g. from a lit.action authorization, ends when its record expires
+		if exp, err := s.rdb.AccessExpiry(accessKey); err != nil {
+			log.Printf("Warning: failed to read access expiry: %v", err)
+		} else {
+			a.exp = exp
+		}
+	}
+	log.Printf("Access value: %s\n", val)
+	return nil
+}
 
+// challengeError returns the error for a challenge or legacy nonce rejected with err.
+func challengeError(err error) *accessError {
+	switch {
+	case errors.Is(err, errMalformedMessage):
+		return &accessError{http.StatusBadRequest, err.Error(), err, "BAD_REQUEST", nil, model.ReasonSignatureInvalid}
+	case errors.Is(err, errMessageExpired):
+		return &accessError{http.StatusUnauthorized, err.Error(), err, "UNAUTHORIZED", nil, model.ReasonGrantExpired}
+	case errors.Is(err, errNonceReused):
+		return &accessError{http.StatusUnauthorized, err.Error(), err, "CHALLENGE_INVALID", nil, model.ReasonNonceReused}
+	case errors.Is(err, errChallengeRedeemed):
+		return &accessError{http.StatusUnauthorized, err.Error(), err, "CHALLENGE_REUSED", nil, model.ReasonNonceReused}
+	case errors.Is(err, errChallengeNotIssued):
+		// Expired challenges are forgotten, so they cannot be told from nonces never issued
+		return &accessError{http.StatusUnauthorized, err.Error(), err, "CHALLENGE_INVALID", nil, model.ReasonGrantExpired}
+	case errors.Is(err, errChallengeMismatch):
+		return &accessError{http.StatusUnauthorized, err.Error(), err, "CHALLENGE_MISMATCH", nil, model.ReasonSignatureInvalid}
 	default:
-		HandleErr(w, http.StatusUnauthorized, "Unauthorized", nil, "UNAUTHORIZED", nil)
-		return
+		return &accessError{http.StatusInternalServerError, "Error redeeming challenge", err, "INTERNAL_ERROR_REDIS", nil, ""}
 	}
+}
 
-	if isAuthorized {
-		CreateAndSendPublicSharedLink(w, videoId)
-		return
+// litActionError returns the error for a lit.action message rejected with err.
+func litActionError(err error) *accessError {
+	return &accessError{http.StatusUnauthorized, err.Error(), err, "UNAUTHORIZED_LIT_ACTION", nil, messageReason(err)}
+}
+
+// eip712Error returns the error for an EIP-712 message rejected with err.
+func eip712Error(err error) *accessError {
+	return &accessError{http.StatusUnauthorized, err.Error(), err, "UNAUTHORIZED_EIP712", nil, messageReason(err)}
+}
+
+// siweError returns the error for a SIWE message rejected with err.
+func siweError(err error) *accessError {
+	errCode := "UNAUTHORIZED_SIWE"
+	var siweErr *auth.SIWEError
+	if errors.As(err, &siweErr) {
+		errCode = siweErr.Code
 	}
+	reason := model.ReasonSignatureInvalid
+	switch errCode {
+	case auth.SIWECodeExpired:
+		reason = model.ReasonGrantExpired
+	case auth.SIWECodeNonceReused:
+		reason = model.ReasonNonceReused
+	}
+	return &accessError{http.StatusUnauthorized, err.Error(), err, errCode, nil, reason}
+}
 
-	HandleErr(w, http.StatusUnauthorized, "Unauthorized", nil, "UNAUTHORIZED", nil)
+// messageReason returns the reason for rejecting a lit.action or EIP-712 message with err.
+func messageReason(err error) string {
+	switch {
+	case errors.Is(err, errMessageExpired):
+		return model.ReasonGrantExpired
+	case errors.Is(err, errNonceReused):
+		return model.ReasonNonceReused
+	default:
+		return model.ReasonSignatureInvalid
+	}
 }
 
 // HandleErr sends a standardized error response to the client.
 // It logs the original error for internal diagnostics and constructs a JSON response
 // conforming to the StandardizedErrorResponse structure.
-func HandleErr(w http.ResponseWriter, httpStatusCode int, publicErrMsg string, internalErr error, errCode string, errDetails interface{}) {
+func (s *Server) HandleErr(w http.ResponseWriter, httpStatusCode int, publicErrMsg string, internalErr error, errCode string, errDetails interface{}) {
 	log.Printf("Error: %s: %v", publicErrMsg, internalErr)
 
 	detail := model.StandardizedErrorDetail{
@@ -187,7 +513,7 @@ func HandleErr(w http.ResponseWriter, httpStatusCode int, publicErrMsg string, i
 		Details: errDetails,
 	}
 
-	if os.Getenv("APP_ENV") != "production" && internalErr != nil {
+	if !s.cfg.Server.IsProduction() && internalErr != nil {
 		detail.Stack = string(debug.Stack())
 	}
 
@@ -205,43 +531,339 @@ func HandleErr(w http.ResponseWriter, httpStatusCode int, publicErrMsg string, i
 	}
 }
 
-// handleLitAction processes authentication via lit.action
-func handleLitAction(ctx context.Context, rdb *redis.Client, signedMessage string) error {
+// handleLitAction processes authentication via lit.action.
+// The message must be signed by the video's Lit-held key, whose address is recorded
+// in the video's PlaybackAccess (videos that record none are accepted only with
+// lit.allowLegacySigners), and must name exactly the requested video.
+// The signature itself has already been verified to recover to authSigAddress.
+// It records the viewer, the message's lowercase userAddress, and when the granted
+// access expires in a; committing a consumes the nonce and stores the access.
+func (s *Server) handleLitAction(ctx context.Context, a *authorization, signedMessage, tokenId, authSigAddress string, videoStore *model.VideoStore) error {
+	if videoStore == nil || videoStore.PlaybackAccess == nil {
+		return fmt.Errorf("video has no lit.action signer")
+	}
+	switch signer := videoStore.PlaybackAccess.SignerAddress; {
+	case signer != "":
+		if !strings.EqualFold(authSigAddress, signer) {
+			return fmt.Errorf("message not signed by the video's signer")
+		}
+	case s.cfg.Lit.AllowLegacySigners:
+		// Videos minted before signers were recorded are checked as they were
+		log.Printf("Warning: accepting lit.action message for token %s, which records no signer", tokenId)
+	default:
+		return fmt.Errorf("video has no lit.action signer")
+	}
+
 	var parsedMessage model.SignedMessage
 	if err := json.Unmarshal([]byte(signedMessage), &parsedMessage); err != nil {
 		return fmt.Errorf("failed to parse signed message: %w", err)
 	}
 
-	log.Printf("Parsed signed message: %+v", parsedMessage)
+	// Every field of the message must match the request
+	if !common.IsHexAddress(parsedMessage.UserAddress) {
+		return fmt.Errorf("invalid userAddress")
+	}
+	if parsedMessage.VideoTokenId != tokenId {
+		return fmt.Errorf("videoTokenId does not match request")
+	}
+	if parsedMessage.VideoId != videoStore.Id {
+		return fmt.Errorf("videoId does not match request")
+	}
+	if parsedMessage.Nonce == "" {
+		return fmt.Errorf("missing nonce")
+	}
 
 	// Convert userAddress to lowercase
 	parsedMessage.UserAddress = strings.ToLower(parsedMessage.UserAddress)
 
 	// Check expiration
 	if time.Now().UnixMilli() > parsedMessage.Exp {
-		return fmt.Errorf("expired")
+		return errMessageExpired
 	}
 
-	// Check nonce
+	// Check nonce; it is consumed when the authorization is committed
 	nonceKey := fmt.Sprintf("nonce:%s", parsedMessage.Nonce)
-	_, err := rdb.Get(ctx, nonceKey).Result()
-	if err == nil {
-		return fmt.Errorf("nonce already used")
-	} else if err != redisgo.Nil {
-		return fmt.Errorf("error checking nonce: %w", err)
+	exp := time.UnixMilli(parsedMessage.Exp)
+	if err := s.useNonce(ctx, a, nonceKey, exp, errNonceReused, litActionError); err != nil {
+		return err
 	}
 
-	// Add nonce to Redis
-	if err := rdb.SetNonce(nonceKey, parsedMessage.Exp); err != nil {
-		return fmt.Errorf("error setting nonce: %w", err)
+	// Add access to Redis
+	accessKey := redis.AccessKey(parsedMessage.VideoTokenId, parsedMessage.UserAddress)
+	a.onCommit(func(ctx context.Context) *accessError {
+		if err := s.rdb.SetAccess(accessKey, parsedMessage.Exp); err != nil {
+			return litActionError(fmt.Errorf("error setting access: %w", err))
+		}
+		return nil
+	})
+
+	a.address = parsedMessage.UserAddress
+	a.exp = exp
+	return nil
+}
+
+// checkGrant reports whether address holds a durable access grant for the video with
+// tokenId on the default chain. If so, committing a re-caches it as an access record.
+func (s *Server) checkGrant(ctx context.Context, a *authorization, tokenId, address string) (bool, error) {
+	if _, ok := new(big.Int).SetString(tokenId, 10); !ok {
+		return false, nil
 	}
 
-	// Add access to Redis
-	accessKey := fmt.Sprintf("access:%s:%s", parsedMessage.VideoTokenId, parsedMessage.UserAddress)
-	if err := rdb.SetAccess(accessKey, parsedMessage.Exp); err != nil {
-		return fmt.Errorf("error setting access: %w", err)
+	granted, err := s.dbClient.HasAccessGrant(ctx, s.cfg.DefaultChain().ID, tokenId, address)
+	if err != nil || !granted {
+		return false, err
+	}
+
+	s.cacheAccess(a, tokenId, address, time.Duration(s.cfg.Purchases.CacheTTL), "access grant")
+	return true, nil
+}
+
+// evaluateConditions evaluates the video's access conditions for address on-chain.
+// Committing a caches a passing decision as an access record. It returns a nil decision when
+// conditions cannot be evaluated here: the video has none, or no chain has RPC providers.
+func (s *Server) evaluateConditions(ctx context.Context, a *authorization, videoStore *model.VideoStore, tokenId, address string) (*acl.Decision, error) {
+	if s.conditions == nil || videoStore == nil || videoStore.PlaybackAccess == nil || videoStore.PlaybackAccess.Conditions == nil {
+		return nil, nil
+	}
+	if !common.IsHexAddress(address) {
+		return &acl.Decision{}, nil
+	}
+
+	decision, err := s.conditions.Evaluate(ctx, videoStore.PlaybackAccess.Conditions, common.HexToAddress(address))
+	if err != nil {
+		return nil, err
+	}
+
+	if decision.Allowed {
+		s.cacheAccess(a, tokenId, address, time.Duration(s.cfg.ACL.CacheTTL), "access decision")
+	}
+
+	return decision, nil
+}
+
+// checkPurchase reports whether address has bought the video with tokenId, as recorded
+// by the PurchaseManager contract. Committing a caches a confirmed purchase as an access
+// record so that later requests do not reach the chain. It returns false when on-chain
+// purchase verification is disabled.
+func (s *Server) checkPurchase(ctx context.Context, a *authorization, tokenId, address string) (bool, error) {
+	if s.purchases == nil {
+		return false, nil
+	}
+
+	id, ok := new(big.Int).SetString(tokenId, 10)
+	if !ok || !common.IsHexAddress(address) {
+		return false, nil
+	}
+
+	purchased, err := s.purchases.HasPurchasedVideo(ctx, id, common.HexToAddress(address))
+	if err != nil {
+		return false, err
+	}
+
+	if purchased {
+		s.cacheAccess(a, tokenId, address, time.Duration(s.cfg.Purchases.CacheTTL), "purchase")
+	}
+
+	return purchased, nil
+}
+
+// cacheAccess caches the access of address to the video with tokenId, found by
+// checking what, as an access record for ttl when a is committed.
+func (s *Server) cacheAccess(a *authorization, tokenId, address string, ttl time.Duration, what string) {
+	a.onCommit(func(ctx context.Context) *accessError {
+		exp := time.Now().Add(ttl).UnixMilli()
+		if err := s.rdb.SetAccess(redis.AccessKey(tokenId, strings.ToLower(address)), exp); err != nil {
+			log.Printf("Warning: failed to cache %s in Redis: %v", what, err)
+		}
+		return nil
+	})
+}
+
+// verifyPrivyToken verifies a Privy identity token and returns the wallet address of
+// its user. If the request names an address, it must be that wallet.
+func (s *Server) verifyPrivyToken(ctx context.Context, token, address string) (string, error) {
+	if s.privy == nil {
+		return "", &auth.PrivyError{Code: auth.PrivyCodeInvalid, Message: "Privy authentication is not enabled"}
+	}
+
+	claims, err := s.privy.Verify(ctx, token, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	walletAddress, err := s.wallets.GetWalletAddressByDID(ctx, claims.Subject)
+	if err != nil {
+		return "", err
+	}
+	if address != "" && address != walletAddress {
+		return "", &auth.PrivyError{Code: auth.PrivyCodeInvalid, Message: "address is not the Privy user's wallet"}
+	}
+	return walletAddress, nil
+}
+
+// verifySession checks that token is a valid session for the video with tokenId.
+// If the request names an address, the session must have been issued to it.
+func (s *Server) verifySession(token, tokenId, address string) (*auth.SessionClaims, error) {
+	if s.sessions == nil {
+		return nil, fmt.Errorf("sessions are not enabled")
+	}
+
+	claims, err := s.sessions.Verify(token, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if (address != "" && claims.Subject != address) || claims.TokenId != tokenId {
+		return nil, &auth.SessionError{Code: auth.SessionCodeMismatch, Message: "session was issued for a different request"}
+	}
+	return claims, nil
+}
+
+// issueSession returns a session token for address and tokenId that expires no later
+// than accessExp, if set. It returns nil when sessions are disabled or cannot be issued,
+// in which case the viewer simply signs again next time.
+func (s *Server) issueSession(address, tokenId, derivedVia string, accessExp time.Time) *model.Session {
+	if s.sessions == nil {
+		return nil
+	}
+
+	token, claims, err := s.sessions.Issue(address, tokenId, derivedVia, time.Now(), accessExp)
+	if err != nil {
+		log.Printf("Warning: failed to issue session: %v", err)
+		return nil
+	}
+	return &model.Session{Token: token, ExpiresAt: claims.ExpiresAt * 1000}
+}
+
+// linkExpiry returns when a link to a video with visibility should stop working for
+// access that ends at accessExp (zero if unknown): at accessExp, but no later than the
+// visibility's maximum link lifetime and no earlier than the minimum lifetime.
+func (s *Server) linkExpiry(visibility string, accessExp time.Time) time.Time {
+	now := time.Now()
+	exp := now.Add(s.cfg.Links.Expiration.ForVisibility(visibility))
+	if !accessExp.IsZero() && accessExp.Before(exp) {
+		exp = accessExp
+	}
+	// Shorter links would expire before the player has loaded the video
+	if floor := now.Add(time.Duration(s.cfg.Links.MinExpiration)); exp.Before(floor) {
+		exp = floor
+	}
+	return exp
+}
+
+// signedDigest returns the 32-byte digest that the authSig signature must sign.
+// EIP-712 authorizations sign the typed-data digest under this deployment's domain;
+// every other method signs the message with the personal_sign prefix.
+func (s *Server) signedDigest(derivedVia, signedMessage string) (common.Hash, error) {
+	if derivedVia != "eip712" {
+		return common.BytesToHash(accounts.TextHash([]byte(signedMessage))), nil
+	}
+
+	if s.cfg.EIP712.VerifyingContract == "" {
+		return common.Hash{}, fmt.Errorf("typed-data authorization is not enabled")
+	}
+
+	msg, err := auth.ParsePlaybackAuthorization(signedMessage)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	return s.eip712Domain().Hash(msg)
+}
+
+// eip712Domain returns the EIP-712 domain of this deployment.
+func (s *Server) eip712Domain() auth.EIP712Domain {
+	return auth.EIP712Domain{
+		Name:              s.cfg.EIP712.Name,
+		Version:           s.cfg.EIP712.Version,
+		ChainID:           s.cfg.EIP712.ChainID,
+		VerifyingContract: s.cfg.EIP712.VerifyingContract,
+	}
+}
+
+// handleEIP712 processes authentication via an EIP-712 PlaybackAuthorization.
+// The signature has already been verified against the typed-data digest; this
+// checks that the message matches the request and that its nonce is unused.
+// Committing a consumes the nonce.
+func (s *Server) handleEIP712(ctx context.Context, a *authorization, signedMessage, tokenId, authSigAddress string) error {
+	msg, err := auth.ParsePlaybackAuthorization(signedMessage)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(msg.UserAddress, authSigAddress) {
+		return fmt.Errorf("userAddress does not match signer")
+	}
+	if msg.VideoTokenId != tokenId {
+		return fmt.Errorf("videoTokenId does not match request")
+	}
+
+	// Check expiration
+	if time.Now().UnixMilli() > msg.Exp {
+		return errMessageExpired
 	}
 
+	// Check nonce
+	nonceKey := fmt.Sprintf("nonce:eip712:%s", msg.Nonce)
+	return s.useNonce(ctx, a, nonceKey, time.UnixMilli(msg.Exp), errNonceReused, eip712Error)
+}
+
+// handleSIWE processes authentication via a Sign-In with Ethereum (EIP-4361) message.
+// The signature has already been verified; this checks the message fields
+// against the service configuration and the request, and that its nonce is unused.
+// Committing a consumes the nonce.
+func (s *Server) handleSIWE(ctx context.Context, a *authorization, signedMessage, tokenId, authSigAddress string) error {
+	msg, err := auth.ParseSIWEMessage(signedMessage)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	siweCfg := s.cfg.SIWE
+	if err := auth.VerifySIWE(msg, auth.SIWEOptions{
+		Domains:   siweCfg.Domains,
+		ChainIDs:  siweCfg.ChainIDs,
+		MaxAge:    time.Duration(siweCfg.MaxAge),
+		ClockSkew: time.Duration(siweCfg.ClockSkew),
+		Address:   authSigAddress,
+		TokenId:   tokenId,
+		Now:       now,
+	}); err != nil {
+		return err
+	}
+
+	// Keep the nonce until the message can no longer be accepted
+	nonceExp := msg.IssuedAt.Add(time.Duration(siweCfg.MaxAge + siweCfg.ClockSkew))
+	if msg.ExpirationTime != nil && msg.ExpirationTime.Before(nonceExp) {
+		nonceExp = msg.ExpirationTime.Add(time.Duration(siweCfg.ClockSkew))
+	}
+
+	nonceKey := fmt.Sprintf("nonce:siwe:%s", msg.Nonce)
+	return s.useNonce(ctx, a, nonceKey, nonceExp, &auth.SIWEError{Code: auth.SIWECodeNonceReused, Message: "nonce already used"}, siweError)
+}
+
+// useNonce checks that the nonce at key is unused, failing with reused if it is not,
+// and consumes it until exp when a is committed. The nonce is consumed in a single
+// atomic operation, so of concurrent requests with the same nonce only one commits;
+// the others fail with fail(reused).
+func (s *Server) useNonce(ctx context.Context, a *authorization, key string, exp time.Time, reused error, fail func(error) *accessError) error {
+	used, err := s.replay.Used(ctx, key)
+	if err != nil {
+		return fmt.Errorf("error checking nonce: %w", err)
+	}
+	if used {
+		return reused
+	}
+
+	a.onCommit(func(ctx context.Context) *accessError {
+		consumed, err := s.replay.Consume(ctx, key, exp)
+		if err != nil {
+			return fail(fmt.Errorf("error consuming nonce: %w", err))
+		}
+		if !consumed {
+			return fail(reused)
+		}
+		return nil
+	})
 	return nil
 }
 
@@ -262,45 +884,43 @@ func SendSuccessResponse(w http.ResponseWriter, statusCode int, dataPayload inte
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		// Log this internal error, as the primary response marshalling failed.
 		// The client will likely receive an incomplete response or timeout.
-		log.Printf("Critical: Failed to encode success response: %v, Payload: %+v", err, dataPayload)
+		// The payload is not logged, as it may carry a session token.
+		log.Printf("Critical: Failed to encode success response: %v, Payload type: %T", err, dataPayload)
 		// Avoid writing further to w as headers might have been sent and it could corrupt the response.
 	}
 }
 
-// CreateAndSendPublicSharedLink generates a public access link for a video using Storj.
-// It retrieves the Storj configuration, constructs the object path, and creates a
-// publicly accessible link for the video content, formatted as a MediaSrc object
-// wrapped in the standard success response.
-func CreateAndSendPublicSharedLink(w http.ResponseWriter, videoId string) {
-	accessGrant, bucket := storj.GetStorjConfig()
-	// The objectPath for Storj link creation should point to the parent "directory"
-	// if the link is intended to allow access to multiple files within it.
-	// If the link should point directly to the HLS manifest, this might need adjustment
-	// based on how Storj sharing and link generation for specific files works.
-	// For now, assuming the current objectPath is for the "data" directory.
-	objectPath := videoId + "/data/"
-
-	baseURL, err := storj.CreatePublicSharedLink(ctx, accessGrant, bucket, objectPath)
+// CreateAndSendPublicSharedLink generates a public access link for a video that
+// stops working at notAfter and sends it as a VideoSource wrapped in the standard
+// success response. Videos in proxy mode are linked through the streaming proxy;
+// others through the configured link provider.
+func (s *Server) CreateAndSendPublicSharedLink(w http.ResponseWriter, tokenId string, videoStore *model.VideoStore, notAfter time.Time, session *model.Session) {
+	link, err := s.videoLink(ctx, tokenId, videoStore, notAfter)
 	if err != nil {
-		HandleErr(w, http.StatusInternalServerError, "Failed to create public shared link", err, "INTERNAL_ERROR", nil)
+		s.HandleErr(w, http.StatusInternalServerError, "Failed to create public shared link", err, "INTERNAL_ERROR", nil)
 		return
 	}
 
-	// Append the HLS specific path. Ensure baseURL doesn't already have a trailing slash if not desired.
-	// Storj's edge.JoinShareURL usually creates clean URLs.
-	// If baseURL is "https://link.storjshare.io/raw/.../BUCKET/video_id/data/"
-	// then finalSrcURL will be "https://link.storjshare.io/raw/.../BUCKET/video_id/data/hls/index.m3u8"
-	finalSrcURL := baseURL
-	if !strings.HasSuffix(finalSrcURL, "/") {
-		finalSrcURL += "/"
-	}
-	finalSrcURL += "hls/index.m3u8"
-
 	mediaSrc := model.VideoSource{
-		Src:  finalSrcURL,
-		Type: "application/x-mpegurl",
+		Src:       link.Src,
+		Type:      link.Type,
+		ExpiresAt: link.NotAfter.UnixMilli(),
+		Session:   session,
 	}
 
 	// Send the mediaSrc directly as the data payload
 	SendSuccessResponse(w, http.StatusOK, mediaSrc)
 }
+
+// videoLink returns a link to the video with tokenId that stops working at notAfter.
+func (s *Server) videoLink(ctx context.Context, tokenId string, videoStore *model.VideoStore, notAfter time.Time) (*links.Link, error) {
+	videoId := ""
+	if videoStore != nil {
+		videoId = videoStore.Id
+	}
+
+	if videoStore != nil && videoStore.DeliveryMode == model.DeliveryModeProxy {
+		return s.proxyLink(tokenId, videoId, notAfter)
+	}
+	return s.links.Link(ctx, videoId, notAfter)
+}
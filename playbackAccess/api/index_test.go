@@ -0,0 +1,370 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/loop/playbackAccess/auth"
+	"github.com/loop/playbackAccess/config"
+	"github.com/loop/playbackAccess/db"
+	"github.com/loop/playbackAccess/model"
+)
+
+func TestPlaybackEIP712(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.EIP712.ChainID = 84532
+		cfg.EIP712.VerifyingContract = "0x00000000000000000000000000000000000000aa"
+	})
+	router := NewRouter(s)
+
+	key, _ := crypto.GenerateKey()
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	lowerAddress := strings.ToLower(address.Hex())
+	cacheVideo(t, s, "42", &model.VideoStore{Id: "video-42", Visibility: "protected"})
+	grantAccess(t, s, "42", lowerAddress)
+
+	// signedRequest signs a PlaybackAuthorization for a new challenge, as a wallet would
+	signedRequest := func() model.RequestBody {
+		msg := &auth.PlaybackAuthorization{
+			UserAddress:  address.Hex(),
+			VideoTokenId: "42",
+			Nonce:        issueChallenge(t, router, address.Hex(), "42", "eip712"),
+			Exp:          time.Now().Add(5 * time.Minute).UnixMilli(),
+		}
+		signedMessage, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest, err := s.eip712Domain().Hash(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := crypto.Sign(digest.Bytes(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig[64] += 27
+		return model.RequestBody{AuthSig: model.AuthSig{
+			Sig:           hexutil.Encode(sig),
+			DerivedVia:    "eip712",
+			SignedMessage: string(signedMessage),
+			Address:       address.Hex(),
+		}}
+	}
+
+	req := signedRequest()
+	w := do(t, router, http.MethodPost, "/v1/videos/42/playback", req, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("playback = %d %s", w.Code, w.Body.String())
+	}
+	var source model.VideoSource
+	decodeData(t, w, &source)
+	if !strings.HasPrefix(source.Src, testMediaURL+"video-42/") {
+		t.Errorf("src = %q, want a link to video-42", source.Src)
+	}
+
+	// The challenge and the message's nonce are single-use
+	w = do(t, router, http.MethodPost, "/v1/videos/42/playback", req, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("replayed playback = %d %s, want 401", w.Code, w.Body.String())
+	}
+
+	// The legacy endpoint accepts the same authorization
+	req = signedRequest()
+	req.TokenId = "42"
+	w = do(t, router, http.MethodPost, "/", req, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("legacy playback = %d %s", w.Code, w.Body.String())
+	}
+	req = signedRequest()
+	req.TokenId = "42"
+	w = do(t, router, http.MethodPost, "/api/", req, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("legacy playback at /api/ = %d %s", w.Code, w.Body.String())
+	}
+
+	// A signature by another key is rejected
+	req = signedRequest()
+	other, _ := crypto.GenerateKey()
+	req.AuthSig.Address = crypto.PubkeyToAddress(other.PublicKey).Hex()
+	w = do(t, router, http.MethodPost, "/v1/videos/42/playback", req, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("playback with another address = %d %s, want 401", w.Code, w.Body.String())
+	}
+}
+
+func TestPlaybackLitActionSession(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Sessions.Keys = []config.SessionKeyConfig{{ID: "test", PrivateKey: base64.StdEncoding.EncodeToString(seed)}}
+	})
+	router := NewRouter(s)
+
+	// The Lit action signs with the video's Lit-held key on behalf of the viewer
+	signer, _ := crypto.GenerateKey()
+	signerAddress := crypto.PubkeyToAddress(signer.PublicKey)
+	viewer, _ := crypto.GenerateKey()
+	viewerAddress := strings.ToLower(crypto.PubkeyToAddress(viewer.PublicKey).Hex())
+	cacheVideo(t, s, "42", &model.VideoStore{Id: "video-42", Visibility: "protected", PlaybackAccess: &model.VideoAccess{
+		ACL:           json.RawMessage(`[{"conditionType":"evmBasic","contractAddress":"","chain":"baseSepolia","parameters":[":currentActionIpfsId"],"returnValueTest":{"comparator":"=","value":"QmPlayback"}}]`),
+		Type:          "lit",
+		SignerAddress: signerAddress.Hex(),
+	}})
+
+	message, _ := json.Marshal(model.SignedMessage{
+		UserAddress:  viewerAddress,
+		VideoId:      "video-42",
+		VideoTokenId: "42",
+		Nonce:        issueChallenge(t, router, viewerAddress, "42", "lit.action"),
+		Exp:          time.Now().Add(5 * time.Minute).UnixMilli(),
+	})
+	sig, err := crypto.Sign(accounts.TextHash(message), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+	req := model.RequestBody{AuthSig: model.AuthSig{
+		Sig:           hexutil.Encode(sig),
+		DerivedVia:    "lit.action",
+		SignedMessage: string(message),
+		Address:       signerAddress.Hex(),
+	}}
+
+	w := do(t, router, http.MethodPost, "/v1/videos/42/playback", req, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("playback = %d %s", w.Code, w.Body.String())
+	}
+	var source model.VideoSource
+	decodeData(t, w, &source)
+	if source.Session == nil {
+		t.Fatal("no session issued")
+	}
+
+	// The session and the stored access belong to the viewer, not the signer
+	claims, err := s.sessions.Verify(source.Session.Token, time.Now())
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if claims.Subject != viewerAddress {
+		t.Errorf("session subject = %s, want the viewer %s", claims.Subject, viewerAddress)
+	}
+	req = model.RequestBody{AuthSig: model.AuthSig{Sig: source.Session.Token, DerivedVia: "loop.session", Address: viewerAddress}}
+	if w := do(t, router, http.MethodPost, "/v1/videos/42/playback", req, nil); w.Code != http.StatusOK {
+		t.Fatalf("playback with the session = %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPlaybackPrivySIWE(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Challenges.AllowLegacyNonces = false
+	})
+	router := NewRouter(s)
+
+	key, _ := crypto.GenerateKey()
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	cacheVideo(t, s, "42", &model.VideoStore{Id: "video-42", Visibility: "protected"})
+	grantAccess(t, s, "42", strings.ToLower(address.Hex()))
+
+	// signedRequest signs a SIWE message as Privy builds it, with Privy's own nonce
+	signedRequest := func(nonce string) model.RequestBody {
+		message := "www.getloop.xyz wants you to sign in with your Ethereum account:\n" +
+			address.Hex() + "\n\n" +
+			"By signing, you are proving you own this wallet and logging in. This does not initiate a transaction or cost any fees.\n\n" +
+			"URI: https://www.getloop.xyz\n" +
+			"Version: 1\n" +
+			"Chain ID: 8453\n" +
+			"Nonce: " + nonce + "\n" +
+			"Issued At: " + time.Now().UTC().Format("2006-01-02T15:04:05.000Z") + "\n" +
+			"Resources:\n" +
+			"- https://privy.io"
+		sig, err := crypto.Sign(accounts.TextHash([]byte(message)), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig[64] += 27
+		return model.RequestBody{AuthSig: model.AuthSig{
+			Sig:           hexutil.Encode(sig),
+			DerivedVia:    "siwe",
+			SignedMessage: message,
+			Address:       address.Hex(),
+		}}
+	}
+
+	req := signedRequest("3c9f1b2e7a6d4c58b0e1f2a3d4c5b6a7")
+	w := do(t, router, http.MethodPost, "/v1/videos/42/playback", req, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("playback = %d %s", w.Code, w.Body.String())
+	}
+	var source model.VideoSource
+	decodeData(t, w, &source)
+	if !strings.HasPrefix(source.Src, testMediaURL+"video-42/") {
+		t.Errorf("src = %q, want a link to video-42", source.Src)
+	}
+
+	// Privy's nonce is accepted once
+	w = do(t, router, http.MethodPost, "/v1/videos/42/playback", req, nil)
+	if w.Code != http.StatusUnauthorized || errorCode(t, w) != auth.SIWECodeNonceReused {
+		t.Fatalf("replayed playback = %d %s, want 401 %s", w.Code, w.Body.String(), auth.SIWECodeNonceReused)
+	}
+
+	// Issued challenges are still bound to their request
+	nonce := issueChallenge(t, router, address.Hex(), "7", "siwe")
+	w = do(t, router, http.MethodPost, "/v1/videos/42/playback", signedRequest(nonce), nil)
+	if w.Code != http.StatusUnauthorized || errorCode(t, w) != "CHALLENGE_MISMATCH" {
+		t.Fatalf("playback with another video's challenge = %d %s, want 401 CHALLENGE_MISMATCH", w.Code, w.Body.String())
+	}
+}
+
+func TestPlaybackLitActionLegacySigner(t *testing.T) {
+	signer, _ := crypto.GenerateKey()
+	signerAddress := crypto.PubkeyToAddress(signer.PublicKey)
+	viewer, _ := crypto.GenerateKey()
+	viewerAddress := strings.ToLower(crypto.PubkeyToAddress(viewer.PublicKey).Hex())
+
+	// playback sends a lit.action message for a video minted before signers were recorded
+	playback := func(t *testing.T, allowLegacySigners bool) *httptest.ResponseRecorder {
+		s := newTestServer(t, func(cfg *config.Config) {
+			cfg.Lit.AllowLegacySigners = allowLegacySigners
+		})
+		router := NewRouter(s)
+		cacheVideo(t, s, "42", &model.VideoStore{Id: "video-42", Visibility: "protected", PlaybackAccess: &model.VideoAccess{
+			ACL:  json.RawMessage(`[{"conditionType":"evmBasic","contractAddress":"","chain":"baseSepolia","parameters":[":currentActionIpfsId"],"returnValueTest":{"comparator":"=","value":"QmPlayback"}}]`),
+			Type: "lit",
+		}})
+
+		message, _ := json.Marshal(model.SignedMessage{
+			UserAddress:  viewerAddress,
+			VideoId:      "video-42",
+			VideoTokenId: "42",
+			Nonce:        issueChallenge(t, router, viewerAddress, "42", "lit.action"),
+			Exp:          time.Now().Add(5 * time.Minute).UnixMilli(),
+		})
+		sig, err := crypto.Sign(accounts.TextHash(message), signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig[64] += 27
+		return do(t, router, http.MethodPost, "/v1/videos/42/playback", model.RequestBody{AuthSig: model.AuthSig{
+			Sig:           hexutil.Encode(sig),
+			DerivedVia:    "lit.action",
+			SignedMessage: string(message),
+			Address:       signerAddress.Hex(),
+		}}, nil)
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		if w := playback(t, true); w.Code != http.StatusOK {
+			t.Fatalf("playback = %d %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("disallowed", func(t *testing.T) {
+		w := playback(t, false)
+		if w.Code != http.StatusUnauthorized || errorCode(t, w) != "UNAUTHORIZED_LIT_ACTION" {
+			t.Fatalf("playback = %d %s, want 401 UNAUTHORIZED_LIT_ACTION", w.Code, w.Body.String())
+		}
+	})
+}
+
+// wallets maps Privy DIDs to wallet addresses.
+type wallets map[string]string
+
+// GetWalletAddressByDID implements walletStore.
+func (w wallets) GetWalletAddressByDID(_ context.Context, did string) (string, error) {
+	address, ok := w[did]
+	if !ok {
+		return "", db.ErrUserNotFound
+	}
+	return address, nil
+}
+
+func TestPlaybackPrivy(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "EC",
+		"crv": "P-256",
+		"kid": "k1",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksPath, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Privy.AppID = "loop-app"
+		cfg.Privy.JWKS = jwksPath
+	})
+	wallet := "0x00000000000000000000000000000000000000a1"
+	s.wallets = wallets{"did:privy:alice": wallet}
+	router := NewRouter(s)
+	cacheVideo(t, s, "42", &model.VideoStore{Id: "video-42", Visibility: "protected"})
+	grantAccess(t, s, "42", wallet)
+
+	// identityToken returns an identity token of the Privy user sub that expires at exp
+	identityToken := func(sub string, exp time.Time) string {
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","typ":"JWT","kid":"k1"}`))
+		claims, err := json.Marshal(map[string]interface{}{"iss": auth.PrivyIssuer, "aud": "loop-app", "sub": sub, "iat": time.Now().Add(-time.Minute).Unix(), "exp": exp.Unix()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+		digest := sha256.Sum256([]byte(signingInput))
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signingInput + "." + base64.RawURLEncoding.EncodeToString(append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...))
+	}
+	valid := identityToken("did:privy:alice", time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name    string
+		token   string
+		address string
+		status  int
+		code    string
+	}{
+		{"wallet", valid, wallet, http.StatusOK, ""},
+		{"wallet in checksum case", valid, "0x00000000000000000000000000000000000000A1", http.StatusOK, ""},
+		{"no address", valid, "", http.StatusOK, ""},
+		{"wallet mismatch", valid, "0x00000000000000000000000000000000000000b2", http.StatusUnauthorized, auth.PrivyCodeInvalid},
+		{"expired", identityToken("did:privy:alice", time.Now().Add(-time.Hour)), wallet, http.StatusUnauthorized, auth.PrivyCodeExpired},
+		{"no Loop account", identityToken("did:privy:bob", time.Now().Add(time.Hour)), "", http.StatusUnauthorized, "PRIVY_USER_NOT_FOUND"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := model.RequestBody{AuthSig: model.AuthSig{Sig: tt.token, DerivedVia: "privy", Address: tt.address}}
+			w := do(t, router, http.MethodPost, "/v1/videos/42/playback", req, nil)
+			if w.Code != tt.status {
+				t.Fatalf("playback = %d %s, want %d", w.Code, w.Body.String(), tt.status)
+			}
+			if tt.code != "" && errorCode(t, w) != tt.code {
+				t.Fatalf("playback = %s, want %s", w.Body.String(), tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loop/playbackAccess/auth"
+	"github.com/loop/playbackAccess/contentkey"
+	"github.com/loop/playbackAccess/db"
+)
+
+// KeyPath is where main mounts the key server.
+const KeyPath = "/v1/keys/"
+
+// maxKeyIdLength is the length of the longest content key ID.
+const maxKeyIdLength = 64
+
+// ContentKey serves the AES-128 key keyId of the video with tokenId at
+// /v1/keys/<tokenId>/<keyId>, the URI of the EXT-X-KEY tags of its encrypted
+// renditions. Keys of protected videos are released only with a playback session
+// for the video, sent as "Authorization: Bearer <token>", or with the key token
+// that playlists served by this service add to the URI, so a copied link to the
+// segments is useless on its own. Requests are rate limited per session, or per
+// client for key tokens and public videos.
+func (s *Server) ContentKey(w http.ResponseWriter, r *http.Request) {
+	tokenId, keyId, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, KeyPath), "/")
+	if !ok || !isTokenId(tokenId) || !isKeyId(keyId) {
+		s.HandleErr(w, http.StatusNotFound, "Not found", nil, "NOT_FOUND", nil)
+		return
+	}
+
+	videoStore, err := GetVideoMetadata(s.rdb, s.dbClient, s.aclChains, tokenId)
+	if err != nil {
+		if errors.Is(err, db.ErrVideoNotFound) {
+			s.HandleErr(w, http.StatusNotFound, "Video not found", err, "VIDEO_NOT_FOUND", nil)
+			return
+		}
+		s.HandleErr(w, http.StatusInternalServerError, "Error fetching video metadata", err, "INTERNAL_ERROR", nil)
+		return
+	}
+
+	limitKey := "key:client:" + clientAddress(r)
+	switch {
+	case videoStore.Visibility == "public":
+		// Keys of public videos are released to anyone
+	case r.URL.Query().Has("sig"):
+		// Key tokens are bound to the video whose playlist carried the URI
+		videoId, err := s.keyURIs.Verify(tokenId, keyId, r.URL.Query(), time.Now())
+		if err != nil {
+			errCode := "KEY_TOKEN_INVALID"
+			if errors.Is(err, contentkey.ErrTokenExpired) {
+				errCode = "KEY_TOKEN_EXPIRED"
+			}
+			s.HandleErr(w, http.StatusForbidden, err.Error(), err, errCode, nil)
+			return
+		}
+		if videoId != videoStore.Id {
+			s.HandleErr(w, http.StatusForbidden, "Key token was issued for a different video", nil, "KEY_TOKEN_INVALID", nil)
+			return
+		}
+	default:
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || token == "" {
+			s.HandleErr(w, http.StatusUnauthorized, "Playback session required", nil, "KEY_SESSION_REQUIRED", nil)
+			return
+		}
+		if s.sessions == nil {
+			s.HandleErr(w, http.StatusUnauthorized, "Sessions are not enabled", nil, "UNAUTHORIZED_SESSION", nil)
+			return
+		}
+		claims, err := s.sessions.Verify(token, time.Now())
+		if err != nil {
+			errCode := "UNAUTHORIZED_SESSION"
+			var sessionErr *auth.SessionError
+			if errors.As(err, &sessionErr) {
+				errCode = sessionErr.Code
+			}
+			s.HandleErr(w, http.StatusUnauthorized, err.Error(), err, errCode, nil)
+			return
+		}
+		if claims.TokenId != tokenId {
+			s.HandleErr(w, http.StatusForbidden, "Session was issued for a different video", nil, auth.SessionCodeMismatch, nil)
+			return
+		}
+		limitKey = "key:session:" + claims.ID
+	}
+
+	allowed, retryAfter, err := s.rdb.Allow(r.Context(), limitKey, s.cfg.Keys.RateLimit, time.Duration(s.cfg.Keys.RateWindow))
+	if err != nil {
+		s.HandleErr(w, http.StatusInternalServerError, "Error checking rate limit", err, "INTERNAL_ERROR_REDIS", nil)
+		return
+	}
+	if !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		s.HandleErr(w, http.StatusTooManyRequests, "Too many key requests", nil, "RATE_LIMITED", nil)
+		return
+	}
+
+	wrapped, err := s.dbClient.GetContentKey(r.Context(), tokenId, keyId)
+	if err != nil {
+		if errors.Is(err, db.ErrContentKeyNotFound) {
+			s.HandleErr(w, http.StatusNotFound, "Key not found", err, "KEY_NOT_FOUND", nil)
+			return
+		}
+		s.HandleErr(w, http.StatusInternalServerError, "Error fetching key", err, "INTERNAL_ERROR_DB", nil)
+		return
+	}
+	key, err := contentkey.Unwrap(s.keyMaster, tokenId, keyId, wrapped)
+	if err != nil {
+		s.HandleErr(w, http.StatusInternalServerError, "Error unwrapping key", err, "INTERNAL_ERROR", nil)
+		return
+	}
+
+	// The key must not outlive the session in any cache
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(key)
+}
+
+// isKeyId reports whether s is a valid content key ID: letters, digits, '-' and '_'.
+func isKeyId(s string) bool {
+	if s == "" || len(s) > maxKeyIdLength {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// clientAddress returns the IP address of the client that sent r.
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loop/playbackAccess/config"
+	"github.com/loop/playbackAccess/model"
+)
+
+func TestContentKeyToken(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Keys.MasterKey = base64.StdEncoding.EncodeToString(make([]byte, 32))
+		cfg.Keys.BaseURL = "http://api.test/v1/keys"
+	})
+	router := NewRouter(s)
+	cacheVideo(t, s, "42", &model.VideoStore{Id: "video-42", Visibility: "protected"})
+	cacheVideo(t, s, "43", &model.VideoStore{Id: "video-43", Visibility: "protected"})
+
+	// get requests a key URI of the key server
+	get := func(uri string) (int, string) {
+		t.Helper()
+		w := do(t, router, http.MethodGet, strings.TrimPrefix(uri, "http://api.test"), nil, nil)
+		return w.Code, errorCode(t, w)
+	}
+
+	if code, errCode := get("http://api.test/v1/keys/42/k1"); code != http.StatusUnauthorized || errCode != "KEY_SESSION_REQUIRED" {
+		t.Errorf("key without a session or token = %d %s, want 401 KEY_SESSION_REQUIRED", code, errCode)
+	}
+
+	// A playlist of video-43 cannot carry tokens for the keys of video-42
+	uri, _ := s.keyURIs.Sign("video-43", "http://api.test/v1/keys/42/k1", time.Now().Add(time.Minute))
+	if code, errCode := get(uri); code != http.StatusForbidden || errCode != "KEY_TOKEN_INVALID" {
+		t.Errorf("key with a token of another video = %d %s, want 403 KEY_TOKEN_INVALID", code, errCode)
+	}
+	uri, _ = s.keyURIs.Sign("video-42", "http://api.test/v1/keys/42/k1", time.Now().Add(time.Minute))
+	if code, errCode := get(strings.Replace(uri, "/k1?", "/k2?", 1)); code != http.StatusForbidden || errCode != "KEY_TOKEN_INVALID" {
+		t.Errorf("key with a token of another key = %d %s, want 403 KEY_TOKEN_INVALID", code, errCode)
+	}
+	uri, _ = s.keyURIs.Sign("video-42", "http://api.test/v1/keys/42/k1", time.Now().Add(-time.Second))
+	if code, errCode := get(uri); code != http.StatusForbidden || errCode != "KEY_TOKEN_EXPIRED" {
+		t.Errorf("key with an expired token = %d %s, want 403 KEY_TOKEN_EXPIRED", code, errCode)
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loop/playbackAccess/acl"
+	"github.com/loop/playbackAccess/db"
+	"github.com/loop/playbackAccess/model"
+)
+
+// Metadata handles GET /v1/videos/{tokenId}/metadata. It returns the public
+// description of a video that the embedded player renders before playback,
+// including the ways to unlock a protected video. The response is the same for
+// every viewer, so it may be cached by browsers and CDNs, and is revalidated
+// with its ETag.
+func (s *Server) Metadata(w http.ResponseWriter, r *http.Request) {
+	tokenId := r.PathValue("tokenId")
+	if !isTokenId(tokenId) {
+		s.HandleErr(w, http.StatusNotFound, "Video not found", nil, "VIDEO_NOT_FOUND", nil)
+		return
+	}
+
+	videoStore, err := GetVideoMetadata(s.rdb, s.dbClient, s.aclChains, tokenId)
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrVideoNotFound):
+			s.HandleErr(w, http.StatusNotFound, "Video not found", err, "VIDEO_NOT_FOUND", nil)
+		case errors.Is(err, acl.ErrMalformed):
+			s.HandleErr(w, http.StatusInternalServerError, "Invalid access conditions", err, "INVALID_ACCESS_CONDITIONS", err.Error())
+		default:
+			s.HandleErr(w, http.StatusInternalServerError, "Error fetching video metadata", err, "INTERNAL_ERROR", nil)
+		}
+		return
+	}
+
+	metadata := model.VideoMetadata{
+		Id:            videoStore.Id,
+		TokenId:       tokenId,
+		Title:         videoStore.Title,
+		IsPublic:      videoStore.Visibility == "public",
+		PreviewUrl:    s.mediaURL(videoStore.PreviewUrl),
+		UnlockOptions: []model.UnlockOption{},
+	}
+	if videoStore.CoverImage != nil {
+		metadata.ThumbnailUrl = s.mediaURL(videoStore.CoverImage.Src)
+	}
+	if !metadata.IsPublic {
+		metadata.UnlockOptions = s.unlockOptions(videoStore)
+	}
+
+	payload, err := json.Marshal(metadata)
+	if err != nil {
+		s.HandleErr(w, http.StatusInternalServerError, "Error encoding video metadata", err, "INTERNAL_ERROR", nil)
+		return
+	}
+	sum := sha256.Sum256(payload)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(time.Duration(s.cfg.Metadata.MaxAge).Seconds())))
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	SendSuccessResponse(w, http.StatusOK, metadata)
+}
+
+// unlockOptions returns the ways to unlock a protected video: buying it, if it has
+// a price, and holding any of the tokens its access conditions accept.
+func (s *Server) unlockOptions(videoStore *model.VideoStore) []model.UnlockOption {
+	options := []model.UnlockOption{}
+
+	var rules []acl.Rule
+	if videoStore.PlaybackAccess != nil {
+		rules = videoStore.PlaybackAccess.Conditions.Rules()
+	}
+
+	if price := videoStore.Price; price != nil {
+		if amount, ok := new(big.Int).SetString(price.Amount, 10); ok && amount.Sign() > 0 {
+			// Purchases are made on the PurchaseManager the paywall condition names
+			option := model.UnlockOption{
+				Id:       model.UnlockPayment,
+				Type:     model.UnlockPayment,
+				Chain:    s.cfg.Ethereum.Chain,
+				Contract: s.cfg.PurchaseManager(),
+				Price:    price,
+			}
+			for _, rule := range rules {
+				if paywall, ok := rule.(*acl.PaywallRule); ok {
+					option.Chain = paywall.Chain
+					option.Contract = paywall.Contract.Hex()
+					break
+				}
+			}
+			options = append(options, option)
+		}
+	}
+
+	for _, rule := range rules {
+		token, ok := rule.(*acl.TokenRule)
+		if !ok {
+			continue
+		}
+		requirement := &model.TokenRequirement{
+			Standard:   token.Standard,
+			Comparator: token.Threshold.Comparator,
+			Amount:     token.Threshold.Value.String(),
+		}
+		if token.TokenId != nil {
+			requirement.TokenId = token.TokenId.String()
+		}
+		options = append(options, model.UnlockOption{
+			Id:       model.UnlockToken + "-" + strconv.Itoa(len(options)),
+			Type:     model.UnlockToken,
+			Chain:    token.Chain,
+			Contract: token.Contract.Hex(),
+			Token:    requirement,
+		})
+	}
+
+	return options
+}
+
+// mediaURL returns the URL browsers load src from: ipfs:// URIs are served by the
+// IPFS gateway; other URIs are returned as they are.
+func (s *Server) mediaURL(src string) string {
+	if cid, ok := strings.CutPrefix(src, "ipfs://"); ok {
+		return strings.TrimSuffix(s.cfg.Metadata.IPFSGateway, "/") + "/" + cid
+	}
+	return src
+}
+
+// etagMatches reports whether the If-None-Match header value matches etag.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
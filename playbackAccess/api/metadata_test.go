@@ -0,0 +1,100 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/loop/playbackAccess/config"
+	"github.com/loop/playbackAccess/model"
+)
+
+func TestMetadata(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Metadata.IPFSGateway = "https://ipfs.example/ipfs/"
+		cfg.Metadata.MaxAge = config.Duration(5 * time.Minute)
+	})
+	router := NewRouter(s)
+	cacheVideo(t, s, "42", &model.VideoStore{
+		Id:         "video-42",
+		Title:      "Sunrise",
+		Visibility: "protected",
+		Price:      &model.VideoPrice{Amount: "1000", Currency: "USDC"},
+		CoverImage: &model.VideoCoverImage{Src: "ipfs://QmCover"},
+	})
+
+	w := do(t, router, http.MethodGet, "/v1/videos/42/metadata", nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("metadata = %d %s", w.Code, w.Body.String())
+	}
+	var metadata model.VideoMetadata
+	decodeData(t, w, &metadata)
+	if metadata.Id != "video-42" || metadata.TokenId != "42" || metadata.Title != "Sunrise" || metadata.IsPublic {
+		t.Errorf("metadata = %+v", metadata)
+	}
+	if metadata.ThumbnailUrl != "https://ipfs.example/ipfs/QmCover" {
+		t.Errorf("thumbnailUrl = %q, want the cover image through the IPFS gateway", metadata.ThumbnailUrl)
+	}
+	if len(metadata.UnlockOptions) != 1 || metadata.UnlockOptions[0].Type != model.UnlockPayment {
+		t.Errorf("unlockOptions = %+v, want a payment", metadata.UnlockOptions)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=300" {
+		t.Errorf("Cache-Control = %q, want public, max-age=300", got)
+	}
+	etag := w.Header().Get("ETag")
+	if len(etag) < 3 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		t.Fatalf("ETag = %q, want a quoted tag", etag)
+	}
+
+	// Conditional requests are answered against the ETag
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		status      int
+	}{
+		{"same ETag", etag, http.StatusNotModified},
+		{"weak ETag", "W/" + etag, http.StatusNotModified},
+		{"list with the ETag", `"other", ` + etag, http.StatusNotModified},
+		{"any ETag", "*", http.StatusNotModified},
+		{"other ETag", `"other"`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(t, router, http.MethodGet, "/v1/videos/42/metadata", nil, http.Header{"If-None-Match": {tt.ifNoneMatch}})
+			if w.Code != tt.status {
+				t.Fatalf("If-None-Match %s = %d, want %d", tt.ifNoneMatch, w.Code, tt.status)
+			}
+			if tt.status == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("304 with a body: %q", w.Body.String())
+			}
+			if w.Header().Get("ETag") != etag || w.Header().Get("Cache-Control") != "public, max-age=300" {
+				t.Errorf("headers = %v, want the ETag and Cache-Control of the 200", w.Header())
+			}
+		})
+	}
+
+	// Changed metadata gets a new ETag, so cached copies are not revalidated
+	cacheVideo(t, s, "42", &model.VideoStore{Id: "video-42", Title: "Sunset", Visibility: "public"})
+	w = do(t, router, http.MethodGet, "/v1/videos/42/metadata", nil, http.Header{"If-None-Match": {etag}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("metadata after a change = %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("ETag"); got == etag || got == "" {
+		t.Errorf("ETag after a change = %q, want a new one", got)
+	}
+	decodeData(t, w, &metadata)
+	if metadata.Title != "Sunset" || !metadata.IsPublic || len(metadata.UnlockOptions) != 0 {
+		t.Errorf("metadata after a change = %+v", metadata)
+	}
+}
+
+func TestMetadataNotFound(t *testing.T) {
+	router := NewRouter(newTestServer(t, nil))
+	w := do(t, router, http.MethodGet, "/v1/videos/abc/metadata", nil, nil)
+	if w.Code != http.StatusNotFound || errorCode(t, w) != "VIDEO_NOT_FOUND" {
+		t.Fatalf("metadata of a non-numeric token = %d %s, want 404 VIDEO_NOT_FOUND", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Cache-Control") != "" || w.Header().Get("ETag") != "" {
+		t.Errorf("error response has cache headers: %v", w.Header())
+	}
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/loop/playbackAccess/db"
+	"github.com/loop/playbackAccess/links"
+	"github.com/loop/playbackAccess/model"
+)
+
+// ProxyPath is where main mounts the streaming proxy.
+const ProxyPath = "/v1/stream/"
+
+// errProxyToken is returned for proxy tokens that are malformed or not signed by this service.
+var errProxyToken = errors.New("invalid stream token")
+
+// proxyClaims are the claims of a proxy token, which lets its holder stream the
+// objects of one video until ExpiresAt.
+type proxyClaims struct {
+	TokenId   string `json:"tid"`
+	VideoId   string `json:"vid"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// proxyLink returns a link to the HLS manifest of the video with tokenId and videoId
+// through the streaming proxy, valid until notAfter. The token is part of the path,
+// so the relative URIs in the video's playlists carry it too.
+func (s *Server) proxyLink(tokenId, videoId string, notAfter time.Time) (*links.Link, error) {
+	if s.objects == nil {
+		return nil, fmt.Errorf("video %s is in proxy mode, but the streaming proxy is not enabled", videoId)
+	}
+
+	notAfter = notAfter.Truncate(time.Second)
+	payload, err := json.Marshal(proxyClaims{TokenId: tokenId, VideoId: videoId, ExpiresAt: notAfter.Unix()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode stream token: %w", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	token := encoded + "." + base64.RawURLEncoding.EncodeToString(s.proxySignature(encoded))
+
+	return &links.Link{
+		Src:      strings.TrimSuffix(s.cfg.Proxy.BaseURL, "/") + "/" + token + "/hls/index.m3u8",
+		Type:     links.HLSType,
+		NotAfter: notAfter,
+	}, nil
+}
+
+// verifyProxyToken checks the token's signature and returns its claims.
+func (s *Server) verifyProxyToken(token string) (*proxyClaims, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errProxyToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, s.proxySignature(encoded)) {
+		return nil, errProxyToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errProxyToken
+	}
+	var claims proxyClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errProxyToken
+	}
+	return &claims, nil
+}
+
+// proxySignature returns the HMAC of a proxy token's encoded claims.
+func (s *Server) proxySignature(encodedClaims string) []byte {
+	mac := hmac.New(sha256.New, s.proxyKey)
+	mac.Write([]byte("stream\n" + encodedClaims))
+	return mac.Sum(nil)
+}
+
+// Stream serves the objects of videos in proxy mode at /v1/stream/<token>/<path>,
+// where path is relative to the video's data directory, with support for Range
+// and conditional requests. Unlike a shared link, a token is checked against the
+// video's metadata on every request: switching the video out of proxy mode, or
+// unpublishing it, revokes every token as soon as the cached metadata is refreshed.
+func (s *Server) Stream(w http.ResponseWriter, r *http.Request) {
+	token, objectPath, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, ProxyPath), "/")
+	if !ok || objectPath == "" || path.Clean("/"+objectPath) != "/"+objectPath {
+		s.HandleErr(w, http.StatusNotFound, "Not found", nil, "NOT_FOUND", nil)
+		return
+	}
+
+	claims, err := s.verifyProxyToken(token)
+	if err != nil {
+		s.HandleErr(w, http.StatusForbidden, err.Error(), err, "STREAM_TOKEN_INVALID", nil)
+		return
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		s.HandleErr(w, http.StatusForbidden, "Stream token expired", nil, "STREAM_TOKEN_EXPIRED", nil)
+		return
+	}
+
+	videoStore, err := GetVideoMetadata(s.rdb, s.dbClient, s.aclChains, claims.TokenId)
+	if err != nil {
+		if errors.Is(err, db.ErrVideoNotFound) {
+			s.HandleErr(w, http.StatusForbidden, "Stream token revoked", err, "STREAM_TOKEN_REVOKED", nil)
+			return
+		}
+		s.HandleErr(w, http.StatusInternalServerError, "Error fetching video metadata", err, "INTERNAL_ERROR", nil)
+		return
+	}
+	if videoStore.Id != claims.VideoId || videoStore.DeliveryMode != model.DeliveryModeProxy {
+		s.HandleErr(w, http.StatusForbidden, "Stream token revoked", nil, "STREAM_TOKEN_REVOKED", nil)
+		return
+	}
+
+	// Playlists of encrypted videos carry key tokens for the rest of the stream token's life
+	if path.Ext(objectPath) == ".m3u8" && s.keyURIs != nil {
+		links.ServeKeyedPlaylist(w, r, s.objects, claims.VideoId, objectPath, time.Unix(claims.ExpiresAt, 0), s.keyURIs)
+		return
+	}
+	links.ServeObject(w, r, s.objects, claims.VideoId+"/data/"+objectPath)
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loop/playbackAccess/config"
+	"github.com/loop/playbackAccess/links"
+	"github.com/loop/playbackAccess/model"
+	"github.com/loop/playbackAccess/storj"
+)
+
+// memObjects is an in-memory links.ObjectStore of objects by key.
+type memObjects map[string]string
+
+// memObject is an object of memObjects opened for reading.
+type memObject struct {
+	*bytes.Reader
+	info storj.ObjectInfo
+}
+
+func (o memObject) Info() storj.ObjectInfo { return o.info }
+func (o memObject) Close() error           { return nil }
+
+// objectCreated is when every object of memObjects was uploaded.
+var objectCreated = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// Open implements links.ObjectStore.
+func (m memObjects) Open(_ context.Context, key string) (links.Object, error) {
+	data, ok := m[key]
+	if !ok {
+		return nil, storj.ErrObjectNotFound
+	}
+	return memObject{bytes.NewReader([]byte(data)), storj.ObjectInfo{Key: key, Size: int64(len(data)), Created: objectCreated}}, nil
+}
+
+// ReadAll implements links.ObjectStore.
+func (m memObjects) ReadAll(_ context.Context, key string, limit int64) ([]byte, error) {
+	data, ok := m[key]
+	if !ok {
+		return nil, storj.ErrObjectNotFound
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("object %s has %d bytes, more than %d", key, len(data), limit)
+	}
+	return []byte(data), nil
+}
+
+// Close implements links.ObjectStore.
+func (m memObjects) Close() error { return nil }
+
+// newProxyServer returns a test server whose streaming proxy serves objects, with
+// video-42 in proxy mode as token 42.
+func newProxyServer(t *testing.T, objects memObjects) (*Server, http.Handler) {
+	t.Helper()
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Proxy.BaseURL = "http://api.test/v1/stream"
+	})
+	s.objects = objects
+	s.proxyKey = []byte("0123456789abcdef0123456789abcdef")
+	cacheVideo(t, s, "42", &model.VideoStore{Id: "video-42", Visibility: "protected", DeliveryMode: model.DeliveryModeProxy})
+	return s, NewRouter(s)
+}
+
+// streamPath returns the path of objectPath of video-42 through a stream token
+// that expires at notAfter.
+func streamPath(t *testing.T, s *Server, notAfter time.Time, objectPath string) string {
+	t.Helper()
+	link, err := s.proxyLink("42", "video-42", notAfter)
+	if err != nil {
+		t.Fatalf("proxyLink: %v", err)
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(link.Src, "http://api.test"), "hls/index.m3u8") + objectPath
+}
+
+func TestStream(t *testing.T) {
+	segment := "0123456789abcdef"
+	s, router := newProxyServer(t, memObjects{
+		"video-42/data/hls/index.m3u8":   "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\n720p/index.m3u8\n",
+		"video-42/data/hls/720p/seg0.ts": segment,
+	})
+	segmentPath := streamPath(t, s, time.Now().Add(time.Hour), "hls/720p/seg0.ts")
+
+	w := do(t, router, http.MethodGet, segmentPath, nil, nil)
+	if w.Code != http.StatusOK || w.Body.String() != segment {
+		t.Fatalf("segment = %d %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != "video/mp2t" {
+		t.Errorf("Content-Type = %q, want video/mp2t", got)
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+
+	// Range requests get the part they ask for
+	w = do(t, router, http.MethodGet, segmentPath, nil, http.Header{"Range": {"bytes=4-7"}})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "4567" {
+		t.Errorf("range = %d %q, want 206 4567", w.Code, w.Body.String())
+	}
+	if got, want := w.Header().Get("Content-Range"), fmt.Sprintf("bytes 4-7/%d", len(segment)); got != want {
+		t.Errorf("Content-Range = %q, want %q", got, want)
+	}
+	w = do(t, router, http.MethodGet, segmentPath, nil, http.Header{"Range": {"bytes=100-"}})
+	if w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("range past the end = %d, want 416", w.Code)
+	}
+
+	// Conditional requests are answered against the ETag
+	w = do(t, router, http.MethodGet, segmentPath, nil, http.Header{"If-None-Match": {etag}})
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("If-None-Match with the ETag = %d %q, want 304", w.Code, w.Body.String())
+	}
+	w = do(t, router, http.MethodGet, segmentPath, nil, http.Header{"If-None-Match": {`"other"`}})
+	if w.Code != http.StatusOK {
+		t.Errorf("If-None-Match with another ETag = %d, want 200", w.Code)
+	}
+	w = do(t, router, http.MethodGet, segmentPath, nil, http.Header{"Range": {"bytes=4-7"}, "If-Range": {`"other"`}})
+	if w.Code != http.StatusOK || w.Body.String() != segment {
+		t.Errorf("range If-Range another ETag = %d %q, want the whole object", w.Code, w.Body.String())
+	}
+
+	// Playlists are served as they are while the key server is disabled
+	w = do(t, router, http.MethodGet, streamPath(t, s, time.Now().Add(time.Hour), "hls/index.m3u8"), nil, nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "720p/index.m3u8") {
+		t.Errorf("playlist = %d %q", w.Code, w.Body.String())
+	}
+
+	w = do(t, router, http.MethodGet, streamPath(t, s, time.Now().Add(time.Hour), "hls/720p/seg1.ts"), nil, nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing object = %d, want 404", w.Code)
+	}
+}
+
+func TestStreamRejected(t *testing.T) {
+	s, router := newProxyServer(t, memObjects{"video-42/data/hls/720p/seg0.ts": "segment"})
+	valid := streamPath(t, s, time.Now().Add(time.Hour), "hls/720p/seg0.ts")
+	token := strings.Split(strings.TrimPrefix(valid, ProxyPath), "/")[0]
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		code   string
+	}{
+		{"expired", streamPath(t, s, time.Now().Add(-time.Second), "hls/720p/seg0.ts"), http.StatusForbidden, "STREAM_TOKEN_EXPIRED"},
+		{"forged signature", ProxyPath + strings.Split(token, ".")[0] + ".c2ln/hls/720p/seg0.ts", http.StatusForbidden, "STREAM_TOKEN_INVALID"},
+		{"no signature", ProxyPath + strings.Split(token, ".")[0] + "/hls/720p/seg0.ts", http.StatusForbidden, "STREAM_TOKEN_INVALID"},
+		{"no object", ProxyPath + token, http.StatusNotFound, "NOT_FOUND"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(t, router, http.MethodGet, tt.path, nil, nil)
+			if w.Code != tt.status || errorCode(t, w) != tt.code {
+				t.Fatalf("stream = %d %s, want %d %s", w.Code, w.Body.String(), tt.status, tt.code)
+			}
+		})
+	}
+
+	// The router cleans paths before they reach the handler, which checks them too
+	w := do(t, http.HandlerFunc(s.Stream), http.MethodGet, ProxyPath+token+"/hls/../../video-43/data/seg0.ts", nil, nil)
+	if w.Code != http.StatusNotFound || errorCode(t, w) != "NOT_FOUND" {
+		t.Fatalf("stream outside the data directory = %d %s, want 404 NOT_FOUND", w.Code, w.Body.String())
+	}
+}
+
+func TestStreamRevoked(t *testing.T) {
+	tests := []struct {
+		name  string
+		video *model.VideoStore
+	}{
+		{"out of proxy mode", &model.VideoStore{Id: "video-42", Visibility: "protected"}},
+		{"other video", &model.VideoStore{Id: "video-43", Visibility: "protected", DeliveryMode: model.DeliveryModeProxy}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, router := newProxyServer(t, memObjects{"video-42/data/hls/720p/seg0.ts": "segment"})
+			path := streamPath(t, s, time.Now().Add(time.Hour), "hls/720p/seg0.ts")
+			if w := do(t, router, http.MethodGet, path, nil, nil); w.Code != http.StatusOK {
+				t.Fatalf("stream before revocation = %d %s", w.Code, w.Body.String())
+			}
+
+			// Tokens are checked against the video's metadata on every request
+			cacheVideo(t, s, "42", tt.video)
+			w := do(t, router, http.MethodGet, path, nil, nil)
+			if w.Code != http.StatusForbidden || errorCode(t, w) != "STREAM_TOKEN_REVOKED" {
+				t.Fatalf("stream after revocation = %d %s, want 403 STREAM_TOKEN_REVOKED", w.Code, w.Body.String())
+			}
+		})
+	}
+}
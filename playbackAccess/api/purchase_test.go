@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/loop/playbackAccess/contracts"
+	"github.com/loop/playbackAccess/internal/evmtest"
+	"github.com/loop/playbackAccess/redis"
+)
+
+func TestCheckPurchase(t *testing.T) {
+	purchaseManager := common.HexToAddress("0x00000000000000000000000000000000000000b0")
+	buyer := common.HexToAddress("0x00000000000000000000000000000000000000b1")
+	stranger := common.HexToAddress("0x00000000000000000000000000000000000000b2")
+
+	backend := simulated.NewBackend(types.GenesisAlloc{
+		purchaseManager: {
+			Code:    evmtest.PurchaseManager(),
+			Storage: map[common.Hash]common.Hash{evmtest.PurchaseSlot(big.NewInt(42), buyer): evmtest.Purchased},
+			Balance: big.NewInt(0),
+		},
+	})
+	t.Cleanup(func() { backend.Close() })
+
+	s := newTestServer(t, nil)
+	ctx := context.Background()
+
+	// Without a PurchaseManager, nothing counts as purchased
+	if purchased, err := s.checkPurchase(ctx, &authorization{}, "42", buyer.Hex()); err != nil || purchased {
+		t.Fatalf("checkPurchase without a PurchaseManager = %v, %v; want false, nil", purchased, err)
+	}
+
+	s.purchases = contracts.NewPurchaseManager(purchaseManager, backend.Client())
+
+	tests := []struct {
+		name    string
+		tokenId string
+		address string
+		want    bool
+	}{
+		{"buyer", "42", buyer.Hex(), true},
+		{"buyer, other video", "43", buyer.Hex(), false},
+		{"stranger", "42", stranger.Hex(), false},
+		{"invalid address", "42", "0xnotanaddress", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &authorization{}
+			purchased, err := s.checkPurchase(ctx, a, tt.tokenId, tt.address)
+			if err != nil {
+				t.Fatalf("checkPurchase: %v", err)
+			}
+			if purchased != tt.want {
+				t.Fatalf("checkPurchase = %v, want %v", purchased, tt.want)
+			}
+
+			// Purchases are cached as access records once the authorization is committed
+			accessKey := redis.AccessKey(tt.tokenId, strings.ToLower(tt.address))
+			if _, err := s.rdb.GetAccess(accessKey); err == nil {
+				t.Fatal("access cached before commit")
+			}
+			if _, accessErr := s.commitAuthorization(ctx, a); accessErr != nil {
+				t.Fatalf("commitAuthorization: %+v", accessErr)
+			}
+			_, err = s.rdb.GetAccess(accessKey)
+			if cached := err == nil; cached != tt.want {
+				t.Fatalf("access cached = %v, want %v", cached, tt.want)
+			}
+		})
+	}
+}
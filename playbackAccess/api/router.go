@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+)
+
+// Router routes requests to the versioned API. Paths that match no route get a
+// 404 and routes requested with another method a 405, both as the standard
+// error response.
+type Router struct {
+	s   *Server
+	mux *http.ServeMux
+}
+
+// NewRouter returns a Router serving the endpoints of s under /v1, and the
+// playback endpoint of players built before the versioned API on POST / and
+// POST /api/.
+// The streaming proxy and key server are routed only when enabled.
+func NewRouter(s *Server) *Router {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/challenges", s.CreateChallenge)
+	mux.HandleFunc("GET /v1/health/chains", s.ChainHealth)
+	mux.HandleFunc("GET /v1/videos/{tokenId}/metadata", s.Metadata)
+	mux.HandleFunc("GET /v1/videos/{tokenId}/access", s.Access)
+	mux.HandleFunc("POST /v1/videos/{tokenId}/playback", s.Playback)
+	mux.HandleFunc("POST /v1/videos/{tokenId}/download", s.Download)
+	if s.objects != nil {
+		mux.HandleFunc("GET "+ProxyPath, s.Stream)
+	}
+	if s.keyMaster != nil {
+		mux.HandleFunc("GET "+KeyPath, s.ContentKey)
+	}
+
+	// Compatibility shim: existing players POST the playback request to the root,
+	// or to /api/ in production
+	mux.HandleFunc("POST /{$}", s.Handler)
+	mux.HandleFunc("POST /api/{$}", s.Handler)
+
+	return &Router{s: s, mux: mux}
+}
+
+// Handle registers handler for pattern, as http.ServeMux does; main uses it for
+// the routes of link providers.
+func (rt *Router) Handle(pattern string, handler http.Handler) {
+	rt.mux.Handle(pattern, handler)
+}
+
+// ServeHTTP dispatches r to the handler of its route.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, pattern := rt.mux.Handler(r); pattern != "" {
+		rt.mux.ServeHTTP(w, r)
+		return
+	}
+
+	// Without a route, the mux answers with a plain-text 404 or 405; keep its
+	// status and Allow header, and send the standard error response instead
+	unrouted := &unroutedResponse{header: http.Header{}}
+	rt.mux.ServeHTTP(unrouted, r)
+	if unrouted.status == http.StatusMethodNotAllowed {
+		w.Header().Set("Allow", unrouted.header.Get("Allow"))
+		rt.s.HandleErr(w, http.StatusMethodNotAllowed, "Method not allowed", nil, "METHOD_NOT_ALLOWED", nil)
+		return
+	}
+	rt.s.HandleErr(w, http.StatusNotFound, "Not found", nil, "NOT_FOUND", nil)
+}
+
+// unroutedResponse records the status and headers of the mux's response to a
+// request without a route, and discards its body.
+type unroutedResponse struct {
+	header http.Header
+	status int
+}
+
+func (u *unroutedResponse) Header() http.Header { return u.header }
+
+func (u *unroutedResponse) WriteHeader(status int) { u.status = status }
+
+func (u *unroutedResponse) Write(p []byte) (int, error) {
+	if u.status == 0 {
+		u.status = http.StatusOK
+	}
+	return len(p), nil
+}
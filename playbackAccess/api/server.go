@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/loop/playbackAccess/acl"
+	"github.com/loop/playbackAccess/auth"
+	"github.com/loop/playbackAccess/chain"
+	"github.com/loop/playbackAccess/config"
+	"github.com/loop/playbackAccess/contentkey"
+	"github.com/loop/playbackAccess/contracts"
+	"github.com/loop/playbackAccess/db"
+	"github.com/loop/playbackAccess/links"
+	"github.com/loop/playbackAccess/redis"
+	"github.com/loop/playbackAccess/storj"
+)
+
+// Server holds the long-lived dependencies shared by every request.
+// A single Server is created at startup so that Redis and PostgreSQL
+// connection pools are reused across requests instead of being rebuilt
+// on every playback check.
+type Server struct {
+	cfg      *config.Config
+	rdb      *redis.Client
+	dbClient *db.Client
+	// replay consumes signed-message nonces
+	replay      redis.ReplayGuard
+	chains      *chain.Registry
+	links       links.LinkProvider
+	downloads   links.Downloader
+	sigVerifier *auth.SignatureVerifier
+	// purchases is nil when on-chain purchase verification is disabled
+	purchases *contracts.PurchaseManager
+	// conditions is nil when access conditions cannot be evaluated on-chain
+	conditions *acl.Evaluator
+	// aclChains are the chains access conditions may refer to
+	aclChains acl.Chains
+	// sessions is nil when session tokens are disabled
+	sessions *auth.Sessions
+	// privy is nil when Privy identity tokens are not accepted
+	privy *auth.PrivyVerifier
+	// wallets looks up the wallets of Privy users
+	wallets walletStore
+	// objects is nil when the streaming proxy is disabled
+	objects links.ObjectStore
+	// proxyKey signs stream tokens
+	proxyKey []byte
+	// keyMaster unwraps content keys; it is nil when the key server is disabled
+	keyMaster []byte
+	// keyURIs signs and verifies the key tokens of key URIs
+	keyURIs *contentkey.URISigner
+}
+
+// walletStore looks up the wallet address of a Privy user by DID; db.Client
+// implements it.
+type walletStore interface {
+	GetWalletAddressByDID(ctx context.Context, did string) (string, error)
+}
+
+// sessionIssuer is the issuer of session tokens.
+const sessionIssuer = "loop-playback"
+
+// NewServer returns a Server that serves requests using the given configuration
+// and clients, and creates playable links with linkProvider and download links with
+// downloader. Videos in proxy mode are streamed from objects, which is nil when the
+// streaming proxy is disabled. Chains without RPC providers are not read; if the
+// default chain has none, only EOA signatures can be verified.
+// The Server takes ownership of the clients; call Close to release them.
+func NewServer(cfg *config.Config, rdb *redis.Client, dbClient *db.Client, chains *chain.Registry, linkProvider links.LinkProvider, downloader links.Downloader, objects *storj.Objects) *Server {
+	s := &Server{
+		cfg:       cfg,
+		rdb:       rdb,
+		dbClient:  dbClient,
+		wallets:   dbClient,
+		replay:    redis.NewReplayGuard(rdb),
+		chains:    chains,
+		links:     linkProvider,
+		downloads: downloader,
+	}
+	if objects != nil {
+		s.objects = links.StorjObjects(objects)
+		// The key has been validated with the configuration
+		s.proxyKey, _ = cfg.Proxy.Key()
+	}
+	if cfg.Keys.MasterKey != "" {
+		// The key has been validated with the configuration
+		s.keyMaster, _ = cfg.Keys.Master()
+		s.keyURIs = links.KeyURISigner(cfg)
+	}
+
+	// Wallet signatures and purchases are read from the default chain
+	var reader auth.ContractReader
+	if defaultChain, ok := chains.Chain(cfg.Ethereum.Chain); ok && defaultChain.HasProviders() {
+		reader = defaultChain
+
+		if purchaseManager := cfg.PurchaseManager(); purchaseManager != "" {
+			s.purchases = contracts.NewPurchaseManager(common.HexToAddress(purchaseManager), defaultChain)
+		}
+	}
+	// Provider pools bound each call, so the verifier needs no timeout of its own
+	s.sigVerifier = auth.NewSignatureVerifier(reader, 0)
+
+	s.aclChains = make(acl.Chains)
+	callers := make(map[string]ethereum.ContractCaller)
+	for _, c := range chains.Chains() {
+		s.aclChains[c.Name] = acl.Chain{ID: c.ID, VideoNFT: c.Contracts.VideoNFT}
+		if c.HasProviders() {
+			callers[c.Name] = c
+		}
+	}
+	if len(callers) > 0 {
+		s.conditions = acl.NewEvaluator(acl.NewRPCReader(callers))
+	}
+
+	if len(cfg.Sessions.Keys) > 0 {
+		keys := make([]auth.SessionKey, 0, len(cfg.Sessions.Keys))
+		for _, k := range cfg.Sessions.Keys {
+			// Keys have been validated with the configuration
+			privateKey, _ := k.Ed25519()
+			keys = append(keys, auth.SessionKey{ID: k.ID, PrivateKey: privateKey})
+		}
+		sessions, err := auth.NewSessions(sessionIssuer, time.Duration(cfg.Sessions.TTL), keys)
+		if err != nil {
+			log.Printf("Warning: session tokens disabled: %v", err)
+		}
+		s.sessions = sessions
+	}
+
+	if cfg.Privy.AppID != "" {
+		s.privy = auth.NewPrivyVerifier(cfg.Privy.AppID, cfg.Privy.JWKSSource(), time.Duration(cfg.Privy.CacheTTL))
+	}
+
+	return s
+}
+
+// Close releases the Redis and database connection pools, the RPC clients and
+// the connections to Storj. It should only be called once in-flight requests have drained.
+func (s *Server) Close() error {
+	s.chains.Close()
+	errs := []error{s.rdb.Close(), s.dbClient.Close()}
+	if s.objects != nil {
+		errs = append(errs, s.objects.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/loop/playbackAccess/chain"
+	"github.com/loop/playbackAccess/config"
+	"github.com/loop/playbackAccess/links"
+	"github.com/loop/playbackAccess/model"
+	"github.com/loop/playbackAccess/redis"
+)
+
+// testMediaURL is the base URL of the local link provider of test servers.
+const testMediaURL = "http://media.test/v1/files/"
+
+// newTestServer returns a Server backed by an in-memory Redis, without a database
+// or RPC providers, that links to videos with the local provider. configure, if
+// not nil, adjusts the default configuration first.
+func newTestServer(t *testing.T, configure func(cfg *config.Config)) *Server {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	rdb, err := redis.NewClient("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rdb.Close() })
+
+	cfg := config.Default()
+	if configure != nil {
+		configure(&cfg)
+	}
+
+	chains, err := chain.NewRegistry(cfg.ChainConfigs(), chain.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(chains.Close)
+
+	local := links.NewLocalProvider(t.TempDir(), testMediaURL)
+	return NewServer(&cfg, rdb, nil, chains, local, local, nil)
+}
+
+// cacheVideo stores videoStore as the cached metadata of the video with tokenId,
+// so that requests for it do not reach the database.
+func cacheVideo(t *testing.T, s *Server, tokenId string, videoStore *model.VideoStore) {
+	t.Helper()
+	if err := s.rdb.SetVideoMetadata(fmt.Sprintf("token:v2:%s", tokenId), videoStore); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// grantAccess stores access to the video with tokenId for address for an hour.
+func grantAccess(t *testing.T, s *Server, tokenId, address string) {
+	t.Helper()
+	if err := s.rdb.SetAccess(redis.AccessKey(tokenId, address), time.Now().Add(time.Hour).UnixMilli()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// do sends a request with a JSON body, if body is not nil, through handler and
+// returns the response.
+func do(t *testing.T, handler http.Handler, method, target string, body interface{}, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, target, &buf)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+// decodeData decodes the data of a success response into out.
+func decodeData(t *testing.T, w *httptest.ResponseRecorder, out interface{}) {
+	t.Helper()
+	var response struct {
+		Success bool            `json:"success"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+	if !response.Success {
+		t.Fatalf("response is not a success: %s", w.Body.String())
+	}
+	if err := json.Unmarshal(response.Data, out); err != nil {
+		t.Fatalf("decoding data %s: %v", response.Data, err)
+	}
+}
+
+// errorCode returns the code of an error response.
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var response model.StandardizedErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+	return response.Error.Code
+}
+
+// issueChallenge requests a challenge nonce for address, tokenId and derivedVia.
+func issueChallenge(t *testing.T, handler http.Handler, address, tokenId, derivedVia string) string {
+	t.Helper()
+	w := do(t, handler, http.MethodPost, "/v1/challenges", model.ChallengeRequestBody{Address: address, TokenId: tokenId, DerivedVia: derivedVia}, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST /v1/challenges = %d %s", w.Code, w.Body.String())
+	}
+	var challenge model.Challenge
+	decodeData(t, w, &challenge)
+	return challenge.Nonce
+}
@@ -0,0 +1,299 @@
+// Package auth provides authentication and signature verification utilities for the playback access API.
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// erc1271MagicValue is returned by isValidSignature(bytes32,bytes) for valid signatures.
+var erc1271MagicValue = [4]byte{0x16, 0x26, 0xba, 0x7e}
+
+// erc6492MagicSuffix terminates ERC-6492 wrapped signatures from undeployed accounts.
+var erc6492MagicSuffix = common.FromHex("0x6492649264926492649264926492649264926492649264926492649264926492")
+
+var erc1271ABI = mustParseABI(`[{
+	"name": "isValidSignature",
+	"type": "function",
+	"stateMutability": "view",
+	"inputs": [{"name": "hash", "type": "bytes32"}, {"name": "signature", "type": "bytes"}],
+	"outputs": [{"name": "magicValue", "type": "bytes4"}]
+}]`)
+
+// erc6492Args describes the payload of an ERC-6492 wrapped signature:
+// abi.encode(address factory, bytes factoryCalldata, bytes signature).
+var erc6492Args = abi.Arguments{
+	{Type: mustNewType("address")},
+	{Type: mustNewType("bytes")},
+	{Type: mustNewType("bytes")},
+}
+
+// ContractReader is the subset of an Ethereum JSON-RPC client used to verify
+// contract wallet signatures. It is satisfied by ethclient.Client and by
+// go-ethereum's simulated backend client.
+type ContractReader interface {
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+	CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+}
+
+// SignatureVerifier verifies personal_sign signatures from both externally owned
+// accounts and smart-contract wallets.
+//
+// EOA signatures are checked with ecrecover. When that fails, the verifier falls back
+// to EIP-1271 by calling isValidSignature(bytes32,bytes) on the claimed address, and
+// unwraps ERC-6492 signatures so that counterfactual (not yet deployed) accounts can
+// be verified by simulating their deployment.
+type SignatureVerifier struct {
+	caller  ContractReader
+	timeout time.Duration
+}
+
+// NewSignatureVerifier returns a SignatureVerifier that reads contract state through caller,
+// bounding each verification by timeout. If caller is nil, only EOA signatures are accepted.
+// Any JSON-RPC client (ethclient.Client) or go-ethereum's simulated backend can be used as caller.
+func NewSignatureVerifier(caller ContractReader, timeout time.Duration) *SignatureVerifier {
+	return &SignatureVerifier{caller: caller, timeout: timeout}
+}
+
+// Verify reports whether sig is a valid personal_sign signature of signedMessage by address.
+// An error is returned only when contract state could not be read; an invalid signature
+// returns false with a nil error.
+func (v *SignatureVerifier) Verify(ctx context.Context, signedMessage, sig, address string) (bool, error) {
+	return v.VerifyHash(ctx, common.BytesToHash(accounts.TextHash([]byte(signedMessage))), sig, address)
+}
+
+// VerifyHash reports whether sig is a valid signature of the 32-byte digest hash by address,
+// such as a personal_sign or EIP-712 digest.
+// An error is returned only when contract state could not be read; an invalid signature
+// returns false with a nil error.
+//
+// Edge Cases:
+//   - Handles signatures with or without 0x prefix
+//   - Handles V value adjustment for EOA signatures
+//   - Signatures that are not 65 bytes long can only be valid for contract wallets
+//   - ERC-6492 signatures for deployed accounts are verified with the inner signature
+func (v *SignatureVerifier) VerifyHash(ctx context.Context, hash common.Hash, sig, address string) (bool, error) {
+	signature, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(sig), "0x"))
+	if err != nil {
+		log.Printf("Failed to decode signature: %v", err)
+		return false, nil
+	}
+	if !common.IsHexAddress(address) {
+		return false, nil
+	}
+	signer := common.HexToAddress(address)
+
+	if !bytes.HasSuffix(signature, erc6492MagicSuffix) && recoversTo(hash, signature, signer) {
+		return true, nil
+	}
+
+	if v.caller == nil {
+		return false, nil
+	}
+
+	if v.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, v.timeout)
+		defer cancel()
+	}
+
+	return v.verifyContractSignature(ctx, signer, hash, signature)
+}
+
+// recoversTo reports whether the 65-byte EOA signature of hash recovers to signer.
+func recoversTo(hash common.Hash, signature []byte, signer common.Address) bool {
+	if len(signature) != 65 {
+		return false
+	}
+
+	sig := make([]byte, 65)
+	copy(sig, signature)
+	if sig[64] == 27 || sig[64] == 28 {
+		sig[64] -= 27
+	}
+
+	pubKey, err := crypto.SigToPub(hash.Bytes(), sig)
+	if err != nil {
+		return false
+	}
+	return crypto.PubkeyToAddress(*pubKey) == signer
+}
+
+// verifyContractSignature checks signature for hash against the EIP-1271 wallet at signer,
+// unwrapping ERC-6492 signatures when present.
+func (v *SignatureVerifier) verifyContractSignature(ctx context.Context, signer common.Address, hash common.Hash, signature []byte) (bool, error) {
+	code, err := v.caller.CodeAt(ctx, signer, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to read code at %s: %w", signer.Hex(), err)
+	}
+
+	if !bytes.HasSuffix(signature, erc6492MagicSuffix) {
+		if len(code) == 0 {
+			// Not a contract, and ecrecover already failed
+			return false, nil
+		}
+		return v.isValidSignature(ctx, signer, hash, signature)
+	}
+
+	values, err := erc6492Args.Unpack(signature[:len(signature)-len(erc6492MagicSuffix)])
+	if err != nil {
+		log.Printf("Failed to decode ERC-6492 signature: %v", err)
+		return false, nil
+	}
+	factory := values[0].(common.Address)
+	factoryCalldata := values[1].([]byte)
+	innerSig := values[2].([]byte)
+
+	// Deployed accounts verify the inner signature directly
+	if len(code) > 0 {
+		return v.isValidSignature(ctx, signer, hash, innerSig)
+	}
+
+	// Undeployed accounts are deployed and queried within a single simulated call
+	callData, err := erc1271ABI.Pack("isValidSignature", hash, innerSig)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode isValidSignature call: %w", err)
+	}
+
+	result, err := v.caller.CallContract(ctx, ethereum.CallMsg{
+		Data: deployAndCallCode(factory, factoryCalldata, signer, callData),
+	}, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to simulate ERC-6492 deployment: %w", err)
+	}
+
+	return isMagicValue(result), nil
+}
+
+// isValidSignature calls isValidSignature(bytes32,bytes) on a deployed contract wallet.
+// A reverting call is treated as an invalid signature.
+func (v *SignatureVerifier) isValidSignature(ctx context.Context, signer common.Address, hash common.Hash, signature []byte) (bool, error) {
+	callData, err := erc1271ABI.Pack("isValidSignature", hash, signature)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode isValidSignature call: %w", err)
+	}
+
+	result, err := v.caller.CallContract(ctx, ethereum.CallMsg{To: &signer, Data: callData}, nil)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, fmt.Errorf("isValidSignature call failed: %w", err)
+		}
+		log.Printf("isValidSignature reverted for %s: %v", signer.Hex(), err)
+		return false, nil
+	}
+
+	return isMagicValue(result), nil
+}
+
+// isMagicValue reports whether an isValidSignature result holds the EIP-1271 magic value.
+func isMagicValue(result []byte) bool {
+	return len(result) >= 32 && bytes.Equal(result[:4], erc1271MagicValue[:])
+}
+
+// deployAndCallCode builds creation code that, when executed by eth_call, calls factory with
+// factoryCalldata to deploy the counterfactual account and then static-calls the account with
+// callData, returning the call's return data. If the call fails the code returns no data.
+//
+// The factory and account call data are appended after the code and copied into memory with
+// CODECOPY. All offsets are pushed as 4-byte immediates so the code length is fixed.
+func deployAndCallCode(factory common.Address, factoryCalldata []byte, account common.Address, callData []byte) []byte {
+	var code []byte
+	op := func(ops ...vm.OpCode) {
+		for _, o := range ops {
+			code = append(code, byte(o))
+		}
+	}
+	push4 := func(n int) {
+		code = append(code, byte(vm.PUSH4))
+		code = binary.BigEndian.AppendUint32(code, uint32(n))
+	}
+	pushAddr := func(addr common.Address) {
+		code = append(code, byte(vm.PUSH20))
+		code = append(code, addr.Bytes()...)
+	}
+
+	// Length of the code below; it must be kept in sync with the instructions
+	const codeLen = 142
+	factoryDataOffset := codeLen
+	callDataOffset := factoryDataOffset + len(factoryCalldata)
+
+	// memory[0:len(factoryCalldata)] = factoryCalldata
+	push4(len(factoryCalldata))
+	push4(factoryDataOffset)
+	push4(0)
+	op(vm.CODECOPY)
+
+	// call(gas, factory, 0, 0, len(factoryCalldata), 0, 0); the result is ignored so that
+	// an account deployed in the meantime is still checked
+	push4(0)
+	push4(0)
+	push4(len(factoryCalldata))
+	push4(0)
+	push4(0)
+	pushAddr(factory)
+	op(vm.GAS, vm.CALL, vm.POP)
+
+	// memory[0:len(callData)] = callData
+	push4(len(callData))
+	push4(callDataOffset)
+	push4(0)
+	op(vm.CODECOPY)
+
+	// staticcall(gas, account, 0, len(callData), 0, 0)
+	push4(0)
+	push4(0)
+	push4(len(callData))
+	push4(0)
+	pushAddr(account)
+	op(vm.GAS, vm.STATICCALL)
+
+	// if the call failed, jump to the empty return, which follows this
+	// PUSH4 (5 bytes), the JUMPI (1 byte) and the success return (7 bytes)
+	op(vm.ISZERO)
+	push4(len(code) + 5 + 1 + 7)
+	op(vm.JUMPI)
+
+	// return returndata
+	op(vm.RETURNDATASIZE, vm.PUSH0, vm.PUSH0, vm.RETURNDATACOPY)
+	op(vm.RETURNDATASIZE, vm.PUSH0, vm.RETURN)
+
+	// failDest: return nothing
+	op(vm.JUMPDEST, vm.PUSH0, vm.PUSH0, vm.RETURN)
+
+	if len(code) != codeLen {
+		panic(fmt.Sprintf("auth: deployAndCallCode length is %d, want %d", len(code), codeLen))
+	}
+
+	code = append(code, factoryCalldata...)
+	return append(code, callData...)
+}
+
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+func mustNewType(t string) abi.Type {
+	typ, err := abi.NewType(t, "", nil)
+	if err != nil {
+		panic(err)
+	}
+	return typ
+}
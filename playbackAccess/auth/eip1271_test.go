@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/loop/playbackAccess/internal/evmtest"
+)
+
+var (
+	walletAddress  = common.HexToAddress("0x00000000000000000000000000000000000a11e7")
+	factoryAddress = common.HexToAddress("0x0000000000000000000000000000000000fac701")
+)
+
+// signHash signs hash with key as a wallet would, with v as 27 or 28.
+func signHash(t *testing.T, key *ecdsa.PrivateKey, hash common.Hash) []byte {
+	t.Helper()
+	sig, err := crypto.Sign(hash.Bytes(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+	return sig
+}
+
+// wrap6492 wraps sig as an ERC-6492 signature deployed by calling factory with factoryCalldata.
+func wrap6492(t *testing.T, factory common.Address, factoryCalldata, sig []byte) []byte {
+	t.Helper()
+	packed, err := erc6492Args.Pack(factory, factoryCalldata, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(packed, erc6492MagicSuffix...)
+}
+
+// newVerifier returns a SignatureVerifier reading a simulated chain on which owner's
+// EIP-1271 wallet is deployed at walletAddress, and its factory at factoryAddress.
+func newVerifier(t *testing.T, owner common.Address) *SignatureVerifier {
+	t.Helper()
+	backend := simulated.NewBackend(types.GenesisAlloc{
+		walletAddress:  {Code: evmtest.Wallet(owner), Balance: big.NewInt(0)},
+		factoryAddress: {Code: evmtest.Factory(evmtest.Deployer(evmtest.Wallet(owner))), Balance: big.NewInt(0)},
+	})
+	t.Cleanup(func() { backend.Close() })
+	return NewSignatureVerifier(backend.Client(), 0)
+}
+
+func TestDeployAndCallCodeLength(t *testing.T) {
+	// The code panics if its instructions and codeLen disagree
+	code := deployAndCallCode(factoryAddress, []byte{1, 2, 3}, walletAddress, []byte{4, 5})
+	if got, want := len(code), 142+3+2; got != want {
+		t.Fatalf("len(code) = %d, want %d", got, want)
+	}
+}
+
+func TestVerifyHash(t *testing.T) {
+	ctx := context.Background()
+	owner, _ := crypto.GenerateKey()
+	ownerAddress := crypto.PubkeyToAddress(owner.PublicKey)
+	stranger, _ := crypto.GenerateKey()
+	verifier := newVerifier(t, ownerAddress)
+
+	hash := common.BytesToHash(accounts.TextHash([]byte("Sign in to Loop")))
+	otherHash := common.BytesToHash(accounts.TextHash([]byte("Something else")))
+
+	salt := common.BigToHash(big.NewInt(7))
+	counterfactual := evmtest.CounterfactualAddress(factoryAddress, salt, evmtest.Deployer(evmtest.Wallet(ownerAddress)))
+
+	tests := []struct {
+		name    string
+		hash    common.Hash
+		sig     []byte
+		address common.Address
+		want    bool
+	}{
+		{"EOA", hash, signHash(t, owner, hash), ownerAddress, true},
+		{"EOA, wrong signer", hash, signHash(t, stranger, hash), ownerAddress, false},
+		{"EOA, other message", otherHash, signHash(t, owner, hash), ownerAddress, false},
+		{"deployed wallet", hash, signHash(t, owner, hash), walletAddress, true},
+		{"deployed wallet, wrong signer", hash, signHash(t, stranger, hash), walletAddress, false},
+		{"deployed wallet, ERC-6492 signature", hash, wrap6492(t, factoryAddress, salt.Bytes(), signHash(t, owner, hash)), walletAddress, true},
+		{"undeployed wallet", hash, wrap6492(t, factoryAddress, salt.Bytes(), signHash(t, owner, hash)), counterfactual, true},
+		{"undeployed wallet, wrong signer", hash, wrap6492(t, factoryAddress, salt.Bytes(), signHash(t, stranger, hash)), counterfactual, false},
+		{"undeployed wallet, other salt", hash, wrap6492(t, factoryAddress, common.BigToHash(big.NewInt(8)).Bytes(), signHash(t, owner, hash)), counterfactual, false},
+		{"undeployed wallet, plain signature", hash, signHash(t, owner, hash), counterfactual, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifier.VerifyHash(ctx, tt.hash, hexutil.Encode(tt.sig), tt.address.Hex())
+			if err != nil {
+				t.Fatalf("VerifyHash: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("VerifyHash = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyHashWithoutCaller(t *testing.T) {
+	owner, _ := crypto.GenerateKey()
+	hash := common.BytesToHash(accounts.TextHash([]byte("Sign in to Loop")))
+	verifier := NewSignatureVerifier(nil, 0)
+
+	valid, err := verifier.VerifyHash(context.Background(), hash, hexutil.Encode(signHash(t, owner, hash)), crypto.PubkeyToAddress(owner.PublicKey).Hex())
+	if err != nil || !valid {
+		t.Fatalf("VerifyHash = %v, %v; want true, nil", valid, err)
+	}
+
+	// Contract wallets cannot be checked without chain access
+	valid, err = verifier.VerifyHash(context.Background(), hash, hexutil.Encode(signHash(t, owner, hash)), walletAddress.Hex())
+	if err != nil || valid {
+		t.Fatalf("VerifyHash = %v, %v; want false, nil", valid, err)
+	}
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// PlaybackAuthorizationType is the EIP-712 primary type signed by viewers
+// to authorize playback of a video.
+const PlaybackAuthorizationType = "PlaybackAuthorization"
+
+// playbackAuthorizationTypes are the EIP-712 type definitions for a PlaybackAuthorization.
+var playbackAuthorizationTypes = apitypes.Types{
+	"EIP712Domain": {
+		{Name: "name", Type: "string"},
+		{Name: "version", Type: "string"},
+		{Name: "chainId", Type: "uint256"},
+		{Name: "verifyingContract", Type: "address"},
+	},
+	PlaybackAuthorizationType: {
+		{Name: "userAddress", Type: "address"},
+		{Name: "videoTokenId", Type: "uint256"},
+		{Name: "nonce", Type: "string"},
+		{Name: "exp", Type: "uint256"},
+	},
+}
+
+// EIP712Domain binds typed-data signatures to a single deployment.
+// VerifyingContract is the VideoNFT contract of that deployment.
+type EIP712Domain struct {
+	Name              string
+	Version           string
+	ChainID           int64
+	VerifyingContract string
+}
+
+// PlaybackAuthorization is the typed message a viewer signs to request playback.
+// Exp is a Unix timestamp in milliseconds, matching model.SignedMessage.
+type PlaybackAuthorization struct {
+	UserAddress  string `json:"userAddress"`
+	VideoTokenId string `json:"videoTokenId"`
+	Nonce        string `json:"nonce"`
+	Exp          int64  `json:"exp"`
+}
+
+// ParsePlaybackAuthorization decodes a PlaybackAuthorization from the JSON sent as
+// the signed message. Unknown fields are rejected so that the message the server
+// hashes is exactly the message the wallet displayed.
+func ParsePlaybackAuthorization(signedMessage string) (*PlaybackAuthorization, error) {
+	var msg PlaybackAuthorization
+	dec := json.NewDecoder(strings.NewReader(signedMessage))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&msg); err != nil {
+		return nil, fmt.Errorf("failed to parse playback authorization: %w", err)
+	}
+
+	if !common.IsHexAddress(msg.UserAddress) {
+		return nil, fmt.Errorf("invalid userAddress")
+	}
+	if _, ok := new(big.Int).SetString(msg.VideoTokenId, 10); !ok {
+		return nil, fmt.Errorf("invalid videoTokenId")
+	}
+	if msg.Nonce == "" {
+		return nil, fmt.Errorf("missing nonce")
+	}
+	if msg.Exp <= 0 {
+		return nil, fmt.Errorf("invalid exp")
+	}
+
+	return &msg, nil
+}
+
+// TypedData returns the full EIP-712 typed data for msg under domain, as a wallet
+// would receive it through eth_signTypedData_v4.
+func (d EIP712Domain) TypedData(msg *PlaybackAuthorization) apitypes.TypedData {
+	return apitypes.TypedData{
+		Types:       playbackAuthorizationTypes,
+		PrimaryType: PlaybackAuthorizationType,
+		Domain: apitypes.TypedDataDomain{
+			Name:              d.Name,
+			Version:           d.Version,
+			ChainId:           math.NewHexOrDecimal256(d.ChainID),
+			VerifyingContract: d.VerifyingContract,
+		},
+		Message: apitypes.TypedDataMessage{
+			"userAddress":  msg.UserAddress,
+			"videoTokenId": msg.VideoTokenId,
+			"nonce":        msg.Nonce,
+			"exp":          strconv.FormatInt(msg.Exp, 10),
+		},
+	}
+}
+
+// Hash returns the EIP-712 digest of msg under domain, which is what the wallet signs.
+func (d EIP712Domain) Hash(msg *PlaybackAuthorization) (common.Hash, error) {
+	hash, _, err := apitypes.TypedDataAndHash(d.TypedData(msg))
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to hash playback authorization: %w", err)
+	}
+	return common.BytesToHash(hash), nil
+}
@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Privy error codes.
+const (
+	PrivyCodeMalformed = "PRIVY_TOKEN_MALFORMED"
+	PrivyCodeInvalid   = "PRIVY_TOKEN_INVALID"
+	PrivyCodeExpired   = "PRIVY_TOKEN_EXPIRED"
+)
+
+// PrivyIssuer is the issuer of Privy identity tokens.
+const PrivyIssuer = "privy.io"
+
+// privyAlgorithm is the JWS algorithm of Privy identity tokens.
+const privyAlgorithm = "ES256"
+
+// privyClockSkew is the tolerance applied to token timestamps.
+const privyClockSkew = 30 * time.Second
+
+// jwksMinRefresh is the shortest interval between JWKS loads, so that tokens with made-up
+// key IDs or an unavailable source cannot make the verifier hammer the JWKS endpoint.
+const jwksMinRefresh = time.Minute
+
+// PrivyError describes why a Privy identity token was rejected.
+type PrivyError struct {
+	Code    string
+	Message string
+}
+
+// Error implements the error interface.
+func (e *PrivyError) Error() string {
+	return e.Message
+}
+
+func privyErrorf(code, format string, args ...interface{}) *PrivyError {
+	return &PrivyError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// PrivyClaims are the claims of a Privy identity token used by this service.
+type PrivyClaims struct {
+	Issuer    string `json:"iss"`
+	Audience  string `json:"aud"`
+	Subject   string `json:"sub"` // the user's Privy DID
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// PrivyVerifier verifies Privy identity tokens (ES256 JWTs) against a JWKS,
+// loaded from a file or URL and cached.
+type PrivyVerifier struct {
+	appID    string
+	source   string
+	cacheTTL time.Duration
+	client   *http.Client
+
+	mu       sync.Mutex
+	keys     map[string]*ecdsa.PublicKey
+	loadedAt time.Time
+	retryAt  time.Time
+	loadErr  error
+}
+
+// NewPrivyVerifier returns a verifier of tokens issued to the Privy app appID.
+// source is the path of a JWKS file or an http(s) URL serving one; keys are reloaded
+// after cacheTTL, or earlier when a token names an unknown key.
+func NewPrivyVerifier(appID, source string, cacheTTL time.Duration) *PrivyVerifier {
+	return &PrivyVerifier{
+		appID:    appID,
+		source:   source,
+		cacheTTL: cacheTTL,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Verify checks the token's signature, issuer, audience and lifetime and returns its claims.
+// Invalid tokens are reported as *PrivyError; other errors mean the JWKS could not be loaded.
+func (v *PrivyVerifier) Verify(ctx context.Context, token string, now time.Time) (*PrivyClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, privyErrorf(PrivyCodeMalformed, "identity token must have three parts")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, privyErrorf(PrivyCodeMalformed, "invalid identity token header encoding")
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, privyErrorf(PrivyCodeMalformed, "invalid identity token header")
+	}
+	if header.Algorithm != privyAlgorithm {
+		return nil, privyErrorf(PrivyCodeInvalid, "unsupported identity token algorithm %q", header.Algorithm)
+	}
+
+	key, err := v.key(ctx, header.KeyID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(signature) != 64 {
+		return nil, privyErrorf(PrivyCodeMalformed, "invalid identity token signature encoding")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(key, digest[:], r, s) {
+		return nil, privyErrorf(PrivyCodeInvalid, "invalid identity token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, privyErrorf(PrivyCodeMalformed, "invalid identity token payload encoding")
+	}
+	var claims PrivyClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, privyErrorf(PrivyCodeMalformed, "invalid identity token claims")
+	}
+
+	switch {
+	case claims.Issuer != PrivyIssuer:
+		return nil, privyErrorf(PrivyCodeInvalid, "identity token was issued by %q", claims.Issuer)
+	case claims.Audience != v.appID:
+		return nil, privyErrorf(PrivyCodeInvalid, "identity token was issued for another app")
+	case claims.Subject == "":
+		return nil, privyErrorf(PrivyCodeInvalid, "identity token has no subject")
+	case now.Add(-privyClockSkew).Unix() >= claims.ExpiresAt:
+		return nil, privyErrorf(PrivyCodeExpired, "identity token expired")
+	case now.Add(privyClockSkew).Unix() < claims.IssuedAt:
+		return nil, privyErrorf(PrivyCodeInvalid, "identity token issued in the future")
+	}
+
+	return &claims, nil
+}
+
+// key returns the public key with id, loading the JWKS when the cache has expired
+// or does not hold the key. Loads are at least jwksMinRefresh apart.
+func (v *PrivyVerifier) key(ctx context.Context, id string, now time.Time) (*ecdsa.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	key, known := v.keys[id]
+	fresh := v.keys != nil && now.Sub(v.loadedAt) < v.cacheTTL
+	if (known && fresh) || now.Before(v.retryAt) {
+		if known {
+			return key, nil
+		}
+		if v.loadErr != nil {
+			return nil, v.loadErr
+		}
+		return nil, privyErrorf(PrivyCodeInvalid, "unknown identity token key %q", id)
+	}
+
+	keys, err := v.load(ctx)
+	v.retryAt, v.loadErr = now.Add(jwksMinRefresh), err
+	if err != nil {
+		// Keep verifying with the previous keys while the source is unavailable
+		if known {
+			return key, nil
+		}
+		return nil, err
+	}
+	v.keys, v.loadedAt = keys, now
+
+	if key, ok := keys[id]; ok {
+		return key, nil
+	}
+	return nil, privyErrorf(PrivyCodeInvalid, "unknown identity token key %q", id)
+}
+
+// load reads and parses the JWKS from the verifier's source.
+func (v *PrivyVerifier) load(ctx context.Context) (map[string]*ecdsa.PublicKey, error) {
+	var data []byte
+	if strings.HasPrefix(v.source, "http://") || strings.HasPrefix(v.source, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.source, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create JWKS request: %w", err)
+		}
+		resp, err := v.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+		}
+		if data, err = io.ReadAll(io.LimitReader(resp.Body, 1<<20)); err != nil {
+			return nil, fmt.Errorf("failed to read JWKS: %w", err)
+		}
+	} else {
+		var err error
+		if data, err = os.ReadFile(v.source); err != nil {
+			return nil, fmt.Errorf("failed to read JWKS: %w", err)
+		}
+	}
+
+	return parseJWKS(data)
+}
+
+// parseJWKS returns the P-256 keys of a JSON Web Key Set by key ID. Other keys are ignored.
+func parseJWKS(data []byte) (map[string]*ecdsa.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			Curve   string `json:"crv"`
+			KeyID   string `json:"kid"`
+			X       string `json:"x"`
+			Y       string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := make(map[string]*ecdsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.KeyType != "EC" || k.Curve != "P-256" {
+			continue
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("failed to parse JWKS: invalid coordinates for key %q", k.KeyID)
+		}
+		// Reject points that are not on the curve
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, fmt.Errorf("failed to parse JWKS: key %q is not on P-256", k.KeyID)
+		}
+		keys[k.KeyID] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS has no P-256 keys")
+	}
+	return keys, nil
+}
@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const privyAppID = "loop-app"
+
+func newPrivyKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// privyJWKS returns a JWKS holding the public keys by key ID.
+func privyJWKS(t *testing.T, keys map[string]*ecdsa.PrivateKey) []byte {
+	t.Helper()
+	type jwk struct {
+		KeyType string `json:"kty"`
+		Curve   string `json:"crv"`
+		KeyID   string `json:"kid"`
+		X       string `json:"x"`
+		Y       string `json:"y"`
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	for id, key := range keys {
+		set.Keys = append(set.Keys, jwk{
+			KeyType: "EC",
+			Curve:   "P-256",
+			KeyID:   id,
+			X:       base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			Y:       base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+		})
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// signPrivyToken returns an ES256 identity token with claims, signed with key and
+// naming kid.
+func signPrivyToken(t *testing.T, key *ecdsa.PrivateKey, kid string, claims interface{}) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": "ES256", "typ": "JWT", "kid": kid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// jwksServer serves a JWKS that can be replaced, counting the requests it serves.
+type jwksServer struct {
+	*httptest.Server
+	requests atomic.Int32
+
+	mu   sync.Mutex
+	jwks []byte
+	down bool
+}
+
+func newJWKSServer(t *testing.T, jwks []byte) *jwksServer {
+	t.Helper()
+	s := &jwksServer{jwks: jwks}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.down {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(s.jwks)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) set(jwks []byte, down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jwks, s.down = jwks, down
+}
+
+func TestPrivyVerify(t *testing.T) {
+	key, otherKey := newPrivyKey(t), newPrivyKey(t)
+	srv := newJWKSServer(t, privyJWKS(t, map[string]*ecdsa.PrivateKey{"k1": key}))
+	now := time.Unix(1_800_000_000, 0)
+
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"iss": PrivyIssuer, "aud": privyAppID, "sub": "did:privy:alice", "iat": now.Unix() - 60, "exp": now.Unix() + 3600}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"valid", signPrivyToken(t, key, "k1", claims(nil)), ""},
+		{"wrong issuer", signPrivyToken(t, key, "k1", claims(map[string]interface{}{"iss": "evil.example"})), PrivyCodeInvalid},
+		{"wrong audience", signPrivyToken(t, key, "k1", claims(map[string]interface{}{"aud": "other-app"})), PrivyCodeInvalid},
+		{"no subject", signPrivyToken(t, key, "k1", claims(map[string]interface{}{"sub": ""})), PrivyCodeInvalid},
+		{"expired", signPrivyToken(t, key, "k1", claims(map[string]interface{}{"exp": now.Unix() - 60})), PrivyCodeExpired},
+		{"expired within the clock skew", signPrivyToken(t, key, "k1", claims(map[string]interface{}{"exp": now.Unix() - 10})), ""},
+		{"issued in the future", signPrivyToken(t, key, "k1", claims(map[string]interface{}{"iat": now.Unix() + 60})), PrivyCodeInvalid},
+		{"unknown kid", signPrivyToken(t, key, "k2", claims(nil)), PrivyCodeInvalid},
+		{"signed with another key", signPrivyToken(t, otherKey, "k1", claims(nil)), PrivyCodeInvalid},
+		{"other algorithm", "eyJhbGciOiJIUzI1NiIsImtpZCI6ImsxIn0." + strings.SplitN(signPrivyToken(t, key, "k1", claims(nil)), ".", 2)[1], PrivyCodeInvalid},
+		{"two parts", "eyJhbGciOiJFUzI1NiJ9.e30", PrivyCodeMalformed},
+		{"invalid header", "bm90IGpzb24.e30.c2ln", PrivyCodeMalformed},
+		{"short signature", strings.SplitN(signPrivyToken(t, key, "k1", claims(nil)), ".", 3)[0] + ".e30.c2ln", PrivyCodeMalformed},
+	}
+	verifier := NewPrivyVerifier(privyAppID, srv.URL, time.Hour)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifier.Verify(context.Background(), tt.token, now)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("Verify = %v, want nil", err)
+				}
+				if got.Subject != "did:privy:alice" || got.Audience != privyAppID {
+					t.Fatalf("claims = %+v", got)
+				}
+				return
+			}
+			var privyErr *PrivyError
+			if !errors.As(err, &privyErr) || privyErr.Code != tt.want {
+				t.Fatalf("Verify = %v, want %s", err, tt.want)
+			}
+		})
+	}
+
+	// Tokens naming unknown keys do not make the verifier reload the JWKS every time
+	if n := srv.requests.Load(); n != 1 {
+		t.Errorf("%d JWKS requests, want 1", n)
+	}
+}
+
+func TestPrivyJWKSRefresh(t *testing.T) {
+	key, rotated := newPrivyKey(t), newPrivyKey(t)
+	srv := newJWKSServer(t, privyJWKS(t, map[string]*ecdsa.PrivateKey{"k1": key}))
+	verifier := NewPrivyVerifier(privyAppID, srv.URL, time.Hour)
+	now := time.Unix(1_800_000_000, 0)
+
+	token := func(key *ecdsa.PrivateKey, kid string, now time.Time) string {
+		return signPrivyToken(t, key, kid, map[string]interface{}{"iss": PrivyIssuer, "aud": privyAppID, "sub": "did:privy:alice", "iat": now.Unix(), "exp": now.Unix() + 3600})
+	}
+	verify := func(token string, now time.Time) error {
+		_, err := verifier.Verify(context.Background(), token, now)
+		return err
+	}
+
+	if err := verify(token(key, "k1", now), now); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	// A rotated key is picked up once jwksMinRefresh has passed
+	srv.set(privyJWKS(t, map[string]*ecdsa.PrivateKey{"k1": key, "k2": rotated}), false)
+	if err := verify(token(rotated, "k2", now), now.Add(time.Second)); err == nil {
+		t.Fatal("Verify with a rotated key before jwksMinRefresh = nil, want an unknown key")
+	}
+	later := now.Add(jwksMinRefresh)
+	if err := verify(token(rotated, "k2", later), later); err != nil {
+		t.Fatalf("Verify with a rotated key: %v", err)
+	}
+	if n := srv.requests.Load(); n != 2 {
+		t.Errorf("%d JWKS requests, want 2", n)
+	}
+
+	// Known keys keep working while the JWKS cannot be loaded
+	srv.set(nil, true)
+	stale := later.Add(2 * time.Hour)
+	if err := verify(token(key, "k1", stale), stale); err != nil {
+		t.Fatalf("Verify while the JWKS is unavailable: %v", err)
+	}
+	var privyErr *PrivyError
+	if err := verify(token(key, "k3", stale), stale.Add(jwksMinRefresh)); err == nil || errors.As(err, &privyErr) {
+		t.Fatalf("Verify of an unknown key while the JWKS is unavailable = %v, want a load error", err)
+	}
+}
+
+func TestPrivyJWKSFile(t *testing.T) {
+	key := newPrivyKey(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, privyJWKS(t, map[string]*ecdsa.PrivateKey{"k1": key}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1_800_000_000, 0)
+
+	verifier := NewPrivyVerifier(privyAppID, path, time.Hour)
+	token := signPrivyToken(t, key, "k1", map[string]interface{}{"iss": PrivyIssuer, "aud": privyAppID, "sub": "did:privy:alice", "iat": now.Unix(), "exp": now.Unix() + 3600})
+	if _, err := verifier.Verify(context.Background(), token, now); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	for name, data := range map[string]string{
+		"no keys":       `{"keys":[]}`,
+		"not JSON":      `keys`,
+		"off the curve": `{"keys":[{"kty":"EC","crv":"P-256","kid":"k1","x":"` + strings.Repeat("A", 43) + `","y":"` + strings.Repeat("A", 43) + `"}]}`,
+	} {
+		if _, err := parseJWKS([]byte(data)); err == nil {
+			t.Errorf("parseJWKS of a JWKS with %s = nil, want an error", name)
+		}
+	}
+}
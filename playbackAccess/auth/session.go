@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Session error codes.
+const (
+	SessionCodeMalformed = "SESSION_MALFORMED"
+	SessionCodeInvalid   = "SESSION_INVALID"
+	SessionCodeExpired   = "SESSION_EXPIRED"
+	SessionCodeMismatch  = "SESSION_MISMATCH"
+)
+
+// sessionAlgorithm is the JWS algorithm of session tokens (RFC 8037).
+const sessionAlgorithm = "EdDSA"
+
+// SessionError describes why a session token was rejected.
+type SessionError struct {
+	Code    string
+	Message string
+}
+
+// Error implements the error interface.
+func (e *SessionError) Error() string {
+	return e.Message
+}
+
+func sessionErrorf(code, format string, args ...interface{}) *SessionError {
+	return &SessionError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// SessionKey is an Ed25519 key that signs session tokens, identified by the
+// "kid" header of the tokens it signs.
+type SessionKey struct {
+	ID         string
+	PrivateKey ed25519.PrivateKey
+}
+
+// SessionClaims are the claims of a session token. A session lets Subject play
+// the video with TokenId until ExpiresAt without signing again.
+type SessionClaims struct {
+	Issuer  string `json:"iss"`
+	Subject string `json:"sub"` // lowercase address
+	TokenId string `json:"tokenId"`
+	// Via is the derivedVia of the authorization that opened the session
+	Via       string `json:"via"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	ID        string `json:"jti"`
+}
+
+// sessionHeader is the protected header of a session token.
+type sessionHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// Sessions issues and verifies session tokens: compact JWS (RFC 7515) signed with Ed25519.
+//
+// The first key signs new tokens and every key verifies them. To rotate keys,
+// put the new key first and keep the old one until the tokens it signed have expired.
+type Sessions struct {
+	issuer string
+	ttl    time.Duration
+	keys   []SessionKey
+}
+
+// NewSessions returns Sessions that issue tokens valid for ttl under issuer.
+// At least one key is required.
+func NewSessions(issuer string, ttl time.Duration, keys []SessionKey) (*Sessions, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no session keys configured")
+	}
+	for _, k := range keys {
+		if len(k.PrivateKey) != ed25519.PrivateKeySize {
+			return nil, fmt.Errorf("session key %q: invalid Ed25519 private key", k.ID)
+		}
+	}
+	return &Sessions{issuer: issuer, ttl: ttl, keys: keys}, nil
+}
+
+// Issue returns a token for address and tokenId, valid from now for the session
+// lifetime or until notAfter, whichever is earlier. A zero notAfter is ignored.
+func (s *Sessions) Issue(address, tokenId, via string, now, notAfter time.Time) (string, *SessionClaims, error) {
+	exp := now.Add(s.ttl)
+	if !notAfter.IsZero() && notAfter.Before(exp) {
+		exp = notAfter
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, fmt.Errorf("failed to generate session ID: %w", err)
+	}
+
+	claims := &SessionClaims{
+		Issuer:    s.issuer,
+		Subject:   strings.ToLower(address),
+		TokenId:   tokenId,
+		Via:       via,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: exp.Unix(),
+		ID:        hex.EncodeToString(id),
+	}
+
+	key := s.keys[0]
+	header, err := json.Marshal(sessionHeader{Algorithm: sessionAlgorithm, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode session header: %w", err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode session claims: %w", err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature := ed25519.Sign(key.PrivateKey, []byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), claims, nil
+}
+
+// Verify checks the token's signature, issuer and expiry and returns its claims.
+// Failures are reported as *SessionError.
+func (s *Sessions) Verify(token string, now time.Time) (*SessionClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, sessionErrorf(SessionCodeMalformed, "session token must have three parts")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, sessionErrorf(SessionCodeMalformed, "invalid session token header encoding")
+	}
+	var header sessionHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, sessionErrorf(SessionCodeMalformed, "invalid session token header")
+	}
+	if header.Algorithm != sessionAlgorithm {
+		return nil, sessionErrorf(SessionCodeInvalid, "unsupported session token algorithm %q", header.Algorithm)
+	}
+
+	var publicKey ed25519.PublicKey
+	for _, k := range s.keys {
+		if k.ID == header.KeyID {
+			publicKey = k.PrivateKey.Public().(ed25519.PublicKey)
+			break
+		}
+	}
+	if publicKey == nil {
+		return nil, sessionErrorf(SessionCodeInvalid, "unknown session key %q", header.KeyID)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, sessionErrorf(SessionCodeMalformed, "invalid session token signature encoding")
+	}
+	if !ed25519.Verify(publicKey, []byte(parts[0]+"."+parts[1]), signature) {
+		return nil, sessionErrorf(SessionCodeInvalid, "invalid session token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, sessionErrorf(SessionCodeMalformed, "invalid session token payload encoding")
+	}
+	var claims SessionClaims
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&claims); err != nil {
+		return nil, sessionErrorf(SessionCodeMalformed, "invalid session token claims")
+	}
+
+	if claims.Issuer != s.issuer {
+		return nil, sessionErrorf(SessionCodeInvalid, "session token was issued by %q", claims.Issuer)
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, sessionErrorf(SessionCodeExpired, "session expired")
+	}
+
+	return &claims, nil
+}
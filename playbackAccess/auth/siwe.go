@@ -0,0 +1,323 @@
+package auth
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SIWE error codes. Each failed check has its own code so clients can tell
+// exactly why a Sign-In with Ethereum message was rejected.
+const (
+	SIWECodeMalformed        = "SIWE_MALFORMED"
+	SIWECodeAddressMismatch  = "SIWE_ADDRESS_MISMATCH"
+	SIWECodeDomainMismatch   = "SIWE_DOMAIN_MISMATCH"
+	SIWECodeURIMismatch      = "SIWE_URI_MISMATCH"
+	SIWECodeVersion          = "SIWE_UNSUPPORTED_VERSION"
+	SIWECodeChainIDMismatch  = "SIWE_CHAIN_ID_MISMATCH"
+	SIWECodeNonceInvalid     = "SIWE_NONCE_INVALID"
+	SIWECodeNonceReused      = "SIWE_NONCE_REUSED"
+	SIWECodeIssuedAtInvalid  = "SIWE_ISSUED_AT_INVALID"
+	SIWECodeExpired          = "SIWE_EXPIRED"
+	SIWECodeNotYetValid      = "SIWE_NOT_YET_VALID"
+	SIWECodeResourceMismatch = "SIWE_RESOURCE_MISMATCH"
+)
+
+const siweHeaderSuffix = " wants you to sign in with your Ethereum account:"
+
+// siweNonce matches the EIP-4361 nonce grammar: at least 8 alphanumeric characters.
+var siweNonce = regexp.MustCompile(`^[A-Za-z0-9]{8,}$`)
+
+// SIWEError describes why a Sign-In with Ethereum message was rejected.
+type SIWEError struct {
+	Code    string
+	Message string
+}
+
+// Error implements the error interface.
+func (e *SIWEError) Error() string {
+	return e.Message
+}
+
+func siweErrorf(code, format string, args ...interface{}) *SIWEError {
+	return &SIWEError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// SIWEMessage is a parsed EIP-4361 Sign-In with Ethereum message.
+type SIWEMessage struct {
+	Scheme         string
+	Domain         string
+	Address        string
+	Statement      string
+	URI            string
+	Version        string
+	ChainID        int64
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime *time.Time
+	NotBefore      *time.Time
+	RequestID      string
+	Resources      []string
+}
+
+// SIWEOptions holds the values a SIWE message is checked against.
+type SIWEOptions struct {
+	// Domains lists the RFC 3986 authorities allowed to request sign-in.
+	Domains []string
+	// ChainIDs lists the EIP-155 chain IDs the message may be bound to.
+	ChainIDs []int64
+	// MaxAge bounds how long ago the message may have been issued.
+	MaxAge time.Duration
+	// ClockSkew is tolerated between the signer's clock and ours.
+	ClockSkew time.Duration
+	// Address is the account that produced the signature.
+	Address string
+	// TokenId is the video being requested.
+	TokenId string
+	// Now is the time the message is checked at.
+	Now time.Time
+}
+
+// ParseSIWEMessage parses an EIP-4361 message.
+//
+// Edge Cases:
+//   - Accepts an optional scheme before the domain
+//   - Accepts messages with or without a statement
+//   - Accepts CRLF line endings
+func ParseSIWEMessage(raw string) (*SIWEMessage, error) {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	next := 0
+	line := func() (string, bool) {
+		if next >= len(lines) {
+			return "", false
+		}
+		l := lines[next]
+		next++
+		return l, true
+	}
+
+	var msg SIWEMessage
+
+	// Header: [scheme "://"] domain " wants you to sign in with your Ethereum account:"
+	header, _ := line()
+	if !strings.HasSuffix(header, siweHeaderSuffix) {
+		return nil, siweErrorf(SIWECodeMalformed, "missing SIWE header")
+	}
+	msg.Domain = strings.TrimSuffix(header, siweHeaderSuffix)
+	if scheme, domain, ok := strings.Cut(msg.Domain, "://"); ok {
+		msg.Scheme, msg.Domain = scheme, domain
+	}
+	if msg.Domain == "" {
+		return nil, siweErrorf(SIWECodeMalformed, "missing domain")
+	}
+
+	address, ok := line()
+	if !ok || !common.IsHexAddress(address) {
+		return nil, siweErrorf(SIWECodeMalformed, "invalid address")
+	}
+	msg.Address = address
+
+	// Blank lines surround the optional statement
+	for next < len(lines) && lines[next] == "" {
+		next++
+	}
+	if next < len(lines) && !strings.HasPrefix(lines[next], "URI: ") {
+		msg.Statement, _ = line()
+		for next < len(lines) && lines[next] == "" {
+			next++
+		}
+	}
+
+	field := func(name string, required bool) (string, error) {
+		prefix := name + ": "
+		if next < len(lines) && strings.HasPrefix(lines[next], prefix) {
+			l, _ := line()
+			return strings.TrimPrefix(l, prefix), nil
+		}
+		if required {
+			return "", siweErrorf(SIWECodeMalformed, "missing %s", name)
+		}
+		return "", nil
+	}
+	timestamp := func(name, value string) (*time.Time, error) {
+		if value == "" {
+			return nil, nil
+		}
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, siweErrorf(SIWECodeMalformed, "invalid %s", name)
+		}
+		return &t, nil
+	}
+
+	var err error
+	if msg.URI, err = field("URI", true); err != nil {
+		return nil, err
+	}
+	if msg.Version, err = field("Version", true); err != nil {
+		return nil, err
+	}
+	chainID, err := field("Chain ID", true)
+	if err != nil {
+		return nil, err
+	}
+	if msg.ChainID, err = strconv.ParseInt(chainID, 10, 64); err != nil {
+		return nil, siweErrorf(SIWECodeMalformed, "invalid Chain ID")
+	}
+	if msg.Nonce, err = field("Nonce", true); err != nil {
+		return nil, err
+	}
+
+	issuedAt, err := field("Issued At", true)
+	if err != nil {
+		return nil, err
+	}
+	issuedAtTime, err := timestamp("Issued At", issuedAt)
+	if err != nil {
+		return nil, err
+	}
+	msg.IssuedAt = *issuedAtTime
+
+	expirationTime, _ := field("Expiration Time", false)
+	if msg.ExpirationTime, err = timestamp("Expiration Time", expirationTime); err != nil {
+		return nil, err
+	}
+	notBefore, _ := field("Not Before", false)
+	if msg.NotBefore, err = timestamp("Not Before", notBefore); err != nil {
+		return nil, err
+	}
+	msg.RequestID, _ = field("Request ID", false)
+
+	if next < len(lines) && lines[next] == "Resources:" {
+		next++
+		for next < len(lines) && strings.HasPrefix(lines[next], "- ") {
+			l, _ := line()
+			msg.Resources = append(msg.Resources, strings.TrimPrefix(l, "- "))
+		}
+	}
+
+	// Only trailing blank lines may follow
+	for ; next < len(lines); next++ {
+		if strings.TrimSpace(lines[next]) != "" {
+			return nil, siweErrorf(SIWECodeMalformed, "unexpected line %q", lines[next])
+		}
+	}
+
+	return &msg, nil
+}
+
+// VerifySIWE checks a parsed SIWE message against opts.
+// It does not check the signature itself; the message must also be verified
+// with SignatureVerifier.Verify, since SIWE messages are signed with personal_sign.
+// Nonce reuse is tracked by the caller.
+//
+// Returns a *SIWEError describing the first failed check, or nil.
+func VerifySIWE(msg *SIWEMessage, opts SIWEOptions) error {
+	if !strings.EqualFold(msg.Address, opts.Address) {
+		return siweErrorf(SIWECodeAddressMismatch, "message address does not match signer")
+	}
+
+	if !containsFold(opts.Domains, msg.Domain) {
+		return siweErrorf(SIWECodeDomainMismatch, "domain %q is not allowed", msg.Domain)
+	}
+
+	// The URI must be absolute and refer to the requesting domain
+	uri, err := url.Parse(msg.URI)
+	if err != nil || !uri.IsAbs() || !strings.EqualFold(uri.Host, msg.Domain) {
+		return siweErrorf(SIWECodeURIMismatch, "URI %q does not match domain %q", msg.URI, msg.Domain)
+	}
+
+	if msg.Version != "1" {
+		return siweErrorf(SIWECodeVersion, "unsupported version %q", msg.Version)
+	}
+
+	chainAllowed := false
+	for _, id := range opts.ChainIDs {
+		if id == msg.ChainID {
+			chainAllowed = true
+			break
+		}
+	}
+	if !chainAllowed {
+		return siweErrorf(SIWECodeChainIDMismatch, "chain ID %d is not allowed", msg.ChainID)
+	}
+
+	if !siweNonce.MatchString(msg.Nonce) {
+		return siweErrorf(SIWECodeNonceInvalid, "nonce must be at least 8 alphanumeric characters")
+	}
+
+	if msg.IssuedAt.After(opts.Now.Add(opts.ClockSkew)) {
+		return siweErrorf(SIWECodeIssuedAtInvalid, "message issued in the future")
+	}
+	if opts.Now.Sub(msg.IssuedAt) > opts.MaxAge+opts.ClockSkew {
+		return siweErrorf(SIWECodeIssuedAtInvalid, "message issued too long ago")
+	}
+
+	if msg.ExpirationTime != nil && !opts.Now.Before(msg.ExpirationTime.Add(opts.ClockSkew)) {
+		return siweErrorf(SIWECodeExpired, "message expired")
+	}
+
+	if msg.NotBefore != nil && opts.Now.Add(opts.ClockSkew).Before(*msg.NotBefore) {
+		return siweErrorf(SIWECodeNotYetValid, "message not yet valid")
+	}
+
+	// If any resource names a video, one of them must name the requested video
+	namesVideo := false
+	for _, resource := range msg.Resources {
+		tokenId, ok := ResourceTokenId(resource)
+		if !ok {
+			continue
+		}
+		if tokenId == opts.TokenId {
+			return nil
+		}
+		namesVideo = true
+	}
+	if namesVideo {
+		return siweErrorf(SIWECodeResourceMismatch, "resources do not include token %s", opts.TokenId)
+	}
+
+	return nil
+}
+
+// ResourceTokenId extracts the video token ID named by a SIWE resource.
+// A resource names a video when its path ends in "/videos/<tokenId>",
+// e.g. "https://loop.example/videos/42" or "loop://videos/42".
+func ResourceTokenId(resource string) (string, bool) {
+	u, err := url.Parse(resource)
+	if err != nil {
+		return "", false
+	}
+
+	path := strings.TrimSuffix(u.Host+u.Path, "/")
+	idx := strings.LastIndex(path, "videos/")
+	if idx < 0 || (idx > 0 && path[idx-1] != '/') {
+		return "", false
+	}
+
+	tokenId := path[idx+len("videos/"):]
+	if tokenId == "" || strings.Contains(tokenId, "/") {
+		return "", false
+	}
+	for _, c := range tokenId {
+		if c < '0' || c > '9' {
+			return "", false
+		}
+	}
+	return tokenId, true
+}
+
+// containsFold reports whether list contains s, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
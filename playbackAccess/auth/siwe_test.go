@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const siweAddress = "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+
+// siweMessage returns a valid message for video 42 on chain 8453 with the fields
+// in overrides replaced; an empty override removes the field.
+func siweMessage(overrides map[string]string) string {
+	fields := []struct{ name, value string }{
+		{"URI", "https://loop.example/videos/42"},
+		{"Version", "1"},
+		{"Chain ID", "8453"},
+		{"Nonce", "abcdef1234"},
+		{"Issued At", "2026-10-17T12:00:00Z"},
+		{"Expiration Time", "2026-10-17T12:10:00Z"},
+		{"Not Before", "2026-10-17T11:59:00Z"},
+	}
+	lines := []string{
+		"loop.example wants you to sign in with your Ethereum account:",
+		siweAddress,
+		"",
+		"Watch video 42",
+		"",
+	}
+	for _, f := range fields {
+		value, ok := overrides[f.name]
+		if !ok {
+			value = f.value
+		}
+		if value != "" {
+			lines = append(lines, f.name+": "+value)
+		}
+	}
+	lines = append(lines, "Resources:", "- https://loop.example/videos/42")
+	return strings.Join(lines, "\n")
+}
+
+func siweOptions() SIWEOptions {
+	return SIWEOptions{
+		Domains:   []string{"loop.example"},
+		ChainIDs:  []int64{8453},
+		MaxAge:    10 * time.Minute,
+		ClockSkew: 30 * time.Second,
+		Address:   siweAddress,
+		TokenId:   "42",
+		Now:       time.Date(2026, 10, 17, 12, 1, 0, 0, time.UTC),
+	}
+}
+
+func TestParseSIWEMessage(t *testing.T) {
+	msg, err := ParseSIWEMessage(siweMessage(nil))
+	if err != nil {
+		t.Fatalf("ParseSIWEMessage: %v", err)
+	}
+	if msg.Domain != "loop.example" || msg.Address != siweAddress || msg.Statement != "Watch video 42" ||
+		msg.URI != "https://loop.example/videos/42" || msg.Version != "1" || msg.ChainID != 8453 || msg.Nonce != "abcdef1234" {
+		t.Errorf("message = %+v", msg)
+	}
+	if !msg.IssuedAt.Equal(time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)) || msg.ExpirationTime == nil || msg.NotBefore == nil {
+		t.Errorf("times = %s, %v, %v", msg.IssuedAt, msg.ExpirationTime, msg.NotBefore)
+	}
+	if len(msg.Resources) != 1 || msg.Resources[0] != "https://loop.example/videos/42" {
+		t.Errorf("resources = %q", msg.Resources)
+	}
+
+	tests := []struct {
+		name string
+		raw  string
+		want func(*SIWEMessage) bool
+	}{
+		{"scheme", "https://" + siweMessage(nil), func(m *SIWEMessage) bool { return m.Scheme == "https" && m.Domain == "loop.example" }},
+		{"CRLF", strings.ReplaceAll(siweMessage(nil), "\n", "\r\n"), func(m *SIWEMessage) bool { return m.Nonce == "abcdef1234" }},
+		{"no statement", strings.Replace(siweMessage(nil), "\nWatch video 42\n", "", 1), func(m *SIWEMessage) bool { return m.Statement == "" && m.URI != "" }},
+		{"no optional fields", siweMessage(map[string]string{"Expiration Time": "", "Not Before": ""}), func(m *SIWEMessage) bool { return m.ExpirationTime == nil && m.NotBefore == nil }},
+		{"trailing blank lines", siweMessage(nil) + "\n\n", func(m *SIWEMessage) bool { return len(m.Resources) == 1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := ParseSIWEMessage(tt.raw)
+			if err != nil {
+				t.Fatalf("ParseSIWEMessage: %v", err)
+			}
+			if !tt.want(msg) {
+				t.Errorf("message = %+v", msg)
+			}
+		})
+	}
+}
+
+func TestParseSIWEMessageMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"empty", ""},
+		{"no header", strings.Replace(siweMessage(nil), " wants you to sign in with your Ethereum account:", "", 1)},
+		{"no domain", strings.Replace(siweMessage(nil), "loop.example wants", " wants", 1)},
+		{"invalid address", strings.Replace(siweMessage(nil), siweAddress, "0x1234", 1)},
+		{"no URI", siweMessage(map[string]string{"URI": ""})},
+		{"no version", siweMessage(map[string]string{"Version": ""})},
+		{"no chain ID", siweMessage(map[string]string{"Chain ID": ""})},
+		{"invalid chain ID", siweMessage(map[string]string{"Chain ID": "base"})},
+		{"no nonce", siweMessage(map[string]string{"Nonce": ""})},
+		{"no issued at", siweMessage(map[string]string{"Issued At": ""})},
+		{"invalid issued at", siweMessage(map[string]string{"Issued At": "yesterday"})},
+		{"invalid expiration time", siweMessage(map[string]string{"Expiration Time": "2026-10-17"})},
+		{"invalid not before", siweMessage(map[string]string{"Not Before": "soon"})},
+		{"unexpected line", siweMessage(nil) + "\nSomething: else"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSIWEMessage(tt.raw)
+			var siweErr *SIWEError
+			if !errors.As(err, &siweErr) || siweErr.Code != SIWECodeMalformed {
+				t.Fatalf("ParseSIWEMessage = %v, want %s", err, SIWECodeMalformed)
+			}
+		})
+	}
+}
+
+func TestVerifySIWE(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides map[string]string
+		options   func(*SIWEOptions)
+		want      string
+	}{
+		{"valid", nil, nil, ""},
+		{"address mismatch", nil, func(o *SIWEOptions) { o.Address = "0x0000000000000000000000000000000000000001" }, SIWECodeAddressMismatch},
+		{"address in another case", nil, func(o *SIWEOptions) { o.Address = strings.ToLower(siweAddress) }, ""},
+		{"domain mismatch", nil, func(o *SIWEOptions) { o.Domains = []string{"other.example"} }, SIWECodeDomainMismatch},
+		{"URI of another domain", map[string]string{"URI": "https://other.example/videos/42"}, nil, SIWECodeURIMismatch},
+		{"relative URI", map[string]string{"URI": "/videos/42"}, nil, SIWECodeURIMismatch},
+		{"unsupported version", map[string]string{"Version": "2"}, nil, SIWECodeVersion},
+		{"chain ID mismatch", map[string]string{"Chain ID": "1"}, nil, SIWECodeChainIDMismatch},
+		{"short nonce", map[string]string{"Nonce": "abc"}, nil, SIWECodeNonceInvalid},
+		{"issued in the future", map[string]string{"Issued At": "2026-10-17T12:02:00Z"}, nil, SIWECodeIssuedAtInvalid},
+		{"issued within the clock skew", map[string]string{"Issued At": "2026-10-17T12:01:20Z"}, nil, ""},
+		{"issued too long ago", map[string]string{"Issued At": "2026-10-17T11:50:00Z", "Not Before": ""}, nil, SIWECodeIssuedAtInvalid},
+		{"expired", map[string]string{"Expiration Time": "2026-10-17T12:00:30Z"}, nil, SIWECodeExpired},
+		{"expired within the clock skew", map[string]string{"Expiration Time": "2026-10-17T12:00:45Z"}, nil, ""},
+		{"not yet valid", map[string]string{"Not Before": "2026-10-17T12:02:00Z"}, nil, SIWECodeNotYetValid},
+		{"not before within the clock skew", map[string]string{"Not Before": "2026-10-17T12:01:20Z"}, nil, ""},
+		{"resource of another video", nil, func(o *SIWEOptions) { o.TokenId = "43" }, SIWECodeResourceMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := ParseSIWEMessage(siweMessage(tt.overrides))
+			if err != nil {
+				t.Fatalf("ParseSIWEMessage: %v", err)
+			}
+			opts := siweOptions()
+			if tt.options != nil {
+				tt.options(&opts)
+			}
+
+			err = VerifySIWE(msg, opts)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("VerifySIWE = %v, want nil", err)
+				}
+				return
+			}
+			var siweErr *SIWEError
+			if !errors.As(err, &siweErr) || siweErr.Code != tt.want {
+				t.Fatalf("VerifySIWE = %v, want %s", err, tt.want)
+			}
+		})
+	}
+
+	// Messages without resources naming a video are good for any video
+	msg, err := ParseSIWEMessage(strings.Replace(siweMessage(nil), "- https://loop.example/videos/42", "- https://privy.io", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := siweOptions()
+	opts.TokenId = "43"
+	if err := VerifySIWE(msg, opts); err != nil {
+		t.Errorf("VerifySIWE without video resources = %v, want nil", err)
+	}
+}
+
+func TestResourceTokenId(t *testing.T) {
+	tests := []struct {
+		resource string
+		want     string
+		ok       bool
+	}{
+		{"https://loop.example/videos/42", "42", true},
+		{"https://loop.example/videos/42/", "42", true},
+		{"loop://videos/42", "42", true},
+		{"https://loop.example/app/videos/7", "7", true},
+		{"https://loop.example/myvideos/42", "", false},
+		{"https://loop.example/videos/42/comments", "", false},
+		{"https://loop.example/videos/abc", "", false},
+		{"https://loop.example/videos/", "", false},
+		{"https://privy.io", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.resource, func(t *testing.T) {
+			got, ok := ResourceTokenId(tt.resource)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("ResourceTokenId(%q) = %q, %v; want %q, %v", tt.resource, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ErrNoProviders is returned for calls on a chain without RPC providers.
+var ErrNoProviders = errors.New("no RPC providers configured")
+
+// Contracts holds the addresses of the Loop contracts on a chain.
+// Addresses that are not deployed on the chain are zero.
+type Contracts struct {
+	VideoNFT        common.Address
+	PurchaseManager common.Address
+	USDC            common.Address
+}
+
+// Chain is a chain the service reads, backed by a pool of RPC providers.
+//
+// Calls are spread over the healthy providers round-robin. A provider that fails a
+// call is skipped for the failure cooldown and the call is retried on the next one;
+// errors that any provider would return, such as reverts, are returned immediately.
+// Chain implements ethereum.ContractCaller and auth.ContractReader.
+type Chain struct {
+	Name      string
+	ID        int64
+	Contracts Contracts
+
+	providers []*provider
+	next      atomic.Uint64
+	opts      Options
+}
+
+// provider is a single RPC endpoint and its health.
+type provider struct {
+	url    string
+	client *ethclient.Client
+
+	mu          sync.Mutex
+	failures    int
+	lastErr     string
+	lastErrAt   time.Time
+	downUntil   time.Time
+	head        uint64
+	latency     time.Duration
+	lastChecked time.Time
+}
+
+// HasProviders reports whether the chain can be read.
+func (c *Chain) HasProviders() bool {
+	return len(c.providers) > 0
+}
+
+// CallContract executes a read-only contract call.
+func (c *Chain) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return do(ctx, c, func(ctx context.Context, client *ethclient.Client) ([]byte, error) {
+		return client.CallContract(ctx, msg, blockNumber)
+	})
+}
+
+// CodeAt returns the contract code at account.
+func (c *Chain) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	return do(ctx, c, func(ctx context.Context, client *ethclient.Client) ([]byte, error) {
+		return client.CodeAt(ctx, account, blockNumber)
+	})
+}
+
+// BlockNumber returns the most recent block number.
+func (c *Chain) BlockNumber(ctx context.Context) (uint64, error) {
+	return do(ctx, c, func(ctx context.Context, client *ethclient.Client) (uint64, error) {
+		return client.BlockNumber(ctx)
+	})
+}
+
+// HeaderByNumber returns the header of block number, or of the latest block if number is nil.
+func (c *Chain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return do(ctx, c, func(ctx context.Context, client *ethclient.Client) (*types.Header, error) {
+		return client.HeaderByNumber(ctx, number)
+	})
+}
+
+// FilterLogs returns the logs matching q.
+func (c *Chain) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return do(ctx, c, func(ctx context.Context, client *ethclient.Client) ([]types.Log, error) {
+		return client.FilterLogs(ctx, q)
+	})
+}
+
+// do runs call on the chain's providers, failing over until one succeeds.
+// Each attempt is bounded by the call timeout.
+func do[T any](ctx context.Context, c *Chain, call func(context.Context, *ethclient.Client) (T, error)) (T, error) {
+	var zero T
+	if len(c.providers) == 0 {
+		return zero, fmt.Errorf("%s: %w", c.Name, ErrNoProviders)
+	}
+
+	var errs []error
+	for _, p := range c.order() {
+		attemptCtx, cancel := context.WithTimeout(ctx, c.opts.CallTimeout)
+		start := time.Now()
+		result, err := call(attemptCtx, p.client)
+		cancel()
+
+		if err == nil {
+			p.succeeded(time.Since(start))
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return zero, err
+		}
+		if !isProviderError(err) {
+			return zero, err
+		}
+
+		p.failed(err, c.opts.FailureCooldown)
+		errs = append(errs, fmt.Errorf("%s: %w", p.url, err))
+	}
+
+	return zero, fmt.Errorf("%s: all RPC providers failed: %w", c.Name, errors.Join(errs...))
+}
+
+// order returns the providers to try: the healthy ones starting at the next in
+// round-robin order, followed by those cooling down after a failure.
+func (c *Chain) order() []*provider {
+	n := len(c.providers)
+	start := int(c.next.Add(1) % uint64(n))
+	now := time.Now()
+
+	healthy := make([]*provider, 0, n)
+	var cooling []*provider
+	for i := 0; i < n; i++ {
+		p := c.providers[(start+i)%n]
+		if p.coolingDown(now) {
+			cooling = append(cooling, p)
+		} else {
+			healthy = append(healthy, p)
+		}
+	}
+	return append(healthy, cooling...)
+}
+
+// isProviderError reports whether err may be specific to the provider that returned it,
+// so that the call is worth retrying elsewhere. Reverts and missing data are not.
+func isProviderError(err error) bool {
+	if errors.Is(err, ethereum.NotFound) {
+		return false
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == 3 {
+		return false
+	}
+	return !strings.Contains(err.Error(), "execution reverted")
+}
+
+// redactError returns the message of err with the URL of any *url.Error in it
+// reduced to its host. HTTP clients name the full URL of failed requests, whose
+// path holds the provider's API key.
+func redactError(err error) string {
+	msg := err.Error()
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && urlErr.URL != "" {
+		msg = strings.ReplaceAll(msg, urlErr.URL, displayURL(urlErr.URL))
+	}
+	return msg
+}
+
+// check refreshes the provider's head block, recording its health.
+func (p *provider) check(ctx context.Context, timeout, cooldown time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	head, err := p.client.BlockNumber(ctx)
+	if err != nil {
+		p.failed(err, cooldown)
+		return
+	}
+
+	p.succeeded(time.Since(start))
+	p.mu.Lock()
+	p.head = head
+	p.mu.Unlock()
+}
+
+func (p *provider) succeeded(latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures = 0
+	p.downUntil = time.Time{}
+	p.latency = latency
+	p.lastChecked = time.Now()
+}
+
+func (p *provider) failed(err error, cooldown time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures++
+	p.lastErr = redactError(err)
+	p.lastErrAt = time.Now()
+	p.downUntil = p.lastErrAt.Add(cooldown)
+	p.lastChecked = p.lastErrAt
+}
+
+func (p *provider) coolingDown(now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return now.Before(p.downUntil)
+}
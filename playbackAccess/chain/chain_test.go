@@ -0,0 +1,174 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/loop/playbackAccess/config"
+)
+
+// apiKey is the secret RPC providers take in the path of their URLs.
+const apiKey = "v2/s3cr3t-api-key"
+
+// rpcServer serves eth_blockNumber with head and fails eth_call with a revert.
+// It counts the requests it serves.
+func rpcServer(t *testing.T, head string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		response := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		switch req.Method {
+		case "eth_blockNumber":
+			response["result"] = head
+		case "eth_call":
+			response["error"] = map[string]interface{}{"code": 3, "message": "execution reverted", "data": "0x"}
+		default:
+			response["error"] = map[string]interface{}{"code": -32601, "message": "method not found"}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+// downURL returns the URL of an RPC provider that refuses connections.
+func downURL(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	return srv.URL + "/" + apiKey
+}
+
+func newTestRegistry(t *testing.T, rpcURLs ...string) (*Registry, *Chain) {
+	t.Helper()
+	r, err := NewRegistry([]config.ChainConfig{{Name: "base", ID: 8453, RPCURLs: rpcURLs}}, Options{
+		CallTimeout:     time.Second,
+		FailureCooldown: time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.Close)
+	c, _ := r.Chain("base")
+	return r, c
+}
+
+func TestFailover(t *testing.T) {
+	up, _ := rpcServer(t, "0x10")
+	_, c := newTestRegistry(t, downURL(t), up.URL+"/"+apiKey)
+
+	// Every call succeeds, whichever provider it starts at
+	for i := 0; i < 4; i++ {
+		head, err := c.BlockNumber(context.Background())
+		if err != nil {
+			t.Fatalf("BlockNumber: %v", err)
+		}
+		if head != 16 {
+			t.Fatalf("BlockNumber = %d, want 16", head)
+		}
+	}
+
+	// The failed provider is skipped while it cools down
+	if order := c.order(); order[0] != c.providers[1] {
+		t.Errorf("first provider = %s, want the healthy one", order[0].url)
+	}
+	if failures := c.providers[0].failures; failures != 1 {
+		t.Errorf("failures of the provider that is down = %d, want 1", failures)
+	}
+}
+
+func TestFailoverReverts(t *testing.T) {
+	up, requests := rpcServer(t, "0x10")
+	other, otherRequests := rpcServer(t, "0x10")
+	_, c := newTestRegistry(t, up.URL, other.URL)
+
+	// Reverts are the same on every provider, so they are not retried
+	_, err := c.CallContract(context.Background(), ethereum.CallMsg{To: &common.Address{}}, nil)
+	if err == nil || !strings.Contains(err.Error(), "execution reverted") {
+		t.Fatalf("CallContract = %v, want a revert", err)
+	}
+	if n := requests.Load() + otherRequests.Load(); n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+	if health := c.Health(); !health.Providers[0].Healthy || !health.Providers[1].Healthy {
+		t.Errorf("providers unhealthy after a revert: %+v", health.Providers)
+	}
+}
+
+func TestAllProvidersFail(t *testing.T) {
+	_, c := newTestRegistry(t, downURL(t), downURL(t))
+
+	if _, err := c.BlockNumber(context.Background()); err == nil || !strings.Contains(err.Error(), "all RPC providers failed") {
+		t.Fatalf("BlockNumber = %v, want all providers failed", err)
+	}
+
+	_, empty := newTestRegistry(t)
+	if _, err := empty.BlockNumber(context.Background()); !errors.Is(err, ErrNoProviders) {
+		t.Errorf("BlockNumber without providers = %v, want ErrNoProviders", err)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	up, _ := rpcServer(t, "0x2a")
+	r, c := newTestRegistry(t, downURL(t), up.URL+"/"+apiKey)
+
+	r.checkAll(context.Background())
+
+	health := r.Health()
+	if len(health) != 1 {
+		t.Fatalf("Health = %d chains, want 1", len(health))
+	}
+	h := health[0]
+	if h.Name != "base" || h.ID != 8453 || !h.Healthy || h.HeadBlock != 42 {
+		t.Errorf("chain health = %+v, want healthy base at block 42", h)
+	}
+
+	down, healthy := h.Providers[0], h.Providers[1]
+	if down.Healthy || down.ConsecutiveFailures != 1 || down.LastError == "" || down.LastErrorAt == nil {
+		t.Errorf("health of the provider that is down = %+v", down)
+	}
+	if !healthy.Healthy || healthy.HeadBlock != 42 || healthy.LastCheckedAt == nil {
+		t.Errorf("health of the healthy provider = %+v", healthy)
+	}
+
+	// Nothing in the health report reveals the API key
+	data, err := json.Marshal(health)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "s3cr3t") {
+		t.Errorf("health report leaks the API key: %s", data)
+	}
+	if want := c.providers[0].url; !strings.Contains(down.LastError, want) {
+		t.Errorf("lastError = %q, want the provider's host %s", down.LastError, want)
+	}
+}
+
+func TestHealthUnhealthyChain(t *testing.T) {
+	r, _ := newTestRegistry(t, downURL(t))
+	r.checkAll(context.Background())
+
+	if h := r.Health()[0]; h.Healthy || h.HeadBlock != 0 {
+		t.Errorf("health of a chain whose providers are down = %+v, want unhealthy", h)
+	}
+}
@@ -0,0 +1,219 @@
+// Package chain provides access to the chains the service reads: a registry of
+// chains and the Loop contracts deployed on them, each backed by a pool of RPC
+// providers with health tracking and failover.
+package chain
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/loop/playbackAccess/config"
+)
+
+// Options configures the provider pools of a Registry.
+type Options struct {
+	// CallTimeout bounds each attempt of a call on a single provider.
+	CallTimeout time.Duration
+	// FailureCooldown is how long a failed provider is skipped while others are available.
+	FailureCooldown time.Duration
+}
+
+// Registry holds the configured chains.
+type Registry struct {
+	chains []*Chain
+	byName map[string]*Chain
+	byID   map[int64]*Chain
+	opts   Options
+}
+
+// NewRegistry returns a Registry of the given chains, creating a client for each RPC URL.
+// The Registry takes ownership of the clients; call Close to release them.
+func NewRegistry(chains []config.ChainConfig, opts Options) (*Registry, error) {
+	r := &Registry{
+		byName: make(map[string]*Chain),
+		byID:   make(map[int64]*Chain),
+		opts:   opts,
+	}
+
+	for _, cc := range chains {
+		c := &Chain{
+			Name: cc.Name,
+			ID:   cc.ID,
+			Contracts: Contracts{
+				VideoNFT:        hexAddress(cc.VideoNFT),
+				PurchaseManager: hexAddress(cc.PurchaseManager),
+				USDC:            hexAddress(cc.USDC),
+			},
+			opts: opts,
+		}
+
+		for _, rpcURL := range cc.RPCURLs {
+			client, err := ethclient.Dial(rpcURL)
+			if err != nil {
+				r.Close()
+				return nil, fmt.Errorf("failed to connect to %s RPC %s: %w", cc.Name, displayURL(rpcURL), err)
+			}
+			c.providers = append(c.providers, &provider{url: displayURL(rpcURL), client: client})
+		}
+
+		r.chains = append(r.chains, c)
+		r.byName[c.Name] = c
+		r.byID[c.ID] = c
+	}
+
+	return r, nil
+}
+
+// Chain returns the chain with the given name, e.g. "base".
+func (r *Registry) Chain(name string) (*Chain, bool) {
+	c, ok := r.byName[name]
+	return c, ok
+}
+
+// ChainByID returns the chain with the given EIP-155 chain ID.
+func (r *Registry) ChainByID(id int64) (*Chain, bool) {
+	c, ok := r.byID[id]
+	return c, ok
+}
+
+// Chains returns every configured chain, in configuration order.
+func (r *Registry) Chains() []*Chain {
+	return r.chains
+}
+
+// Run checks every provider's head block each interval until ctx is done,
+// so that failed providers are brought back once they recover.
+func (r *Registry) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.checkAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkAll checks every provider concurrently.
+func (r *Registry) checkAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, c := range r.chains {
+		for _, p := range c.providers {
+			wg.Add(1)
+			go func(c *Chain, p *provider) {
+				defer wg.Done()
+				p.check(ctx, r.opts.CallTimeout, r.opts.FailureCooldown)
+				if p.coolingDown(time.Now()) {
+					log.Printf("RPC provider %s for %s is unhealthy", p.url, c.Name)
+				}
+			}(c, p)
+		}
+	}
+	wg.Wait()
+}
+
+// Close releases every RPC client.
+func (r *Registry) Close() {
+	for _, c := range r.chains {
+		for _, p := range c.providers {
+			p.client.Close()
+		}
+	}
+}
+
+// ChainHealth describes a chain and its providers for diagnostics.
+type ChainHealth struct {
+	Name string `json:"name"`
+	ID   int64  `json:"id"`
+	// HeadBlock is the highest block reported by any healthy provider.
+	HeadBlock uint64           `json:"headBlock"`
+	Healthy   bool             `json:"healthy"`
+	Providers []ProviderHealth `json:"providers"`
+}
+
+// ProviderHealth describes a single RPC provider. URLs are shown without paths,
+// where providers embed their API keys, in errors as well.
+type ProviderHealth struct {
+	URL                 string     `json:"url"`
+	Healthy             bool       `json:"healthy"`
+	HeadBlock           uint64     `json:"headBlock"`
+	LatencyMs           int64      `json:"latencyMs"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	LastError           string     `json:"lastError,omitempty"`
+	LastErrorAt         *time.Time `json:"lastErrorAt,omitempty"`
+	LastCheckedAt       *time.Time `json:"lastCheckedAt,omitempty"`
+}
+
+// Health returns the health of every chain.
+func (r *Registry) Health() []ChainHealth {
+	health := make([]ChainHealth, 0, len(r.chains))
+	for _, c := range r.chains {
+		health = append(health, c.Health())
+	}
+	return health
+}
+
+// Health returns the health of the chain's providers. A chain is healthy when
+// at least one provider is.
+func (c *Chain) Health() ChainHealth {
+	now := time.Now()
+	h := ChainHealth{Name: c.Name, ID: c.ID, Providers: make([]ProviderHealth, 0, len(c.providers))}
+
+	for _, p := range c.providers {
+		p.mu.Lock()
+		ph := ProviderHealth{
+			URL:                 p.url,
+			Healthy:             !now.Before(p.downUntil),
+			HeadBlock:           p.head,
+			LatencyMs:           p.latency.Milliseconds(),
+			ConsecutiveFailures: p.failures,
+			LastError:           p.lastErr,
+		}
+		if !p.lastErrAt.IsZero() {
+			lastErrAt := p.lastErrAt
+			ph.LastErrorAt = &lastErrAt
+		}
+		if !p.lastChecked.IsZero() {
+			lastChecked := p.lastChecked
+			ph.LastCheckedAt = &lastChecked
+		}
+		p.mu.Unlock()
+
+		if ph.Healthy {
+			h.Healthy = true
+			if ph.HeadBlock > h.HeadBlock {
+				h.HeadBlock = ph.HeadBlock
+			}
+		}
+		h.Providers = append(h.Providers, ph)
+	}
+
+	return h
+}
+
+// hexAddress parses an optional address; configuration has already been validated.
+func hexAddress(s string) common.Address {
+	if s == "" {
+		return common.Address{}
+	}
+	return common.HexToAddress(s)
+}
+
+// displayURL strips everything after the host of an RPC URL.
+func displayURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "[invalid URL]"
+	}
+	return u.Scheme + "://" + u.Host
+}
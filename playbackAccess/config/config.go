@@ -0,0 +1,1146 @@
+// Package config provides typed, validated configuration for the playback access API.
+// Configuration is loaded from an optional YAML or TOML file and then overridden by
+// environment variables, so existing deployments that only set environment variables
+// keep working unchanged.
+package config
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secret values when the configuration is printed.
+const redacted = "[REDACTED]"
+
+// Duration is a time.Duration that is read from and written to configuration
+// files as a Go duration string such as "5m" or "30s".
+type Duration time.Duration
+
+// UnmarshalText parses a duration string. It is used by the TOML decoder.
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalText formats the duration as a duration string.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalYAML parses a duration string from a YAML scalar.
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	return d.UnmarshalText([]byte(value.Value))
+}
+
+// MarshalYAML formats the duration as a duration string.
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+// ServerConfig holds HTTP server settings
+type ServerConfig struct {
+	Port            int      `yaml:"port" toml:"port"`
+	Env             string   `yaml:"env" toml:"env"`
+	ShutdownTimeout Duration `yaml:"shutdownTimeout" toml:"shutdownTimeout"`
+}
+
+// IsProduction reports whether the service runs in the production environment.
+func (c ServerConfig) IsProduction() bool {
+	return c.Env == "production"
+}
+
+// RedisConfig holds Redis connection settings
+type RedisConfig struct {
+	URL string `yaml:"url" toml:"url"`
+}
+
+// DatabaseConfig holds PostgreSQL connection and pool settings
+type DatabaseConfig struct {
+	URL             string   `yaml:"url" toml:"url"`
+	MaxOpenConns    int      `yaml:"maxOpenConns" toml:"maxOpenConns"`
+	MaxIdleConns    int      `yaml:"maxIdleConns" toml:"maxIdleConns"`
+	ConnMaxLifetime Duration `yaml:"connMaxLifetime" toml:"connMaxLifetime"`
+}
+
+// StorjConfig holds Storj link sharing settings
+type StorjConfig struct {
+	AccessGrant string `yaml:"accessGrant" toml:"accessGrant"`
+	Bucket      string `yaml:"bucket" toml:"bucket"`
+}
+
+// LinksConfig selects how playable links are created: "storj" shares objects
+// through Storj's linksharing service (using StorjConfig), "s3" presigns URLs for
+// an S3-compatible endpoint and "local" serves files from a directory.
+// A link works until the viewer's access expires, but at most Expiration for the
+// video's visibility and at least MinExpiration. Links are cached in Redis and
+// shared until CacheMargin before they expire. Download links of a video's file
+// work for DownloadExpiration, but not after the viewer's access expires.
+type LinksConfig struct {
+	Provider           string               `yaml:"provider" toml:"provider"`
+	Expiration         LinkExpirationConfig `yaml:"expiration" toml:"expiration"`
+	MinExpiration      Duration             `yaml:"minExpiration" toml:"minExpiration"`
+	CacheMargin        Duration             `yaml:"cacheMargin" toml:"cacheMargin"`
+	DownloadExpiration Duration             `yaml:"downloadExpiration" toml:"downloadExpiration"`
+	S3                 S3LinksConfig        `yaml:"s3" toml:"s3"`
+	Local              LocalLinksConfig     `yaml:"local" toml:"local"`
+	Gateway            GatewayLinksConfig   `yaml:"gateway" toml:"gateway"`
+}
+
+// LinkExpirationConfig holds the longest lifetime of links by video visibility.
+type LinkExpirationConfig struct {
+	Public    Duration `yaml:"public" toml:"public"`
+	Protected Duration `yaml:"protected" toml:"protected"`
+}
+
+// ForVisibility returns the longest lifetime of links to videos with visibility.
+// Unknown visibilities are treated as protected.
+func (c LinkExpirationConfig) ForVisibility(visibility string) time.Duration {
+	if visibility == "public" {
+		return time.Duration(c.Public)
+	}
+	return time.Duration(c.Protected)
+}
+
+// S3LinksConfig holds the endpoint and credentials used to presign links,
+// e.g. for the Storj S3 gateway or MinIO. With the storj and gateway providers,
+// it is optional and used only for download links.
+type S3LinksConfig struct {
+	Endpoint        string `yaml:"endpoint" toml:"endpoint"`
+	Region          string `yaml:"region" toml:"region"`
+	Bucket          string `yaml:"bucket" toml:"bucket"`
+	AccessKeyID     string `yaml:"accessKeyId" toml:"accessKeyId"`
+	SecretAccessKey string `yaml:"secretAccessKey" toml:"secretAccessKey"`
+}
+
+// GatewayLinksConfig holds settings of the HLS gateway, which serves videos' playlists
+// with every URI replaced by a URL signed for one object and playback session. The
+// s3 provider serves its playlists the same way.
+// BaseURL is the public URL of the server's /v1/hls/ path and SigningKey a base64
+// HMAC key of at least 32 bytes. Playlist URLs work for PlaylistTTL and segment
+// URLs for SegmentTTL plus the playback time before the segment.
+type GatewayLinksConfig struct {
+	BaseURL     string   `yaml:"baseUrl" toml:"baseUrl"`
+	SigningKey  string   `yaml:"signingKey" toml:"signingKey"`
+	PlaylistTTL Duration `yaml:"playlistTtl" toml:"playlistTtl"`
+	SegmentTTL  Duration `yaml:"segmentTtl" toml:"segmentTtl"`
+}
+
+// Key decodes SigningKey.
+func (c GatewayLinksConfig) Key() ([]byte, error) {
+	return decodeHMACKey(c.SigningKey)
+}
+
+// ProxyConfig holds settings of the streaming proxy, which serves videos in proxy
+// mode from the bucket (using StorjConfig) to holders of a signed token. It is
+// enabled when SigningKey, a base64 HMAC key of at least 32 bytes, is set.
+// BaseURL is the public URL of the server's /v1/stream/ path.
+type ProxyConfig struct {
+	BaseURL    string `yaml:"baseUrl" toml:"baseUrl"`
+	SigningKey string `yaml:"signingKey" toml:"signingKey"`
+}
+
+// Key decodes SigningKey.
+func (c ProxyConfig) Key() ([]byte, error) {
+	return decodeHMACKey(c.SigningKey)
+}
+
+// KeysConfig holds settings of the HLS key server, which releases the AES-128 keys
+// of encrypted renditions to holders of a playback session for the video. It is
+// enabled when MasterKey, the base64 AES-256 key the content keys are wrapped under
+// in the database, is set, and requires sessions. BaseURL is the public URL of the
+// server's /v1/keys/ path, which encrypted playlists refer to. A session or client
+// may fetch RateLimit keys per RateWindow.
+type KeysConfig struct {
+	MasterKey  string   `yaml:"masterKey" toml:"masterKey"`
+	BaseURL    string   `yaml:"baseUrl" toml:"baseUrl"`
+	RateLimit  int      `yaml:"rateLimit" toml:"rateLimit"`
+	RateWindow Duration `yaml:"rateWindow" toml:"rateWindow"`
+}
+
+// Master decodes MasterKey.
+func (c KeysConfig) Master() ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(c.MasterKey)
+	if err != nil {
+		return nil, fmt.Errorf("must be base64")
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// decodeHMACKey decodes a base64 HMAC key of at least 32 bytes.
+func decodeHMACKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("must be base64")
+	}
+	if len(key) < 32 {
+		return nil, fmt.Errorf("must be at least 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// LocalLinksConfig holds the directory served by the local provider and the
+// public URL it is served at (the server's /v1/files/ path).
+type LocalLinksConfig struct {
+	Dir     string `yaml:"dir" toml:"dir"`
+	BaseURL string `yaml:"baseUrl" toml:"baseUrl"`
+}
+
+// MetadataConfig holds settings of the public video metadata endpoint. IPFSGateway
+// is the URL prefix that ipfs:// cover images are served at, followed by their CID,
+// and responses may be cached for MaxAge.
+type MetadataConfig struct {
+	IPFSGateway string   `yaml:"ipfsGateway" toml:"ipfsGateway"`
+	MaxAge      Duration `yaml:"maxAge" toml:"maxAge"`
+}
+
+// SIWEConfig holds Sign-In with Ethereum (EIP-4361) verification settings
+type SIWEConfig struct {
+	Domains   []string `yaml:"domains" toml:"domains"`
+	ChainIDs  []int64  `yaml:"chainIds" toml:"chainIds"`
+	MaxAge    Duration `yaml:"maxAge" toml:"maxAge"`
+	ClockSkew Duration `yaml:"clockSkew" toml:"clockSkew"`
+}
+
+// EthereumConfig holds JSON-RPC settings for on-chain reads.
+// Chain names the default chain, used for wallet signatures and purchases;
+// RPCURL is shorthand for an additional RPC URL of that chain.
+type EthereumConfig struct {
+	RPCURL              string   `yaml:"rpcUrl" toml:"rpcUrl"`
+	RPCTimeout          Duration `yaml:"rpcTimeout" toml:"rpcTimeout"`
+	Chain               string   `yaml:"chain" toml:"chain"`
+	HealthCheckInterval Duration `yaml:"healthCheckInterval" toml:"healthCheckInterval"`
+	FailureCooldown     Duration `yaml:"failureCooldown" toml:"failureCooldown"`
+}
+
+// ChainConfig describes a chain the service reads and the Loop contracts deployed on it.
+// Name is the name access conditions use for the chain, e.g. "baseSepolia".
+// A chain without RPC URLs is known but cannot be read.
+// PurchaseManagerDeploymentBlock is where the purchase indexer starts; when it is
+// zero, the indexer looks the block up on-chain.
+type ChainConfig struct {
+	Name                           string   `yaml:"name" toml:"name"`
+	ID                             int64    `yaml:"id" toml:"id"`
+	RPCURLs                        []string `yaml:"rpcUrls" toml:"rpcUrls"`
+	VideoNFT                       string   `yaml:"videoNft" toml:"videoNft"`
+	PurchaseManager                string   `yaml:"purchaseManager" toml:"purchaseManager"`
+	PurchaseManagerDeploymentBlock uint64   `yaml:"purchaseManagerDeploymentBlock" toml:"purchaseManagerDeploymentBlock"`
+	USDC                           string   `yaml:"usdc" toml:"usdc"`
+}
+
+// EIP712Config holds the EIP-712 domain that playback authorizations are signed under.
+// VerifyingContract is the VideoNFT address of this deployment; when it is empty,
+// typed-data authorization is disabled.
+type EIP712Config struct {
+	Name              string `yaml:"name" toml:"name"`
+	Version           string `yaml:"version" toml:"version"`
+	ChainID           int64  `yaml:"chainId" toml:"chainId"`
+	VerifyingContract string `yaml:"verifyingContract" toml:"verifyingContract"`
+}
+
+// LitConfig holds settings for lit.action authorization. Videos record the address
+// of their Lit-held signing key when they are minted; AllowLegacySigners accepts
+// lit.action messages for videos minted before signers were recorded, whose
+// messages cannot be told from those signed by any other key. Turn it off once
+// every video records its signer.
+type LitConfig struct {
+	AllowLegacySigners bool `yaml:"allowLegacySigners" toml:"allowLegacySigners"`
+}
+
+// ChallengeConfig holds settings for server-issued challenge nonces. A client may
+// request RateLimit challenges per RateWindow. AllowLegacyNonces is a temporary
+// opt-in for migrating clients: with it, lit.action and loop.web3.auth messages
+// whose nonce was not issued as a challenge, as signed by clients that predate
+// challenges, are accepted once each.
+type ChallengeConfig struct {
+	TTL               Duration `yaml:"ttl" toml:"ttl"`
+	RateLimit         int      `yaml:"rateLimit" toml:"rateLimit"`
+	RateWindow        Duration `yaml:"rateWindow" toml:"rateWindow"`
+	AllowLegacyNonces bool     `yaml:"allowLegacyNonces" toml:"allowLegacyNonces"`
+}
+
+// PurchaseConfig holds settings for verifying video purchases on-chain.
+// PurchaseManager overrides the PurchaseManager of the default chain.
+type PurchaseConfig struct {
+	PurchaseManager string   `yaml:"purchaseManager" toml:"purchaseManager"`
+	CacheTTL        Duration `yaml:"cacheTtl" toml:"cacheTtl"`
+}
+
+// ACLConfig holds settings for evaluating video access conditions on-chain
+type ACLConfig struct {
+	CacheTTL Duration `yaml:"cacheTtl" toml:"cacheTtl"`
+}
+
+// IndexerConfig holds settings for the indexer that records VideoPurchased events
+// of the default chain's PurchaseManager as access grants. Blocks within
+// Confirmations of the head are indexed immediately but rolled back on reorgs.
+type IndexerConfig struct {
+	Enabled       bool     `yaml:"enabled" toml:"enabled"`
+	PollInterval  Duration `yaml:"pollInterval" toml:"pollInterval"`
+	Confirmations uint64   `yaml:"confirmations" toml:"confirmations"`
+	BatchSize     uint64   `yaml:"batchSize" toml:"batchSize"`
+}
+
+// SessionConfig holds settings for playback session tokens, which let a viewer keep
+// playing a video without signing again. Sessions are disabled when no keys are set.
+// The first key signs new tokens and every key verifies them.
+type SessionConfig struct {
+	TTL  Duration           `yaml:"ttl" toml:"ttl"`
+	Keys []SessionKeyConfig `yaml:"keys" toml:"keys"`
+}
+
+// SessionKeyConfig is an Ed25519 session signing key. PrivateKey is the base64-encoded
+// 32-byte seed or 64-byte private key.
+type SessionKeyConfig struct {
+	ID         string `yaml:"id" toml:"id"`
+	PrivateKey string `yaml:"privateKey" toml:"privateKey"`
+}
+
+// Ed25519 decodes the private key.
+func (k SessionKeyConfig) Ed25519() (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(k.PrivateKey)
+	if err != nil {
+		if raw, err = base64.RawURLEncoding.DecodeString(k.PrivateKey); err != nil {
+			return nil, fmt.Errorf("invalid base64")
+		}
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	default:
+		return nil, fmt.Errorf("must be %d or %d bytes, got %d", ed25519.SeedSize, ed25519.PrivateKeySize, len(raw))
+	}
+}
+
+// PrivyConfig holds settings for authenticating users by their Privy identity tokens,
+// enabled when AppID is set. JWKS is the path or URL of the app's JSON Web Key Set and
+// defaults to Privy's endpoint for the app.
+type PrivyConfig struct {
+	AppID    string   `yaml:"appId" toml:"appId"`
+	JWKS     string   `yaml:"jwks" toml:"jwks"`
+	CacheTTL Duration `yaml:"cacheTtl" toml:"cacheTtl"`
+}
+
+// JWKSSource returns the configured JWKS path or URL, or Privy's endpoint for the app.
+func (c PrivyConfig) JWKSSource() string {
+	if c.JWKS != "" {
+		return c.JWKS
+	}
+	return fmt.Sprintf("https://auth.privy.io/api/v1/apps/%s/jwks.json", url.PathEscape(c.AppID))
+}
+
+// Config is the complete configuration of the playback access API.
+type Config struct {
+	Server     ServerConfig    `yaml:"server" toml:"server"`
+	Redis      RedisConfig     `yaml:"redis" toml:"redis"`
+	Database   DatabaseConfig  `yaml:"database" toml:"database"`
+	Storj      StorjConfig     `yaml:"storj" toml:"storj"`
+	Links      LinksConfig     `yaml:"links" toml:"links"`
+	Proxy      ProxyConfig     `yaml:"proxy" toml:"proxy"`
+	Keys       KeysConfig      `yaml:"keys" toml:"keys"`
+	Metadata   MetadataConfig  `yaml:"metadata" toml:"metadata"`
+	SIWE       SIWEConfig      `yaml:"siwe" toml:"siwe"`
+	Ethereum   EthereumConfig  `yaml:"ethereum" toml:"ethereum"`
+	Chains     []ChainConfig   `yaml:"chains" toml:"chains"`
+	EIP712     EIP712Config    `yaml:"eip712" toml:"eip712"`
+	Lit        LitConfig       `yaml:"lit" toml:"lit"`
+	Challenges ChallengeConfig `yaml:"challenges" toml:"challenges"`
+	Purchases  PurchaseConfig  `yaml:"purchases" toml:"purchases"`
+	ACL        ACLConfig       `yaml:"acl" toml:"acl"`
+	Indexer    IndexerConfig   `yaml:"indexer" toml:"indexer"`
+	Sessions   SessionConfig   `yaml:"sessions" toml:"sessions"`
+	Privy      PrivyConfig     `yaml:"privy" toml:"privy"`
+}
+
+// Default returns the configuration used for any value that is not set
+// in the configuration file or the environment.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:            8080,
+			Env:             "development",
+			ShutdownTimeout: Duration(30 * time.Second),
+		},
+		Database: DatabaseConfig{
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: Duration(5 * time.Minute),
+		},
+		Links: LinksConfig{
+			Provider: "storj",
+			Expiration: LinkExpirationConfig{
+				Public:    Duration(4 * time.Hour),
+				Protected: Duration(4 * time.Hour),
+			},
+			MinExpiration:      Duration(5 * time.Minute),
+			CacheMargin:        Duration(15 * time.Minute),
+			DownloadExpiration: Duration(10 * time.Minute),
+			S3: S3LinksConfig{
+				Region: "us-east-1",
+			},
+			Gateway: GatewayLinksConfig{
+				PlaylistTTL: Duration(5 * time.Minute),
+				SegmentTTL:  Duration(10 * time.Minute),
+			},
+		},
+		Keys: KeysConfig{
+			RateLimit:  60,
+			RateWindow: Duration(time.Minute),
+		},
+		Metadata: MetadataConfig{
+			// The webapp's gateway
+			IPFSGateway: "https://legislative-pink-lamprey.myfilebase.com/ipfs/",
+			MaxAge:      Duration(time.Minute),
+		},
+		SIWE: SIWEConfig{
+			// The webapp's production host (APP_HOST)
+			Domains:   []string{"www.getloop.xyz"},
+			ChainIDs:  []int64{8453, 84532}, // Base, Base Sepolia
+			MaxAge:    Duration(10 * time.Minute),
+			ClockSkew: Duration(time.Minute),
+		},
+		Ethereum: EthereumConfig{
+			RPCTimeout:          Duration(5 * time.Second),
+			Chain:               "base",
+			HealthCheckInterval: Duration(15 * time.Second),
+			FailureCooldown:     Duration(30 * time.Second),
+		},
+		// Deployments from contracts/.openzeppelin and the webapp's contractsConfig
+		Chains: []ChainConfig{
+			{
+				Name:            "base",
+				ID:              8453,
+				VideoNFT:        "0x9AC909c7d60296b9813B86e1e13849B39fcF71BC",
+				PurchaseManager: "0x239498Bb3f11125CB12b658af008Efe8843C910E",
+				USDC:            "0x833589fCD6eDb6E08f4c7C32D4f71b54bdA02913",
+			},
+			{
+				Name:            "baseSepolia",
+				ID:              84532,
+				VideoNFT:        "0x2e6146DdC85644Cf4A3E1410304Abe70D5E628b3",
+				PurchaseManager: "0x4FA3068Ed7eF30c61e5c14dE18448C789cF9Aec5",
+				USDC:            "0x036CbD53842c5426634e7929541eC2318f3dCF7e",
+			},
+		},
+		EIP712: EIP712Config{
+			Name:    "Loop",
+			Version: "1",
+		},
+		Lit: LitConfig{
+			AllowLegacySigners: true,
+		},
+		Challenges: ChallengeConfig{
+			TTL:               Duration(5 * time.Minute),
+			RateLimit:         30,
+			RateWindow:        Duration(time.Minute),
+			AllowLegacyNonces: false,
+		},
+		Purchases: PurchaseConfig{
+			CacheTTL: Duration(24 * time.Hour),
+		},
+		ACL: ACLConfig{
+			CacheTTL: Duration(5 * time.Minute),
+		},
+		Indexer: IndexerConfig{
+			Enabled:       true,
+			PollInterval:  Duration(2 * time.Second),
+			Confirmations: 10,
+			BatchSize:     2000,
+		},
+		Sessions: SessionConfig{
+			TTL: Duration(time.Hour),
+		},
+		Privy: PrivyConfig{
+			CacheTTL: Duration(time.Hour),
+		},
+	}
+}
+
+// Load builds the effective configuration.
+// It starts from Default, applies the file at path (if path is non-empty),
+// applies environment variable overrides and finally validates the result.
+//
+// The file format is chosen from the extension: .yaml/.yml or .toml.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// loadFile decodes the configuration file at path into cfg.
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown keys in config file %s: %v", path, undecoded)
+		}
+	default:
+		return fmt.Errorf("unsupported config file extension %q (want .yaml, .yml or .toml)", ext)
+	}
+
+	return nil
+}
+
+// applyEnv overrides cfg with any configuration set in the environment.
+// Values that are set but cannot be parsed are rejected rather than ignored.
+func applyEnv(cfg *Config) error {
+	var errs []error
+
+	setString := func(key string, dst *string) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			*dst = v
+		}
+	}
+	setInt := func(key string, dst *int) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid integer %q", key, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	setDuration := func(key string, dst *Duration) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			if err := dst.UnmarshalText([]byte(v)); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid duration %q", key, v))
+			}
+		}
+	}
+	setInt64 := func(key string, dst *int64) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid integer %q", key, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	setUint64 := func(key string, dst *uint64) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid integer %q", key, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	setBool := func(key string, dst *bool) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid boolean %q", key, v))
+				return
+			}
+			*dst = b
+		}
+	}
+	setStrings := func(key string, dst *[]string) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			*dst = splitList(v)
+		}
+	}
+	setInt64s := func(key string, dst *[]int64) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			var list []int64
+			for _, item := range splitList(v) {
+				n, err := strconv.ParseInt(item, 10, 64)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: invalid integer %q", key, item))
+					return
+				}
+				list = append(list, n)
+			}
+			*dst = list
+		}
+	}
+
+	setInt("PORT", &cfg.Server.Port)
+	setString("APP_ENV", &cfg.Server.Env)
+	setDuration("SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+
+	setString("REDIS_URL", &cfg.Redis.URL)
+
+	setString("DATABASE_URL", &cfg.Database.URL)
+	setInt("DB_MAX_OPEN_CONNS", &cfg.Database.MaxOpenConns)
+	setInt("DB_MAX_IDLE_CONNS", &cfg.Database.MaxIdleConns)
+	setDuration("DB_CONN_MAX_LIFETIME", &cfg.Database.ConnMaxLifetime)
+
+	setString("LINK_SHARE_ACCESS_GRANT", &cfg.Storj.AccessGrant)
+	setString("S3_VIDEO_BUCKET", &cfg.Storj.Bucket)
+
+	setString("LINK_PROVIDER", &cfg.Links.Provider)
+	setDuration("LINK_EXPIRATION_PUBLIC", &cfg.Links.Expiration.Public)
+	setDuration("LINK_EXPIRATION_PROTECTED", &cfg.Links.Expiration.Protected)
+	setDuration("LINK_MIN_EXPIRATION", &cfg.Links.MinExpiration)
+	setDuration("LINK_CACHE_MARGIN", &cfg.Links.CacheMargin)
+	setDuration("LINK_DOWNLOAD_EXPIRATION", &cfg.Links.DownloadExpiration)
+	setString("S3_ENDPOINT", &cfg.Links.S3.Endpoint)
+	setString("S3_REGION", &cfg.Links.S3.Region)
+	setString("S3_BUCKET", &cfg.Links.S3.Bucket)
+	setString("S3_ACCESS_KEY_ID", &cfg.Links.S3.AccessKeyID)
+	setString("S3_SECRET_ACCESS_KEY", &cfg.Links.S3.SecretAccessKey)
+	setString("LOCAL_MEDIA_DIR", &cfg.Links.Local.Dir)
+	setString("LOCAL_MEDIA_BASE_URL", &cfg.Links.Local.BaseURL)
+	setString("GATEWAY_BASE_URL", &cfg.Links.Gateway.BaseURL)
+	setString("GATEWAY_SIGNING_KEY", &cfg.Links.Gateway.SigningKey)
+	setDuration("GATEWAY_PLAYLIST_TTL", &cfg.Links.Gateway.PlaylistTTL)
+	setDuration("GATEWAY_SEGMENT_TTL", &cfg.Links.Gateway.SegmentTTL)
+
+	setString("PROXY_BASE_URL", &cfg.Proxy.BaseURL)
+	setString("PROXY_SIGNING_KEY", &cfg.Proxy.SigningKey)
+
+	setString("CONTENT_KEY_MASTER_KEY", &cfg.Keys.MasterKey)
+	setString("KEY_BASE_URL", &cfg.Keys.BaseURL)
+	setInt("KEY_RATE_LIMIT", &cfg.Keys.RateLimit)
+	setDuration("KEY_RATE_WINDOW", &cfg.Keys.RateWindow)
+
+	setString("IPFS_GATEWAY", &cfg.Metadata.IPFSGateway)
+	setDuration("METADATA_MAX_AGE", &cfg.Metadata.MaxAge)
+
+	setStrings("SIWE_DOMAINS", &cfg.SIWE.Domains)
+	setInt64s("SIWE_CHAIN_IDS", &cfg.SIWE.ChainIDs)
+	setDuration("SIWE_MAX_AGE", &cfg.SIWE.MaxAge)
+	setDuration("SIWE_CLOCK_SKEW", &cfg.SIWE.ClockSkew)
+
+	setString("ETH_RPC_URL", &cfg.Ethereum.RPCURL)
+	setDuration("ETH_RPC_TIMEOUT", &cfg.Ethereum.RPCTimeout)
+	setString("ETH_CHAIN", &cfg.Ethereum.Chain)
+	setDuration("ETH_HEALTH_CHECK_INTERVAL", &cfg.Ethereum.HealthCheckInterval)
+	setDuration("ETH_FAILURE_COOLDOWN", &cfg.Ethereum.FailureCooldown)
+
+	// e.g. BASE_SEPOLIA_RPC_URLS for the chain named baseSepolia
+	for i := range cfg.Chains {
+		prefix := envName(cfg.Chains[i].Name)
+		setStrings(prefix+"_RPC_URLS", &cfg.Chains[i].RPCURLs)
+		setUint64(prefix+"_PURCHASE_MANAGER_DEPLOYMENT_BLOCK", &cfg.Chains[i].PurchaseManagerDeploymentBlock)
+	}
+
+	setString("EIP712_NAME", &cfg.EIP712.Name)
+	setString("EIP712_VERSION", &cfg.EIP712.Version)
+	setInt64("EIP712_CHAIN_ID", &cfg.EIP712.ChainID)
+	setString("EIP712_VERIFYING_CONTRACT", &cfg.EIP712.VerifyingContract)
+
+	setBool("LIT_ALLOW_LEGACY_SIGNERS", &cfg.Lit.AllowLegacySigners)
+	setDuration("CHALLENGE_TTL", &cfg.Challenges.TTL)
+	setInt("CHALLENGE_RATE_LIMIT", &cfg.Challenges.RateLimit)
+	setDuration("CHALLENGE_RATE_WINDOW", &cfg.Challenges.RateWindow)
+	setBool("CHALLENGE_ALLOW_LEGACY_NONCES", &cfg.Challenges.AllowLegacyNonces)
+
+	setString("PURCHASE_MANAGER_ADDRESS", &cfg.Purchases.PurchaseManager)
+	setDuration("PURCHASE_CACHE_TTL", &cfg.Purchases.CacheTTL)
+
+	setDuration("ACL_CACHE_TTL", &cfg.ACL.CacheTTL)
+
+	setBool("INDEXER_ENABLED", &cfg.Indexer.Enabled)
+	setDuration("INDEXER_POLL_INTERVAL", &cfg.Indexer.PollInterval)
+	setUint64("INDEXER_CONFIRMATIONS", &cfg.Indexer.Confirmations)
+	setUint64("INDEXER_BATCH_SIZE", &cfg.Indexer.BatchSize)
+
+	setDuration("SESSION_TTL", &cfg.Sessions.TTL)
+	// SESSION_KEYS is a list of id:privateKey pairs, signing key first
+	if v, ok := os.LookupEnv("SESSION_KEYS"); ok && v != "" {
+		cfg.Sessions.Keys = nil
+		for i, item := range splitList(v) {
+			id, key, found := strings.Cut(item, ":")
+			if !found {
+				errs = append(errs, fmt.Errorf("SESSION_KEYS: entry %d must be id:privateKey", i))
+				continue
+			}
+			cfg.Sessions.Keys = append(cfg.Sessions.Keys, SessionKeyConfig{ID: id, PrivateKey: key})
+		}
+	}
+
+	// The webapp's variable is accepted so both can share an environment file
+	setString("NEXT_PUBLIC_PRIVY_APP_ID", &cfg.Privy.AppID)
+	setString("PRIVY_APP_ID", &cfg.Privy.AppID)
+	setString("PRIVY_JWKS", &cfg.Privy.JWKS)
+	setDuration("PRIVY_JWKS_CACHE_TTL", &cfg.Privy.CacheTTL)
+
+	return errors.Join(errs...)
+}
+
+// Validate checks that all required settings are present and that every
+// value is within range. All problems are reported together.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port: must be between 1 and 65535, got %d", c.Server.Port))
+	}
+	switch c.Server.Env {
+	case "development", "test", "staging", "production":
+	default:
+		errs = append(errs, fmt.Errorf("server.env: must be one of development, test, staging, production, got %q", c.Server.Env))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("server.shutdownTimeout: must be positive"))
+	}
+
+	if c.Redis.URL == "" {
+		errs = append(errs, fmt.Errorf("redis.url: is required (REDIS_URL)"))
+	} else if _, err := url.Parse(c.Redis.URL); err != nil {
+		errs = append(errs, fmt.Errorf("redis.url: invalid URL"))
+	}
+
+	if c.Database.URL == "" {
+		errs = append(errs, fmt.Errorf("database.url: is required (DATABASE_URL)"))
+	}
+	if c.Database.MaxOpenConns < 1 {
+		errs = append(errs, fmt.Errorf("database.maxOpenConns: must be at least 1, got %d", c.Database.MaxOpenConns))
+	}
+	if c.Database.MaxIdleConns < 0 {
+		errs = append(errs, fmt.Errorf("database.maxIdleConns: must not be negative, got %d", c.Database.MaxIdleConns))
+	}
+	if c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		errs = append(errs, fmt.Errorf("database.maxIdleConns: must not exceed maxOpenConns (%d)", c.Database.MaxOpenConns))
+	}
+	if c.Database.ConnMaxLifetime < 0 {
+		errs = append(errs, fmt.Errorf("database.connMaxLifetime: must not be negative"))
+	}
+
+	switch c.Links.Provider {
+	case "storj", "gateway":
+		if c.Storj.AccessGrant == "" {
+			errs = append(errs, fmt.Errorf("storj.accessGrant: is required (LINK_SHARE_ACCESS_GRANT)"))
+		}
+		if c.Storj.Bucket == "" {
+			errs = append(errs, fmt.Errorf("storj.bucket: is required (S3_VIDEO_BUCKET)"))
+		}
+	case "s3":
+		// links.s3 is validated below
+	case "local":
+		if c.Links.Local.Dir == "" {
+			errs = append(errs, fmt.Errorf("links.local.dir: is required (LOCAL_MEDIA_DIR)"))
+		}
+		if u, err := url.Parse(c.Links.Local.BaseURL); err != nil || u.Host == "" {
+			errs = append(errs, fmt.Errorf("links.local.baseUrl: is required and must be a URL (LOCAL_MEDIA_BASE_URL)"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("links.provider: must be one of storj, s3, local, gateway, got %q", c.Links.Provider))
+	}
+	// The storj and gateway providers presign downloads through links.s3 when it is set
+	if c.Links.Provider == "s3" || (c.Links.S3.Endpoint != "" && (c.Links.Provider == "storj" || c.Links.Provider == "gateway")) {
+		if u, err := url.Parse(c.Links.S3.Endpoint); err != nil || u.Host == "" {
+			errs = append(errs, fmt.Errorf("links.s3.endpoint: is required and must be a URL (S3_ENDPOINT)"))
+		}
+		if c.Links.S3.Region == "" {
+			errs = append(errs, fmt.Errorf("links.s3.region: is required (S3_REGION)"))
+		}
+		if c.Links.S3.Bucket == "" {
+			errs = append(errs, fmt.Errorf("links.s3.bucket: is required (S3_BUCKET)"))
+		}
+		if c.Links.S3.AccessKeyID == "" || c.Links.S3.SecretAccessKey == "" {
+			errs = append(errs, fmt.Errorf("links.s3: accessKeyId and secretAccessKey are required (S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY)"))
+		}
+	}
+	// Both serve rewritten playlists
+	if c.Links.Provider == "gateway" || c.Links.Provider == "s3" {
+		if u, err := url.Parse(c.Links.Gateway.BaseURL); err != nil || u.Host == "" {
+			errs = append(errs, fmt.Errorf("links.gateway.baseUrl: is required and must be a URL (GATEWAY_BASE_URL)"))
+		}
+		if _, err := c.Links.Gateway.Key(); err != nil {
+			errs = append(errs, fmt.Errorf("links.gateway.signingKey: %v (GATEWAY_SIGNING_KEY)", err))
+		}
+		if c.Links.Gateway.PlaylistTTL <= 0 {
+			errs = append(errs, fmt.Errorf("links.gateway.playlistTtl: must be positive"))
+		}
+		if c.Links.Gateway.SegmentTTL <= 0 {
+			errs = append(errs, fmt.Errorf("links.gateway.segmentTtl: must be positive"))
+		}
+	}
+	if c.Proxy.SigningKey != "" {
+		if _, err := c.Proxy.Key(); err != nil {
+			errs = append(errs, fmt.Errorf("proxy.signingKey: %v (PROXY_SIGNING_KEY)", err))
+		}
+		if u, err := url.Parse(c.Proxy.BaseURL); err != nil || u.Host == "" {
+			errs = append(errs, fmt.Errorf("proxy.baseUrl: is required and must be a URL when proxy.signingKey is set (PROXY_BASE_URL)"))
+		}
+		if c.Storj.AccessGrant == "" || c.Storj.Bucket == "" {
+			errs = append(errs, fmt.Errorf("proxy: storj.accessGrant and storj.bucket are required when proxy.signingKey is set"))
+		}
+	}
+	if c.Keys.MasterKey != "" {
+		if _, err := c.Keys.Master(); err != nil {
+			errs = append(errs, fmt.Errorf("keys.masterKey: %v (CONTENT_KEY_MASTER_KEY)", err))
+		}
+		if u, err := url.Parse(c.Keys.BaseURL); err != nil || u.Host == "" {
+			errs = append(errs, fmt.Errorf("keys.baseUrl: is required and must be a URL when keys.masterKey is set (KEY_BASE_URL)"))
+		}
+		if len(c.Sessions.Keys) == 0 {
+			errs = append(errs, fmt.Errorf("keys: sessions.keys are required when keys.masterKey is set"))
+		}
+	}
+	if c.Keys.RateLimit < 1 {
+		errs = append(errs, fmt.Errorf("keys.rateLimit: must be at least 1, got %d", c.Keys.RateLimit))
+	}
+	if c.Keys.RateWindow < Duration(time.Second) {
+		errs = append(errs, fmt.Errorf("keys.rateWindow: must be at least 1s"))
+	}
+	if u, err := url.Parse(c.Metadata.IPFSGateway); err != nil || u.Host == "" {
+		errs = append(errs, fmt.Errorf("metadata.ipfsGateway: must be a URL (IPFS_GATEWAY)"))
+	}
+	if c.Metadata.MaxAge < 0 {
+		errs = append(errs, fmt.Errorf("metadata.maxAge: must not be negative"))
+	}
+	if c.Links.MinExpiration < Duration(time.Minute) {
+		errs = append(errs, fmt.Errorf("links.minExpiration: must be at least 1m"))
+	}
+	if c.Links.DownloadExpiration < c.Links.MinExpiration {
+		errs = append(errs, fmt.Errorf("links.downloadExpiration: must not be less than links.minExpiration"))
+	}
+	for _, field := range []struct {
+		name       string
+		expiration Duration
+	}{
+		{"public", c.Links.Expiration.Public},
+		{"protected", c.Links.Expiration.Protected},
+	} {
+		if field.expiration < c.Links.MinExpiration {
+			errs = append(errs, fmt.Errorf("links.expiration.%s: must not be less than links.minExpiration", field.name))
+		}
+	}
+	if c.Links.CacheMargin < 0 {
+		errs = append(errs, fmt.Errorf("links.cacheMargin: must not be negative"))
+	}
+
+	// Every SIWE message would fail the domain check
+	if len(c.SIWE.Domains) == 0 {
+		errs = append(errs, fmt.Errorf("siwe.domains: is required (SIWE_DOMAINS)"))
+	}
+	for _, domain := range c.SIWE.Domains {
+		if strings.TrimSpace(domain) == "" || strings.Contains(domain, "/") {
+			errs = append(errs, fmt.Errorf("siwe.domains: must be host[:port] authorities, got %q", domain))
+		}
+	}
+	for _, id := range c.SIWE.ChainIDs {
+		if id <= 0 {
+			errs = append(errs, fmt.Errorf("siwe.chainIds: must be positive, got %d", id))
+		}
+	}
+	if c.SIWE.MaxAge <= 0 {
+		errs = append(errs, fmt.Errorf("siwe.maxAge: must be positive"))
+	}
+	if c.SIWE.ClockSkew < 0 {
+		errs = append(errs, fmt.Errorf("siwe.clockSkew: must not be negative"))
+	}
+
+	if c.Ethereum.RPCURL != "" {
+		if u, err := url.Parse(c.Ethereum.RPCURL); err != nil || u.Host == "" {
+			errs = append(errs, fmt.Errorf("ethereum.rpcUrl: invalid URL"))
+		}
+	}
+	if c.Ethereum.RPCTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("ethereum.rpcTimeout: must be positive"))
+	}
+	if c.Ethereum.HealthCheckInterval <= 0 {
+		errs = append(errs, fmt.Errorf("ethereum.healthCheckInterval: must be positive"))
+	}
+	if c.Ethereum.FailureCooldown < 0 {
+		errs = append(errs, fmt.Errorf("ethereum.failureCooldown: must not be negative"))
+	}
+
+	names := make(map[string]bool)
+	ids := make(map[int64]bool)
+	for i, chain := range c.Chains {
+		key := fmt.Sprintf("chains[%d]", i)
+		if chain.Name == "" {
+			errs = append(errs, fmt.Errorf("%s.name: is required", key))
+		} else if names[chain.Name] {
+			errs = append(errs, fmt.Errorf("%s.name: duplicate chain %q", key, chain.Name))
+		}
+		names[chain.Name] = true
+
+		if chain.ID <= 0 {
+			errs = append(errs, fmt.Errorf("%s.id: must be positive, got %d", key, chain.ID))
+		} else if ids[chain.ID] {
+			errs = append(errs, fmt.Errorf("%s.id: duplicate chain ID %d", key, chain.ID))
+		}
+		ids[chain.ID] = true
+
+		for _, rpcURL := range chain.RPCURLs {
+			if u, err := url.Parse(rpcURL); err != nil || u.Host == "" {
+				errs = append(errs, fmt.Errorf("%s.rpcUrls: invalid URL", key))
+			}
+		}
+		for _, field := range []struct{ name, address string }{
+			{"videoNft", chain.VideoNFT},
+			{"purchaseManager", chain.PurchaseManager},
+			{"usdc", chain.USDC},
+		} {
+			if field.address != "" && !isHexAddress(field.address) {
+				errs = append(errs, fmt.Errorf("%s.%s: invalid address %q", key, field.name, field.address))
+			}
+		}
+	}
+	if !names[c.Ethereum.Chain] {
+		errs = append(errs, fmt.Errorf("ethereum.chain: %q is not a configured chain", c.Ethereum.Chain))
+	}
+
+	if c.EIP712.VerifyingContract != "" {
+		if !isHexAddress(c.EIP712.VerifyingContract) {
+			errs = append(errs, fmt.Errorf("eip712.verifyingContract: invalid address %q", c.EIP712.VerifyingContract))
+		}
+		if c.EIP712.ChainID <= 0 {
+			errs = append(errs, fmt.Errorf("eip712.chainId: is required when eip712.verifyingContract is set"))
+		}
+		if c.EIP712.Name == "" || c.EIP712.Version == "" {
+			errs = append(errs, fmt.Errorf("eip712: name and version are required"))
+		}
+	}
+
+	if c.Challenges.TTL <= 0 {
+		errs = append(errs, fmt.Errorf("challenges.ttl: must be positive"))
+	}
+	if c.Challenges.RateLimit < 1 {
+		errs = append(errs, fmt.Errorf("challenges.rateLimit: must be at least 1, got %d", c.Challenges.RateLimit))
+	}
+	if c.Challenges.RateWindow < Duration(time.Second) {
+		errs = append(errs, fmt.Errorf("challenges.rateWindow: must be at least 1s"))
+	}
+
+	if c.Purchases.PurchaseManager != "" {
+		if !isHexAddress(c.Purchases.PurchaseManager) {
+			errs = append(errs, fmt.Errorf("purchases.purchaseManager: invalid address %q", c.Purchases.PurchaseManager))
+		}
+	}
+	if c.Purchases.CacheTTL <= 0 {
+		errs = append(errs, fmt.Errorf("purchases.cacheTtl: must be positive"))
+	}
+
+	if c.ACL.CacheTTL <= 0 {
+		errs = append(errs, fmt.Errorf("acl.cacheTtl: must be positive"))
+	}
+
+	if c.Indexer.PollInterval <= 0 {
+		errs = append(errs, fmt.Errorf("indexer.pollInterval: must be positive"))
+	}
+	if c.Indexer.BatchSize < 1 {
+		errs = append(errs, fmt.Errorf("indexer.batchSize: must be at least 1, got %d", c.Indexer.BatchSize))
+	}
+
+	if c.Sessions.TTL <= 0 {
+		errs = append(errs, fmt.Errorf("sessions.ttl: must be positive"))
+	}
+	keyIDs := make(map[string]bool)
+	for i, key := range c.Sessions.Keys {
+		if key.ID == "" {
+			errs = append(errs, fmt.Errorf("sessions.keys[%d].id: is required", i))
+		} else if keyIDs[key.ID] {
+			errs = append(errs, fmt.Errorf("sessions.keys[%d].id: duplicate key %q", i, key.ID))
+		}
+		keyIDs[key.ID] = true
+		if _, err := key.Ed25519(); err != nil {
+			errs = append(errs, fmt.Errorf("sessions.keys[%d].privateKey: %v", i, err))
+		}
+	}
+
+	if strings.HasPrefix(c.Privy.JWKS, "http://") || strings.HasPrefix(c.Privy.JWKS, "https://") {
+		if u, err := url.Parse(c.Privy.JWKS); err != nil || u.Host == "" {
+			errs = append(errs, fmt.Errorf("privy.jwks: invalid URL"))
+		}
+	}
+	if c.Privy.JWKS != "" && c.Privy.AppID == "" {
+		errs = append(errs, fmt.Errorf("privy.appId: is required when privy.jwks is set"))
+	}
+	if c.Privy.CacheTTL <= 0 {
+		errs = append(errs, fmt.Errorf("privy.cacheTtl: must be positive"))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Redacted returns a copy of the configuration with secrets removed,
+// suitable for logging or printing.
+func (c Config) Redacted() Config {
+	c.Redis.URL = redactURL(c.Redis.URL)
+	c.Database.URL = redactURL(c.Database.URL)
+	c.Storj.AccessGrant = redactSecret(c.Storj.AccessGrant)
+	c.Links.S3.SecretAccessKey = redactSecret(c.Links.S3.SecretAccessKey)
+	c.Links.Gateway.SigningKey = redactSecret(c.Links.Gateway.SigningKey)
+	c.Proxy.SigningKey = redactSecret(c.Proxy.SigningKey)
+	c.Keys.MasterKey = redactSecret(c.Keys.MasterKey)
+	c.Ethereum.RPCURL = redactURLPath(c.Ethereum.RPCURL)
+	chains := make([]ChainConfig, len(c.Chains))
+	for i, chain := range c.Chains {
+		chain.RPCURLs = make([]string, len(c.Chains[i].RPCURLs))
+		for j, rpcURL := range c.Chains[i].RPCURLs {
+			chain.RPCURLs[j] = redactURLPath(rpcURL)
+		}
+		chains[i] = chain
+	}
+	c.Chains = chains
+	keys := make([]SessionKeyConfig, len(c.Sessions.Keys))
+	for i, key := range c.Sessions.Keys {
+		key.PrivateKey = redactSecret(key.PrivateKey)
+		keys[i] = key
+	}
+	c.Sessions.Keys = keys
+	return c
+}
+
+// ChainConfigs returns the configured chains with ethereum.rpcUrl, if set,
+// added as the first RPC URL of the default chain.
+func (c *Config) ChainConfigs() []ChainConfig {
+	chains := make([]ChainConfig, len(c.Chains))
+	copy(chains, c.Chains)
+	if c.Ethereum.RPCURL == "" {
+		return chains
+	}
+	for i := range chains {
+		if chains[i].Name == c.Ethereum.Chain {
+			chains[i].RPCURLs = append([]string{c.Ethereum.RPCURL}, chains[i].RPCURLs...)
+		}
+	}
+	return chains
+}
+
+// DefaultChain returns the configuration of the default chain.
+func (c *Config) DefaultChain() ChainConfig {
+	for _, chain := range c.ChainConfigs() {
+		if chain.Name == c.Ethereum.Chain {
+			return chain
+		}
+	}
+	return ChainConfig{Name: c.Ethereum.Chain}
+}
+
+// PurchaseManager returns the address of the PurchaseManager on the default chain:
+// purchases.purchaseManager if set, or the default chain's. It is empty if neither is set.
+func (c *Config) PurchaseManager() string {
+	if c.Purchases.PurchaseManager != "" {
+		return c.Purchases.PurchaseManager
+	}
+	return c.DefaultChain().PurchaseManager
+}
+
+// YAML renders the configuration as YAML.
+func (c Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// isHexAddress reports whether s is a 0x-prefixed 20-byte hex address.
+func isHexAddress(s string) bool {
+	if len(s) != 42 || !strings.HasPrefix(s, "0x") {
+		return false
+	}
+	for _, c := range s[2:] {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// envName converts a camelCase chain name to an environment variable prefix,
+// e.g. "baseSepolia" to "BASE_SEPOLIA".
+func envName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			b.WriteByte('_')
+		}
+		b.WriteRune(r)
+	}
+	return strings.ToUpper(b.String())
+}
+
+// splitList splits a comma-separated environment value, dropping empty items.
+func splitList(v string) []string {
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// redactURL hides the password portion of a connection URL.
+func redactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	return u.Redacted()
+}
+
+// redactURLPath hides everything after the host of a URL, where RPC
+// providers usually embed their API keys.
+func redactURLPath(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return redacted
+	}
+	return u.Scheme + "://" + u.Host + "/" + redacted
+}
+
+// redactSecret hides a secret while still showing whether it is set.
+func redactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
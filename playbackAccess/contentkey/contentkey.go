@@ -0,0 +1,76 @@
+// Package contentkey wraps the AES-128 content keys of encrypted HLS renditions
+// under a master key, so that the keys at rest in the database are useless
+// without the service's configuration, and signs the key URIs of their playlists.
+package contentkey
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Size is the size of a content key: HLS AES-128 keys are 16 bytes.
+const Size = 16
+
+// MasterKeySize is the size of the master key (AES-256).
+const MasterKeySize = 32
+
+// ErrUnwrap is returned when a wrapped key was not wrapped under the master key
+// for the same video and key ID, or has been tampered with.
+var ErrUnwrap = errors.New("content key cannot be unwrapped")
+
+// Wrap encrypts key under master with AES-256-GCM. The result is the random nonce
+// followed by the sealed key, and only unwraps for the same tokenId and keyId.
+func Wrap(master []byte, tokenId, keyId string, key []byte) ([]byte, error) {
+	if len(key) != Size {
+		return nil, fmt.Errorf("content key must be %d bytes, got %d", Size, len(key))
+	}
+	aead, err := newAEAD(master)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, key, additionalData(tokenId, keyId)), nil
+}
+
+// Unwrap decrypts a key wrapped by Wrap.
+func Unwrap(master []byte, tokenId, keyId string, wrapped []byte) ([]byte, error) {
+	aead, err := newAEAD(master)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrUnwrap
+	}
+
+	nonce, sealed := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	key, err := aead.Open(nil, nonce, sealed, additionalData(tokenId, keyId))
+	if err != nil || len(key) != Size {
+		return nil, ErrUnwrap
+	}
+	return key, nil
+}
+
+// newAEAD returns AES-256-GCM under master.
+func newAEAD(master []byte) (cipher.AEAD, error) {
+	if len(master) != MasterKeySize {
+		return nil, fmt.Errorf("master key must be %d bytes, got %d", MasterKeySize, len(master))
+	}
+	block, err := aes.NewCipher(master)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// additionalData binds a wrapped key to its video and key ID, so that a key
+// copied to another row does not unwrap.
+func additionalData(tokenId, keyId string) []byte {
+	return []byte("hls-key\n" + tokenId + "\n" + keyId)
+}
@@ -0,0 +1,84 @@
+package contentkey
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrTokenInvalid is returned for key tokens that are malformed or not signed by this service.
+	ErrTokenInvalid = errors.New("invalid key token")
+	// ErrTokenExpired is returned for key tokens past their expiry.
+	ErrTokenExpired = errors.New("key token expired")
+)
+
+// URISigner adds short-lived tokens to the key URIs of encrypted playlists served
+// by this service, for players that cannot send a session with key requests, such
+// as native HLS players. A token lets its holder fetch one key until it expires.
+// Tokens name the video whose playlist the URI was found in, and keys are released
+// only for that video, so a playlist cannot refer to other videos' keys. Tokens
+// are signed with a key derived from the master key.
+type URISigner struct {
+	key []byte
+	// prefix is the key server's URL, ending in a slash
+	prefix string
+}
+
+// NewURISigner returns a signer for the key URIs below baseURL, the key server's
+// public URL.
+func NewURISigner(master []byte, baseURL string) *URISigner {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte("hls-key-token"))
+	return &URISigner{key: mac.Sum(nil), prefix: strings.TrimSuffix(baseURL, "/") + "/"}
+}
+
+// Sign returns uri with a token for the video with videoId that expires at exp.
+// It returns false for URIs other than the key server's, and on a nil URISigner.
+func (s *URISigner) Sign(videoId, uri string, exp time.Time) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	rest, ok := strings.CutPrefix(uri, s.prefix)
+	if !ok || strings.ContainsAny(rest, "?#") {
+		return "", false
+	}
+	tokenId, keyId, ok := strings.Cut(rest, "/")
+	if !ok || tokenId == "" || keyId == "" {
+		return "", false
+	}
+
+	query := url.Values{
+		"vid": {videoId},
+		"exp": {strconv.FormatInt(exp.Unix(), 10)},
+		"sig": {base64.RawURLEncoding.EncodeToString(s.signature(videoId, tokenId, keyId, exp.Unix()))},
+	}
+	return uri + "?" + query.Encode(), true
+}
+
+// Verify checks the token in query of a request for the key keyId of the video
+// with tokenId, and returns the ID of the video it was issued for.
+func (s *URISigner) Verify(tokenId, keyId string, query url.Values, now time.Time) (string, error) {
+	videoId := query.Get("vid")
+	exp, errExp := strconv.ParseInt(query.Get("exp"), 10, 64)
+	sig, errSig := base64.RawURLEncoding.DecodeString(query.Get("sig"))
+	if videoId == "" || errExp != nil || errSig != nil || !hmac.Equal(sig, s.signature(videoId, tokenId, keyId, exp)) {
+		return "", ErrTokenInvalid
+	}
+	if now.Unix() >= exp {
+		return "", ErrTokenExpired
+	}
+	return videoId, nil
+}
+
+// signature returns the HMAC of a key token's video, key and expiry.
+func (s *URISigner) signature(videoId, tokenId, keyId string, exp int64) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(strings.Join([]string{"key", videoId, tokenId, keyId, strconv.FormatInt(exp, 10)}, "\n")))
+	return mac.Sum(nil)
+}
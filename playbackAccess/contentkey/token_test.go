@@ -0,0 +1,60 @@
+package contentkey
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestURISigner(t *testing.T) {
+	signer := NewURISigner(make([]byte, MasterKeySize), "https://api.test/v1/keys/")
+	now := time.Now()
+
+	signed, ok := signer.Sign("video-42", "https://api.test/v1/keys/42/k1", now.Add(time.Minute))
+	if !ok {
+		t.Fatal("Sign of a key URI = false")
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/v1/keys/42/k1" {
+		t.Fatalf("signed URI %s changes the path", signed)
+	}
+
+	if videoId, err := signer.Verify("42", "k1", u.Query(), now); err != nil || videoId != "video-42" {
+		t.Fatalf("Verify = %q, %v; want video-42", videoId, err)
+	}
+	// Tokens cover one key and expire
+	if _, err := signer.Verify("42", "k2", u.Query(), now); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("Verify for another key = %v, want ErrTokenInvalid", err)
+	}
+	if _, err := signer.Verify("43", "k1", u.Query(), now); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("Verify for another video = %v, want ErrTokenInvalid", err)
+	}
+	query := u.Query()
+	query.Set("vid", "video-43")
+	if _, err := signer.Verify("42", "k1", query, now); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("Verify with another vid = %v, want ErrTokenInvalid", err)
+	}
+	if _, err := signer.Verify("42", "k1", u.Query(), now.Add(time.Minute)); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Verify after expiry = %v, want ErrTokenExpired", err)
+	}
+	other := NewURISigner([]byte(strings.Repeat("k", MasterKeySize)), "https://api.test/v1/keys/")
+	if _, err := other.Verify("42", "k1", u.Query(), now); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("Verify under another master key = %v, want ErrTokenInvalid", err)
+	}
+
+	// Only the key server's URIs are signed
+	for _, uri := range []string{"https://keys.example.com/42/k1", "https://api.test/v1/keys/42", "https://api.test/v1/keys/42/k1?x=1", "key.bin"} {
+		if _, ok := signer.Sign("video-42", uri, now.Add(time.Minute)); ok {
+			t.Errorf("Sign(%q) = true", uri)
+		}
+	}
+	var disabled *URISigner
+	if _, ok := disabled.Sign("video-42", "https://api.test/v1/keys/42/k1", now.Add(time.Minute)); ok {
+		t.Error("Sign of a nil URISigner = true")
+	}
+}
@@ -0,0 +1,109 @@
+// Package contracts provides minimal read-only bindings for the Loop contracts
+// and the token standards that access conditions refer to.
+package contracts
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var purchaseManagerABI = mustParseABI(`[{
+	"name": "hasPurchasedVideo",
+	"type": "function",
+	"stateMutability": "view",
+	"inputs": [{"name": "tokenId", "type": "uint256"}, {"name": "purchaser", "type": "address"}],
+	"outputs": [{"name": "", "type": "bool"}]
+}, {
+	"name": "VideoPurchased",
+	"type": "event",
+	"anonymous": false,
+	"inputs": [
+		{"name": "tokenId", "type": "uint256", "indexed": true},
+		{"name": "purchaser", "type": "address", "indexed": true}
+	]
+}]`)
+
+// VideoPurchasedTopic is the topic of VideoPurchased(uint256 indexed tokenId, address indexed purchaser) logs.
+var VideoPurchasedTopic = purchaseManagerABI.Events["VideoPurchased"].ID
+
+// VideoPurchased is a decoded VideoPurchased log.
+type VideoPurchased struct {
+	TokenId   *big.Int
+	Purchaser common.Address
+	Raw       types.Log
+}
+
+// PurchaseManager reads purchase records from a deployed PurchaseManager contract.
+type PurchaseManager struct {
+	address common.Address
+	caller  ethereum.ContractCaller
+}
+
+// NewPurchaseManager returns a binding for the PurchaseManager at address.
+// Any JSON-RPC client (ethclient.Client) or go-ethereum's simulated backend can be used as caller.
+func NewPurchaseManager(address common.Address, caller ethereum.ContractCaller) *PurchaseManager {
+	return &PurchaseManager{address: address, caller: caller}
+}
+
+// Address returns the address of the contract.
+func (pm *PurchaseManager) Address() common.Address {
+	return pm.address
+}
+
+// HasPurchasedVideo reports whether purchaser has bought the video with tokenId.
+func (pm *PurchaseManager) HasPurchasedVideo(ctx context.Context, tokenId *big.Int, purchaser common.Address) (bool, error) {
+	var purchased bool
+	if err := call(ctx, pm.caller, purchaseManagerABI, pm.address, &purchased, "hasPurchasedVideo", tokenId, purchaser); err != nil {
+		return false, err
+	}
+	return purchased, nil
+}
+
+// ParseVideoPurchased decodes a VideoPurchased log emitted by any PurchaseManager.
+func ParseVideoPurchased(log types.Log) (*VideoPurchased, error) {
+	if len(log.Topics) != 3 || log.Topics[0] != VideoPurchasedTopic {
+		return nil, fmt.Errorf("log %s:%d is not a VideoPurchased event", log.TxHash.Hex(), log.Index)
+	}
+	return &VideoPurchased{
+		TokenId:   new(big.Int).SetBytes(log.Topics[1].Bytes()),
+		Purchaser: common.BytesToAddress(log.Topics[2].Bytes()),
+		Raw:       log,
+	}, nil
+}
+
+// call packs and executes a read-only call of method on the contract at address
+// and unpacks its single return value into out, which must point to a value of the matching type.
+func call(ctx context.Context, caller ethereum.ContractCaller, contractABI abi.ABI, address common.Address, out interface{}, method string, args ...interface{}) error {
+	data, err := contractABI.Pack(method, args...)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s call: %w", method, err)
+	}
+
+	result, err := caller.CallContract(ctx, ethereum.CallMsg{To: &address, Data: data}, nil)
+	if err != nil {
+		return fmt.Errorf("%s call to %s failed: %w", method, address.Hex(), err)
+	}
+	if len(result) == 0 {
+		return fmt.Errorf("%s call to %s returned no data; is a contract deployed there?", method, address.Hex())
+	}
+
+	if err := contractABI.UnpackIntoInterface(out, method, result); err != nil {
+		return fmt.Errorf("failed to decode %s result: %w", method, err)
+	}
+	return nil
+}
+
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
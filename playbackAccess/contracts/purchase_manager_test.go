@@ -0,0 +1,57 @@
+package contracts
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/loop/playbackAccess/internal/evmtest"
+)
+
+func TestHasPurchasedVideo(t *testing.T) {
+	purchaseManager := common.HexToAddress("0x00000000000000000000000000000000000000b0")
+	buyer := common.HexToAddress("0x00000000000000000000000000000000000000b1")
+	stranger := common.HexToAddress("0x00000000000000000000000000000000000000b2")
+	tokenId := big.NewInt(42)
+
+	backend := simulated.NewBackend(types.GenesisAlloc{
+		purchaseManager: {
+			Code:    evmtest.PurchaseManager(),
+			Storage: map[common.Hash]common.Hash{evmtest.PurchaseSlot(tokenId, buyer): evmtest.Purchased},
+			Balance: big.NewInt(0),
+		},
+	})
+	t.Cleanup(func() { backend.Close() })
+	pm := NewPurchaseManager(purchaseManager, backend.Client())
+
+	tests := []struct {
+		name      string
+		tokenId   *big.Int
+		purchaser common.Address
+		want      bool
+	}{
+		{"buyer", tokenId, buyer, true},
+		{"buyer, other video", big.NewInt(43), buyer, false},
+		{"stranger", tokenId, stranger, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pm.HasPurchasedVideo(context.Background(), tt.tokenId, tt.purchaser)
+			if err != nil {
+				t.Fatalf("HasPurchasedVideo: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("HasPurchasedVideo = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Calls to an address without code fail instead of reporting no purchase
+	empty := NewPurchaseManager(common.HexToAddress("0x00000000000000000000000000000000000000b3"), backend.Client())
+	if _, err := empty.HasPurchasedVideo(context.Background(), tokenId, buyer); err == nil {
+		t.Fatal("HasPurchasedVideo of an address without code succeeded")
+	}
+}
@@ -0,0 +1,72 @@
+package contracts
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Token standards supported by Token.
+const (
+	ERC20   = "ERC20"
+	ERC721  = "ERC721"
+	ERC1155 = "ERC1155"
+)
+
+// erc20ABI also covers ERC-721, whose balanceOf has the same signature.
+var erc20ABI = mustParseABI(`[{
+	"name": "balanceOf",
+	"type": "function",
+	"stateMutability": "view",
+	"inputs": [{"name": "owner", "type": "address"}],
+	"outputs": [{"name": "", "type": "uint256"}]
+}]`)
+
+var erc1155ABI = mustParseABI(`[{
+	"name": "balanceOf",
+	"type": "function",
+	"stateMutability": "view",
+	"inputs": [{"name": "account", "type": "address"}, {"name": "id", "type": "uint256"}],
+	"outputs": [{"name": "", "type": "uint256"}]
+}]`)
+
+// Token reads balances from an ERC-20, ERC-721 or ERC-1155 contract.
+type Token struct {
+	standard string
+	address  common.Address
+	caller   ethereum.ContractCaller
+}
+
+// NewToken returns a binding for the token contract at address implementing standard,
+// which must be one of ERC20, ERC721 or ERC1155.
+func NewToken(standard string, address common.Address, caller ethereum.ContractCaller) (*Token, error) {
+	switch standard {
+	case ERC20, ERC721, ERC1155:
+	default:
+		return nil, fmt.Errorf("unsupported token standard %q", standard)
+	}
+	return &Token{standard: standard, address: address, caller: caller}, nil
+}
+
+// BalanceOf returns the balance of owner. For ERC-1155 tokens it is the balance of
+// token id; ERC-20 and ERC-721 balances count every token and ignore id.
+func (t *Token) BalanceOf(ctx context.Context, owner common.Address, id *big.Int) (*big.Int, error) {
+	var balance *big.Int
+	if t.standard == ERC1155 {
+		if id == nil {
+			return nil, fmt.Errorf("ERC1155 balanceOf requires a token id")
+		}
+		if err := call(ctx, t.caller, erc1155ABI, t.address, &balance, "balanceOf", owner, id); err != nil {
+			return nil, err
+		}
+		return balance, nil
+	}
+
+	if err := call(ctx, t.caller, erc20ABI, t.address, &balance, "balanceOf", owner); err != nil {
+		return nil, err
+	}
+	return balance, nil
+}
@@ -5,10 +5,9 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"os"
-	"strconv"
 	"strings"
 	"time"
 
@@ -16,6 +15,9 @@ import (
 	"github.com/loop/playbackAccess/model"
 )
 
+// ErrVideoNotFound is returned when no ready video has the requested token ID.
+var ErrVideoNotFound = errors.New("video not found")
+
 // Config holds database connection pool settings
 type Config struct {
 	MaxOpenConns    int
@@ -23,27 +25,17 @@ type Config struct {
 	ConnMaxLifetime time.Duration
 }
 
-// DefaultConfig returns the default database configuration
-func DefaultConfig() Config {
-	return Config{
-		MaxOpenConns:    25,
-		MaxIdleConns:    5,
-		ConnMaxLifetime: 5 * time.Minute,
-	}
-}
-
 // Client wraps the database client with additional context
 type Client struct {
 	db  *sql.DB
 	ctx context.Context
 }
 
-// NewClient initializes and returns a database client.
-// It reads the database URL from the DATABASE_URL environment variable.
-func NewClient() (*Client, error) {
-	connStr := os.Getenv("DATABASE_URL")
+// NewClient initializes and returns a database client for the given
+// connection string, applying the connection pool settings in config.
+func NewClient(connStr string, config Config) (*Client, error) {
 	if connStr == "" {
-		return nil, fmt.Errorf("DATABASE_URL environment variable is not set")
+		return nil, fmt.Errorf("database URL is not set")
 	}
 
 	// For local connections, disable SSL
@@ -62,24 +54,6 @@ func NewClient() (*Client, error) {
 		return nil, fmt.Errorf("error connecting to database: %w", err)
 	}
 
-	// Get configuration from environment variables or use defaults
-	config := DefaultConfig()
-	if maxOpen := os.Getenv("DB_MAX_OPEN_CONNS"); maxOpen != "" {
-		if n, err := strconv.Atoi(maxOpen); err == nil {
-			config.MaxOpenConns = n
-		}
-	}
-	if maxIdle := os.Getenv("DB_MAX_IDLE_CONNS"); maxIdle != "" {
-		if n, err := strconv.Atoi(maxIdle); err == nil {
-			config.MaxIdleConns = n
-		}
-	}
-	if maxLifetime := os.Getenv("DB_CONN_MAX_LIFETIME"); maxLifetime != "" {
-		if d, err := time.ParseDuration(maxLifetime); err == nil {
-			config.ConnMaxLifetime = d
-		}
-	}
-
 	// Apply connection pool settings
 	db.SetMaxOpenConns(config.MaxOpenConns)
 	db.SetMaxIdleConns(config.MaxIdleConns)
@@ -103,31 +77,64 @@ func (c *Client) GetVideoMetadata(tokenId string) (*model.VideoStore, error) {
 	query := `
 		SELECT 
 			v.metadata->>'visibility' as visibility,
-			v.metadata->>'isDownloadable' as is_downloadable,
+			COALESCE((v.metadata->>'isDownloadable')::boolean, false) as is_downloadable,
 			v.metadata->>'id' as id,
+			COALESCE(v.metadata->>'title', '') as title,
 			v.metadata->>'creator' as creator,
-			v.metadata->'playbackAccess' as playback_access
+			v.metadata->'sources' as sources,
+			v.metadata->'price' as price,
+			v.metadata->'coverImage' as cover_image,
+			COALESCE(v.metadata->>'previewUrl', '') as preview_url,
+			v.metadata->'playbackAccess' as playback_access,
+			COALESCE(v.metadata->>'deliveryMode', '') as delivery_mode
 		FROM videos v
 		WHERE v.token_id = $1 AND v.status = 'ready'
 	`
 
 	var videoStore model.VideoStore
-	var playbackAccessJSON []byte
+	var sourcesJSON, priceJSON, coverImageJSON, playbackAccessJSON []byte
 
 	err := c.db.QueryRowContext(c.ctx, query, tokenId).Scan(
 		&videoStore.Visibility,
 		&videoStore.IsDownloadable,
 		&videoStore.Id,
+		&videoStore.Title,
 		&videoStore.Creator,
+		&sourcesJSON,
+		&priceJSON,
+		&coverImageJSON,
+		&videoStore.PreviewUrl,
 		&playbackAccessJSON,
+		&videoStore.DeliveryMode,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("video not found for token ID: %s", tokenId)
+			return nil, fmt.Errorf("%w for token ID: %s", ErrVideoNotFound, tokenId)
 		}
 		return nil, fmt.Errorf("error querying video metadata: %w", err)
 	}
 
+	if len(sourcesJSON) > 0 {
+		if err := json.Unmarshal(sourcesJSON, &videoStore.Sources); err != nil {
+			return nil, fmt.Errorf("error parsing video sources: %w", err)
+		}
+	}
+
+	if len(priceJSON) > 0 && string(priceJSON) != "null" {
+		var price model.VideoPrice
+		if err := json.Unmarshal(priceJSON, &price); err != nil {
+			return nil, fmt.Errorf("error parsing video price: %w", err)
+		}
+		videoStore.Price = &price
+	}
+	if len(coverImageJSON) > 0 && string(coverImageJSON) != "null" {
+		var coverImage model.VideoCoverImage
+		if err := json.Unmarshal(coverImageJSON, &coverImage); err != nil {
+			return nil, fmt.Errorf("error parsing cover image: %w", err)
+		}
+		videoStore.CoverImage = &coverImage
+	}
+
 	// Parse playback access if present
 	if len(playbackAccessJSON) > 0 {
 		var playbackAccess model.VideoAccess
@@ -140,6 +147,20 @@ func (c *Client) GetVideoMetadata(tokenId string) (*model.VideoStore, error) {
 	return &videoStore, nil
 }
 
+// GetVideoStatus returns the processing status of the video with tokenId, e.g.
+// "ready", or ErrVideoNotFound if there is no such video.
+func (c *Client) GetVideoStatus(ctx context.Context, tokenId string) (string, error) {
+	var status string
+	err := c.db.QueryRowContext(ctx, `SELECT status FROM videos WHERE token_id = $1`, tokenId).Scan(&status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("%w for token ID: %s", ErrVideoNotFound, tokenId)
+		}
+		return "", fmt.Errorf("error querying video status: %w", err)
+	}
+	return status, nil
+}
+
 // Close closes the database connection.
 func (c *Client) Close() error {
 	return c.db.Close()
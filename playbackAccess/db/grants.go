@@ -0,0 +1,179 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/loop/playbackAccess/model"
+)
+
+// IndexedRange is the outcome of indexing a range of blocks, committed atomically
+// with CommitIndexedRange.
+type IndexedRange struct {
+	ChainId  int64
+	Contract string
+	// ToBlock is the last block of the range; it becomes the checkpoint
+	ToBlock uint64
+	Grants  []model.AccessGrant
+	// Blocks are the processed blocks that are not yet confirmed
+	Blocks []model.IndexedBlock
+	// Confirmed is the newest confirmed block; hashes of blocks up to it are no longer kept
+	Confirmed uint64
+}
+
+// HasAccessGrant reports whether address holds a grant for the video with tokenId on the chain.
+func (c *Client) HasAccessGrant(ctx context.Context, chainId int64, tokenId, address string) (bool, error) {
+	var exists bool
+	err := c.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM access_grants
+			WHERE chain_id = $1 AND token_id = $2 AND address = $3
+		)
+	`, chainId, tokenId, address).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error querying access grants: %w", err)
+	}
+	return exists, nil
+}
+
+// GetIndexerCheckpoint returns the progress of the indexer following contract,
+// or nil if it has not processed any block.
+func (c *Client) GetIndexerCheckpoint(ctx context.Context, chainId int64, contract string) (*model.IndexerCheckpoint, error) {
+	checkpoint := model.IndexerCheckpoint{ChainId: chainId, Contract: contract}
+	err := c.db.QueryRowContext(ctx, `
+		SELECT block_number FROM indexer_checkpoints
+		WHERE chain_id = $1 AND contract = $2
+	`, chainId, contract).Scan(&checkpoint.BlockNumber)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error querying indexer checkpoint: %w", err)
+	}
+
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT block_number, block_hash FROM indexer_blocks
+		WHERE chain_id = $1 AND contract = $2
+		ORDER BY block_number DESC
+	`, chainId, contract)
+	if err != nil {
+		return nil, fmt.Errorf("error querying indexed blocks: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var block model.IndexedBlock
+		if err := rows.Scan(&block.Number, &block.Hash); err != nil {
+			return nil, fmt.Errorf("error scanning indexed block: %w", err)
+		}
+		checkpoint.RecentBlocks = append(checkpoint.RecentBlocks, block)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error querying indexed blocks: %w", err)
+	}
+
+	return &checkpoint, nil
+}
+
+// CommitIndexedRange records the grants and blocks of an indexed range and
+// advances the checkpoint, in a single transaction. Grants that are already
+// recorded are kept.
+func (c *Client) CommitIndexedRange(ctx context.Context, r IndexedRange) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, g := range r.Grants {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO access_grants (chain_id, contract, token_id, address, block_number, block_hash, tx_hash, log_index)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (chain_id, tx_hash, log_index) DO NOTHING
+		`, g.ChainId, g.Contract, g.TokenId, g.Address, g.BlockNumber, g.BlockHash, g.TxHash, g.LogIndex); err != nil {
+			return fmt.Errorf("error inserting access grant: %w", err)
+		}
+	}
+
+	for _, b := range r.Blocks {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO indexer_blocks (chain_id, contract, block_number, block_hash)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (chain_id, contract, block_number) DO UPDATE SET block_hash = EXCLUDED.block_hash
+		`, r.ChainId, r.Contract, b.Number, b.Hash); err != nil {
+			return fmt.Errorf("error inserting indexed block: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM indexer_blocks
+		WHERE chain_id = $1 AND contract = $2 AND block_number <= $3
+	`, r.ChainId, r.Contract, r.Confirmed); err != nil {
+		return fmt.Errorf("error pruning indexed blocks: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO indexer_checkpoints (chain_id, contract, block_number)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (chain_id, contract) DO UPDATE SET block_number = EXCLUDED.block_number, updated_at = now()
+	`, r.ChainId, r.Contract, r.ToBlock); err != nil {
+		return fmt.Errorf("error updating indexer checkpoint: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing indexed range: %w", err)
+	}
+	return nil
+}
+
+// RollbackIndexer discards everything the indexer following contract recorded after
+// block toBlock and moves its checkpoint back to toBlock. It returns the removed grants.
+func (c *Client) RollbackIndexer(ctx context.Context, chainId int64, contract string, toBlock uint64) ([]model.AccessGrant, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		DELETE FROM access_grants
+		WHERE chain_id = $1 AND contract = $2 AND block_number > $3
+		RETURNING chain_id, contract, token_id::text, address, block_number, block_hash, tx_hash, log_index
+	`, chainId, contract, toBlock)
+	if err != nil {
+		return nil, fmt.Errorf("error removing access grants: %w", err)
+	}
+	var removed []model.AccessGrant
+	for rows.Next() {
+		var g model.AccessGrant
+		if err := rows.Scan(&g.ChainId, &g.Contract, &g.TokenId, &g.Address, &g.BlockNumber, &g.BlockHash, &g.TxHash, &g.LogIndex); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning access grant: %w", err)
+		}
+		removed = append(removed, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error removing access grants: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM indexer_blocks
+		WHERE chain_id = $1 AND contract = $2 AND block_number > $3
+	`, chainId, contract, toBlock); err != nil {
+		return nil, fmt.Errorf("error removing indexed blocks: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE indexer_checkpoints SET block_number = $3, updated_at = now()
+		WHERE chain_id = $1 AND contract = $2
+	`, chainId, contract, toBlock); err != nil {
+		return nil, fmt.Errorf("error updating indexer checkpoint: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing rollback: %w", err)
+	}
+	return removed, nil
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrContentKeyNotFound is returned when a video has no content key with the requested ID.
+var ErrContentKeyNotFound = errors.New("content key not found")
+
+// GetContentKey returns the wrapped content key keyId of the video with tokenId.
+func (c *Client) GetContentKey(ctx context.Context, tokenId, keyId string) ([]byte, error) {
+	var wrapped []byte
+	err := c.db.QueryRowContext(ctx, `
+		SELECT wrapped_key FROM content_keys
+		WHERE token_id = $1 AND key_id = $2
+	`, tokenId, keyId).Scan(&wrapped)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrContentKeyNotFound
+		}
+		return nil, fmt.Errorf("error querying content key: %w", err)
+	}
+	return wrapped, nil
+}
+
+// PutContentKey records the wrapped content key keyId of the video with tokenId.
+// Keys are immutable once segments have been encrypted with them, so an existing
+// key is kept and PutContentKey reports whether the key was recorded.
+func (c *Client) PutContentKey(ctx context.Context, tokenId, keyId string, wrapped []byte) (bool, error) {
+	result, err := c.db.ExecContext(ctx, `
+		INSERT INTO content_keys (token_id, key_id, wrapped_key)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (token_id, key_id) DO NOTHING
+	`, tokenId, keyId, wrapped)
+	if err != nil {
+		return false, fmt.Errorf("error inserting content key: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error inserting content key: %w", err)
+	}
+	return n == 1, nil
+}
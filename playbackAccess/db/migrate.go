@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strings"
+)
+
+// migrations holds the schema of the tables owned by this service. The tables
+// shared with the webapp (users, videos) are managed by its Drizzle migrations.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migrationLockID is the advisory lock held while migrating, so that instances
+// starting together apply each migration once.
+const migrationLockID = 7310452361
+
+// Migrate applies the migrations that have not been applied yet, in file name order.
+func (c *Client) Migrate(ctx context.Context) error {
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return fmt.Errorf("error listing migrations: %w", err)
+	}
+	sort.Strings(names)
+
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error acquiring connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("error acquiring migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS playback_schema_migrations (
+			version text PRIMARY KEY,
+			applied_at timestamp DEFAULT now() NOT NULL
+		)
+	`); err != nil {
+		return fmt.Errorf("error creating migrations table: %w", err)
+	}
+
+	for _, name := range names {
+		version := strings.TrimSuffix(strings.TrimPrefix(name, "migrations/"), ".sql")
+
+		var applied bool
+		if err := conn.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM playback_schema_migrations WHERE version = $1)`, version,
+		).Scan(&applied); err != nil {
+			return fmt.Errorf("error checking migration %s: %w", version, err)
+		}
+		if applied {
+			continue
+		}
+
+		script, err := migrations.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("error reading migration %s: %w", version, err)
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error starting migration %s: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error applying migration %s: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO playback_schema_migrations (version) VALUES ($1)`, version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error recording migration %s: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("error committing migration %s: %w", version, err)
+		}
+
+		log.Printf("Applied database migration %s", version)
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+-- Durable access grants recorded from on-chain purchases
+CREATE TABLE IF NOT EXISTS access_grants (
+	chain_id bigint NOT NULL,
+	contract text NOT NULL,
+	token_id numeric(78, 0) NOT NULL,
+	address text NOT NULL,
+	block_number bigint NOT NULL,
+	block_hash text NOT NULL,
+	tx_hash text NOT NULL,
+	log_index integer NOT NULL,
+	created_at timestamp DEFAULT now() NOT NULL,
+	PRIMARY KEY (chain_id, tx_hash, log_index)
+);
+
+CREATE INDEX IF NOT EXISTS access_grants_token_address_idx ON access_grants (chain_id, token_id, address);
+CREATE INDEX IF NOT EXISTS access_grants_block_idx ON access_grants (chain_id, contract, block_number);
+
+-- Last block processed by each event indexer
+CREATE TABLE IF NOT EXISTS indexer_checkpoints (
+	chain_id bigint NOT NULL,
+	contract text NOT NULL,
+	block_number bigint NOT NULL,
+	updated_at timestamp DEFAULT now() NOT NULL,
+	PRIMARY KEY (chain_id, contract)
+);
+
+-- Hashes of processed blocks that may still be reorganized
+CREATE TABLE IF NOT EXISTS indexer_blocks (
+	chain_id bigint NOT NULL,
+	contract text NOT NULL,
+	block_number bigint NOT NULL,
+	block_hash text NOT NULL,
+	PRIMARY KEY (chain_id, contract, block_number)
+);
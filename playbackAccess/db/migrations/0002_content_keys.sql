@@ -0,0 +1,8 @@
+-- AES-128 keys of encrypted HLS renditions, wrapped under the service's master key
+CREATE TABLE IF NOT EXISTS content_keys (
+	token_id numeric(78, 0) NOT NULL,
+	key_id text NOT NULL,
+	wrapped_key bytea NOT NULL,
+	created_at timestamp DEFAULT now() NOT NULL,
+	PRIMARY KEY (token_id, key_id)
+);
@@ -0,0 +1,25 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUserNotFound is returned when no user matches a lookup.
+var ErrUserNotFound = errors.New("user not found")
+
+// GetWalletAddressByDID returns the wallet address, in lowercase, of the user with the given Privy DID.
+func (c *Client) GetWalletAddressByDID(ctx context.Context, did string) (string, error) {
+	var walletAddress string
+	err := c.db.QueryRowContext(ctx, `SELECT wallet_address FROM users WHERE did = $1`, did).Scan(&walletAddress)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrUserNotFound
+		}
+		return "", fmt.Errorf("error querying user: %w", err)
+	}
+	return strings.ToLower(walletAddress), nil
+}
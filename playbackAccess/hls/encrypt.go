@@ -0,0 +1,117 @@
+package hls
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrMasterPlaylist is returned by EncryptPlaylist for master playlists, whose
+// variant streams are encrypted through their own media playlists.
+var ErrMasterPlaylist = errors.New("master playlist")
+
+// Segment is a media segment of a playlist.
+type Segment struct {
+	URI string
+	// Sequence is the segment's media sequence number, the IV of its encryption
+	Sequence uint64
+}
+
+// EncryptPlaylist returns the media playlist with an EXT-X-KEY tag before its first
+// segment, declaring every segment encrypted with AES-128 under the key at keyURI,
+// and the segments to encrypt with EncryptSegment. The tag carries no IV, so each
+// segment's IV is its media sequence number.
+//
+// Playlists that are already encrypted, or that use initialization sections or
+// byte ranges, are rejected.
+func EncryptPlaylist(playlist []byte, keyURI string) ([]byte, []Segment, error) {
+	if strings.ContainsAny(keyURI, "\"\r\n") {
+		return nil, nil, fmt.Errorf("invalid key URI %q", keyURI)
+	}
+	lines := strings.Split(string(playlist), "\n")
+	if strings.TrimSpace(lines[0]) != "#EXTM3U" {
+		return nil, nil, fmt.Errorf("playlist does not start with #EXTM3U")
+	}
+
+	var sequence uint64
+	var segments []Segment
+	var out bytes.Buffer
+	keyed := false
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		if i > 0 {
+			out.WriteByte('\n')
+		}
+
+		switch {
+		case strings.TrimSpace(line) == "":
+
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			return nil, nil, ErrMasterPlaylist
+
+		case strings.HasPrefix(line, "#EXT-X-KEY:"), strings.HasPrefix(line, "#EXT-X-MAP:"), strings.HasPrefix(line, "#EXT-X-BYTERANGE:"):
+			tag, _, _ := strings.Cut(line, ":")
+			return nil, nil, fmt.Errorf("line %d: %s is not supported", i+1, tag)
+
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			n, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:")), 10, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: invalid media sequence number", i+1)
+			}
+			sequence = n
+
+		case strings.HasPrefix(line, "#EXTINF:"):
+			// The key applies to every segment after it
+			if !keyed {
+				out.WriteString(`#EXT-X-KEY:METHOD=AES-128,URI="` + keyURI + "\"\n")
+				keyed = true
+			}
+
+		case strings.HasPrefix(line, "#"):
+
+		default:
+			if !keyed {
+				return nil, nil, fmt.Errorf("line %d: segment without #EXTINF", i+1)
+			}
+			line = strings.TrimSpace(line)
+			segments = append(segments, Segment{URI: line, Sequence: sequence + uint64(len(segments))})
+		}
+
+		out.WriteString(line)
+	}
+	if len(segments) == 0 {
+		return nil, nil, fmt.Errorf("playlist has no segments")
+	}
+
+	return out.Bytes(), segments, nil
+}
+
+// EncryptSegment encrypts a media segment with AES-128-CBC under key, with PKCS7
+// padding and the segment's media sequence number as IV, as players decrypt
+// segments of an EXT-X-KEY tag with METHOD=AES-128 and no IV attribute.
+func EncryptSegment(data, key []byte, sequence uint64) ([]byte, error) {
+	if len(key) != 16 {
+		return nil, fmt.Errorf("AES-128 keys are 16 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], sequence)
+
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	out := make([]byte, len(data)+padding)
+	copy(out, data)
+	for i := len(data); i < len(out); i++ {
+		out[i] = byte(padding)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, out)
+	return out, nil
+}
@@ -0,0 +1,98 @@
+package hls
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncryptPlaylist(t *testing.T) {
+	playlist := "#EXTM3U\n" +
+		"#EXT-X-TARGETDURATION:6\n" +
+		"#EXT-X-MEDIA-SEQUENCE:7\n" +
+		"#EXTINF:6.000,\n" +
+		"seg0.ts\n" +
+		"#EXTINF:4.5,\n" +
+		"seg1.ts\n" +
+		"#EXT-X-ENDLIST\n"
+	want := "#EXTM3U\n" +
+		"#EXT-X-TARGETDURATION:6\n" +
+		"#EXT-X-MEDIA-SEQUENCE:7\n" +
+		"#EXT-X-KEY:METHOD=AES-128,URI=\"https://api.test/v1/keys/42/k1\"\n" +
+		"#EXTINF:6.000,\n" +
+		"seg0.ts\n" +
+		"#EXTINF:4.5,\n" +
+		"seg1.ts\n" +
+		"#EXT-X-ENDLIST\n"
+
+	got, segments, err := EncryptPlaylist([]byte(playlist), "https://api.test/v1/keys/42/k1")
+	if err != nil {
+		t.Fatalf("EncryptPlaylist: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("EncryptPlaylist =\n%s\nwant\n%s", got, want)
+	}
+	if wantSegments := []Segment{{"seg0.ts", 7}, {"seg1.ts", 8}}; !reflect.DeepEqual(segments, wantSegments) {
+		t.Errorf("segments = %v, want %v", segments, wantSegments)
+	}
+}
+
+func TestEncryptPlaylistErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+	}{
+		{"not a playlist", "seg0.ts\n"},
+		{"encrypted", "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"key\"\n#EXTINF:6,\nseg0.ts\n"},
+		{"initialization section", "#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:6,\nseg0.m4s\n"},
+		{"byte ranges", "#EXTM3U\n#EXTINF:6,\n#EXT-X-BYTERANGE:1000@0\nall.ts\n"},
+		{"no segments", "#EXTM3U\n#EXT-X-ENDLIST\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := EncryptPlaylist([]byte(tt.playlist), "key"); err == nil {
+				t.Fatal("EncryptPlaylist succeeded")
+			}
+		})
+	}
+
+	master := "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1280000\n720p/index.m3u8\n"
+	if _, _, err := EncryptPlaylist([]byte(master), "key"); !errors.Is(err, ErrMasterPlaylist) {
+		t.Errorf("EncryptPlaylist of a master playlist = %v, want ErrMasterPlaylist", err)
+	}
+	if _, _, err := EncryptPlaylist([]byte("#EXTM3U\n#EXTINF:6,\nseg0.ts\n"), `key"`); err == nil {
+		t.Error("EncryptPlaylist with a quote in the key URI succeeded")
+	}
+}
+
+func TestEncryptSegment(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	for _, data := range [][]byte{{}, []byte("segment"), bytes.Repeat([]byte{0x47}, 188*3)} {
+		encrypted, err := EncryptSegment(data, key, 258)
+		if err != nil {
+			t.Fatalf("EncryptSegment: %v", err)
+		}
+
+		// Decrypt as a player would, with the media sequence number as IV
+		block, _ := aes.NewCipher(key)
+		iv := make([]byte, aes.BlockSize)
+		iv[14], iv[15] = 1, 2
+		decrypted := make([]byte, len(encrypted))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, encrypted)
+		padding := int(decrypted[len(decrypted)-1])
+		if padding < 1 || padding > aes.BlockSize || !bytes.Equal(decrypted[len(decrypted)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+			t.Fatalf("invalid padding in %x", decrypted)
+		}
+		if got := decrypted[:len(decrypted)-padding]; !bytes.Equal(got, data) {
+			t.Errorf("decrypted %q, want %q", got, data)
+		}
+	}
+
+	if _, err := EncryptSegment([]byte("segment"), []byte(strings.Repeat("k", 32)), 0); err == nil {
+		t.Error("EncryptSegment with a 32-byte key succeeded")
+	}
+}
@@ -0,0 +1,81 @@
+// Package hls rewrites HLS playlists (RFC 8216) and encrypts their renditions
+// with AES-128.
+package hls
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// uriAttribute matches the URI attribute of tags such as EXT-X-MEDIA, EXT-X-MAP and EXT-X-KEY.
+var uriAttribute = regexp.MustCompile(`URI="([^"]*)"`)
+
+// RewriteFunc returns the replacement for a URI of a playlist. offset is the
+// playback time at which the URI's media starts: the total duration of the
+// segments listed before it, or zero in a master playlist.
+type RewriteFunc func(uri string, offset time.Duration) (string, error)
+
+// Rewrite returns playlist with every URI replaced by the result of rewrite:
+// the URI lines of variant streams and media segments, and the URI attributes of tags.
+// Everything else is kept as is.
+func Rewrite(playlist []byte, rewrite RewriteFunc) ([]byte, error) {
+	lines := strings.Split(string(playlist), "\n")
+	if strings.TrimSpace(lines[0]) != "#EXTM3U" {
+		return nil, fmt.Errorf("playlist does not start with #EXTM3U")
+	}
+
+	var offset, duration time.Duration
+	var out bytes.Buffer
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		if i > 0 {
+			out.WriteByte('\n')
+		}
+
+		switch {
+		case strings.TrimSpace(line) == "":
+			// Blank lines are ignored by players
+
+		case strings.HasPrefix(line, "#EXTINF:"):
+			// #EXTINF:<duration>,[<title>] gives the duration of the next segment
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			seconds, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || seconds < 0 {
+				return nil, fmt.Errorf("line %d: invalid segment duration %q", i+1, value)
+			}
+			duration = time.Duration(seconds * float64(time.Second))
+
+		case strings.HasPrefix(line, "#"):
+			// Tags and comments; tags may refer to other resources through a URI attribute
+			var err error
+			line = uriAttribute.ReplaceAllStringFunc(line, func(attribute string) string {
+				uri := uriAttribute.FindStringSubmatch(attribute)[1]
+				rewritten, rewriteErr := rewrite(uri, offset)
+				if rewriteErr != nil && err == nil {
+					err = fmt.Errorf("line %d: %w", i+1, rewriteErr)
+				}
+				return `URI="` + rewritten + `"`
+			})
+			if err != nil {
+				return nil, err
+			}
+
+		default:
+			uri, err := rewrite(strings.TrimSpace(line), offset)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			line = uri
+			offset += duration
+			duration = 0
+		}
+
+		out.WriteString(line)
+	}
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,108 @@
+package hls
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+		want     string
+	}{
+		{
+			name: "master",
+			playlist: "#EXTM3U\n" +
+				"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aac\",NAME=\"en\",URI=\"audio/index.m3u8\"\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=1280000,AUDIO=\"aac\"\n" +
+				"720p/index.m3u8\n",
+			want: "#EXTM3U\n" +
+				"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aac\",NAME=\"en\",URI=\"<audio/index.m3u8@0s>\"\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=1280000,AUDIO=\"aac\"\n" +
+				"<720p/index.m3u8@0s>\n",
+		},
+		{
+			name: "media",
+			playlist: "#EXTM3U\n" +
+				"#EXT-X-TARGETDURATION:6\n" +
+				"#EXT-X-MAP:URI=\"init.mp4\"\n" +
+				"#EXT-X-KEY:METHOD=AES-128,URI=\"key\",IV=0x00000000000000000000000000000001\n" +
+				"#EXTINF:6.000,\n" +
+				"seg0.ts\n" +
+				"\n" +
+				"#EXTINF:4.5,title\n" +
+				"seg1.ts\n" +
+				"#EXT-X-KEY:METHOD=AES-128,URI=\"key2\"\n" +
+				"#EXTINF:2,\n" +
+				"seg2.ts\n" +
+				"#EXT-X-ENDLIST",
+			want: "#EXTM3U\n" +
+				"#EXT-X-TARGETDURATION:6\n" +
+				"#EXT-X-MAP:URI=\"<init.mp4@0s>\"\n" +
+				"#EXT-X-KEY:METHOD=AES-128,URI=\"<key@0s>\",IV=0x00000000000000000000000000000001\n" +
+				"#EXTINF:6.000,\n" +
+				"<seg0.ts@0s>\n" +
+				"\n" +
+				"#EXTINF:4.5,title\n" +
+				"<seg1.ts@6s>\n" +
+				"#EXT-X-KEY:METHOD=AES-128,URI=\"<key2@10.5s>\"\n" +
+				"#EXTINF:2,\n" +
+				"<seg2.ts@10.5s>\n" +
+				"#EXT-X-ENDLIST",
+		},
+		{
+			name:     "CRLF",
+			playlist: "#EXTM3U\r\n#EXTINF:1,\r\n seg0.ts \r\n",
+			want:     "#EXTM3U\n#EXTINF:1,\n<seg0.ts@0s>\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Rewrite([]byte(tt.playlist), func(uri string, offset time.Duration) (string, error) {
+				return fmt.Sprintf("<%s@%s>", uri, offset), nil
+			})
+			if err != nil {
+				t.Fatalf("Rewrite: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("Rewrite =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteErrors(t *testing.T) {
+	keep := func(uri string, _ time.Duration) (string, error) { return uri, nil }
+	errRewrite := errors.New("rewrite failed")
+	fail := func(uri string, _ time.Duration) (string, error) {
+		if strings.HasPrefix(uri, "bad") {
+			return "", errRewrite
+		}
+		return uri, nil
+	}
+
+	tests := []struct {
+		name     string
+		playlist string
+		rewrite  RewriteFunc
+		want     string
+	}{
+		{"not a playlist", "seg0.ts\n", keep, "does not start with #EXTM3U"},
+		{"invalid duration", "#EXTM3U\n#EXTINF:soon,\nseg0.ts\n", keep, "line 2: invalid segment duration"},
+		{"negative duration", "#EXTM3U\n#EXTINF:-1,\nseg0.ts\n", keep, "line 2: invalid segment duration"},
+		{"segment", "#EXTM3U\n#EXTINF:1,\nbad.ts\n", fail, "line 3: rewrite failed"},
+		{"attribute", "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"bad-key\"\n", fail, "line 2: rewrite failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Rewrite([]byte(tt.playlist), tt.rewrite)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Rewrite error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
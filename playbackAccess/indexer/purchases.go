@@ -0,0 +1,328 @@
+// Package indexer follows PurchaseManager events and records the access they grant,
+// so that purchases unlock playback without an on-chain lookup or a Lit round-trip.
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/loop/playbackAccess/contracts"
+	"github.com/loop/playbackAccess/db"
+	"github.com/loop/playbackAccess/model"
+	"github.com/loop/playbackAccess/redis"
+)
+
+// Chain reads the blocks and logs of the indexed chain. *chain.Chain implements it.
+type Chain interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+}
+
+// Store records the grants and progress of the indexer. *db.Client implements it.
+type Store interface {
+	GetIndexerCheckpoint(ctx context.Context, chainId int64, contract string) (*model.IndexerCheckpoint, error)
+	CommitIndexedRange(ctx context.Context, r db.IndexedRange) error
+	RollbackIndexer(ctx context.Context, chainId int64, contract string, toBlock uint64) ([]model.AccessGrant, error)
+	HasAccessGrant(ctx context.Context, chainId int64, tokenId, address string) (bool, error)
+}
+
+// Options configures a PurchaseIndexer.
+type Options struct {
+	ChainId  int64
+	Contract common.Address
+	// DeploymentBlock is where indexing starts; when it is zero, it is looked up on-chain
+	DeploymentBlock uint64
+	// Confirmations is the depth after which a block is assumed final
+	Confirmations uint64
+	// BatchSize is the largest block range requested at once
+	BatchSize    uint64
+	PollInterval time.Duration
+	// AccessTTL is how long the access records warmed in Redis live
+	AccessTTL time.Duration
+}
+
+// PurchaseIndexer records VideoPurchased events of a PurchaseManager as access grants
+// in PostgreSQL and warms the matching access records in Redis.
+//
+// Blocks are indexed as soon as they are mined. The hashes of blocks that are not yet
+// confirmed are kept, and when one of them changes, everything recorded from the
+// reorganized blocks is rolled back and indexed again.
+type PurchaseIndexer struct {
+	chain    Chain
+	store    Store
+	rdb      *redis.Client
+	opts     Options
+	contract string
+}
+
+// NewPurchaseIndexer returns an indexer of the PurchaseManager opts.Contract on chain
+// that records grants in store.
+func NewPurchaseIndexer(chain Chain, store Store, rdb *redis.Client, opts Options) *PurchaseIndexer {
+	return &PurchaseIndexer{
+		chain:    chain,
+		store:    store,
+		rdb:      rdb,
+		opts:     opts,
+		contract: strings.ToLower(opts.Contract.Hex()),
+	}
+}
+
+// Run indexes until ctx is done. While behind the chain head it indexes batch after
+// batch; once caught up, it polls for new blocks every poll interval. Errors are
+// logged and retried after the poll interval.
+func (ix *PurchaseIndexer) Run(ctx context.Context) {
+	log.Printf("Indexing VideoPurchased events of %s on chain %d", ix.opts.Contract.Hex(), ix.opts.ChainId)
+
+	for {
+		caughtUp, err := ix.step(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Purchase indexer: %v", err)
+		}
+
+		if err != nil || caughtUp {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(ix.opts.PollInterval):
+			}
+		}
+	}
+}
+
+// step handles a reorg or indexes the next batch of blocks. It reports whether
+// the indexer has caught up with the chain head.
+func (ix *PurchaseIndexer) step(ctx context.Context) (bool, error) {
+	head, err := ix.chain.BlockNumber(ctx)
+	if err != nil {
+		return false, fmt.Errorf("error reading head block: %w", err)
+	}
+
+	checkpoint, err := ix.store.GetIndexerCheckpoint(ctx, ix.opts.ChainId, ix.contract)
+	if err != nil {
+		return false, err
+	}
+
+	var from uint64
+	var parent *model.IndexedBlock
+	if checkpoint == nil {
+		if from, err = ix.startBlock(ctx, head); err != nil {
+			return false, err
+		}
+	} else {
+		rolledBack, err := ix.rollbackReorg(ctx, checkpoint)
+		if err != nil || rolledBack {
+			return false, err
+		}
+		from = checkpoint.BlockNumber + 1
+		if len(checkpoint.RecentBlocks) > 0 && checkpoint.RecentBlocks[0].Number == checkpoint.BlockNumber {
+			parent = &checkpoint.RecentBlocks[0]
+		}
+	}
+	if from > head {
+		return true, nil
+	}
+
+	to := head
+	if to-from >= ix.opts.BatchSize {
+		to = from + ix.opts.BatchSize - 1
+	}
+	var confirmed uint64
+	if head > ix.opts.Confirmations {
+		confirmed = head - ix.opts.Confirmations
+	}
+
+	logs, err := ix.chain.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(from),
+		ToBlock:   new(big.Int).SetUint64(to),
+		Addresses: []common.Address{ix.opts.Contract},
+		Topics:    [][]common.Hash{{contracts.VideoPurchasedTopic}},
+	})
+	if err != nil {
+		return false, fmt.Errorf("error reading logs of blocks %d-%d: %w", from, to, err)
+	}
+
+	blocks, err := ix.unconfirmedBlocks(ctx, max(from, confirmed+1), to, parent)
+	if err != nil {
+		return false, err
+	}
+	hashes := make(map[uint64]string, len(blocks))
+	for _, b := range blocks {
+		hashes[b.Number] = b.Hash
+	}
+
+	var grants []model.AccessGrant
+	for _, l := range logs {
+		if l.Removed {
+			continue
+		}
+		if hash, ok := hashes[l.BlockNumber]; ok && hash != l.BlockHash.Hex() {
+			return false, fmt.Errorf("block %d was reorganized while indexing", l.BlockNumber)
+		}
+
+		event, err := contracts.ParseVideoPurchased(l)
+		if err != nil {
+			return false, err
+		}
+		grants = append(grants, model.AccessGrant{
+			ChainId:     ix.opts.ChainId,
+			Contract:    ix.contract,
+			TokenId:     event.TokenId.String(),
+			Address:     strings.ToLower(event.Purchaser.Hex()),
+			BlockNumber: l.BlockNumber,
+			BlockHash:   l.BlockHash.Hex(),
+			TxHash:      l.TxHash.Hex(),
+			LogIndex:    l.Index,
+		})
+	}
+
+	if err := ix.store.CommitIndexedRange(ctx, db.IndexedRange{
+		ChainId:   ix.opts.ChainId,
+		Contract:  ix.contract,
+		ToBlock:   to,
+		Grants:    grants,
+		Blocks:    blocks,
+		Confirmed: confirmed,
+	}); err != nil {
+		return false, err
+	}
+
+	// Grants are durable in PostgreSQL; Redis only spares requests a query
+	exp := time.Now().Add(ix.opts.AccessTTL).UnixMilli()
+	for _, g := range grants {
+		if err := ix.rdb.SetAccess(redis.AccessKey(g.TokenId, g.Address), exp); err != nil {
+			log.Printf("Warning: failed to cache access grant in Redis: %v", err)
+		}
+	}
+	if len(grants) > 0 {
+		log.Printf("Purchase indexer: recorded %d purchases in blocks %d-%d", len(grants), from, to)
+	}
+
+	return to == head, nil
+}
+
+// unconfirmedBlocks returns the hashes of blocks from through to, checking that
+// each block is the child of the previous one, starting with parent if known.
+func (ix *PurchaseIndexer) unconfirmedBlocks(ctx context.Context, from, to uint64, parent *model.IndexedBlock) ([]model.IndexedBlock, error) {
+	var blocks []model.IndexedBlock
+	for n := from; n <= to; n++ {
+		header, err := ix.chain.HeaderByNumber(ctx, new(big.Int).SetUint64(n))
+		if err != nil {
+			return nil, fmt.Errorf("error reading block %d: %w", n, err)
+		}
+
+		if parent != nil && parent.Number == n-1 && parent.Hash != header.ParentHash.Hex() {
+			return nil, fmt.Errorf("block %d was reorganized while indexing", n-1)
+		}
+
+		block := model.IndexedBlock{Number: n, Hash: header.Hash().Hex()}
+		blocks = append(blocks, block)
+		parent = &blocks[len(blocks)-1]
+	}
+	return blocks, nil
+}
+
+// rollbackReorg compares the recorded unconfirmed blocks with the chain, newest first.
+// If any was reorganized, everything recorded after the newest block that is still
+// on the chain is rolled back. It reports whether a rollback happened.
+func (ix *PurchaseIndexer) rollbackReorg(ctx context.Context, checkpoint *model.IndexerCheckpoint) (bool, error) {
+	if len(checkpoint.RecentBlocks) == 0 {
+		return false, nil
+	}
+
+	var ancestor uint64
+	found := false
+	for i, b := range checkpoint.RecentBlocks {
+		header, err := ix.chain.HeaderByNumber(ctx, new(big.Int).SetUint64(b.Number))
+		if err != nil {
+			return false, fmt.Errorf("error reading block %d: %w", b.Number, err)
+		}
+		if header.Hash().Hex() == b.Hash {
+			if i == 0 {
+				return false, nil
+			}
+			ancestor, found = b.Number, true
+			break
+		}
+	}
+	if !found {
+		// Every unconfirmed block changed; go back to the last confirmed one
+		ancestor = checkpoint.RecentBlocks[len(checkpoint.RecentBlocks)-1].Number - 1
+		log.Printf("Warning: purchase indexer: reorg on chain %d is deeper than %d confirmations", ix.opts.ChainId, ix.opts.Confirmations)
+	}
+
+	removed, err := ix.store.RollbackIndexer(ctx, ix.opts.ChainId, ix.contract, ancestor)
+	if err != nil {
+		return false, err
+	}
+	log.Printf("Purchase indexer: chain %d reorganized after block %d; rolled back %d purchases", ix.opts.ChainId, ancestor, len(removed))
+
+	// Revoke the cached access of purchases that no longer hold any grant
+	for _, g := range removed {
+		granted, err := ix.store.HasAccessGrant(ctx, g.ChainId, g.TokenId, g.Address)
+		if err != nil {
+			return true, err
+		}
+		if granted {
+			continue
+		}
+		if err := ix.rdb.DeleteAccess(redis.AccessKey(g.TokenId, g.Address)); err != nil {
+			log.Printf("Warning: failed to remove access record from Redis: %v", err)
+		}
+	}
+
+	return true, nil
+}
+
+// startBlock returns the block to start indexing from: the configured deployment
+// block, or else the first block with code at the contract address.
+func (ix *PurchaseIndexer) startBlock(ctx context.Context, head uint64) (uint64, error) {
+	if ix.opts.DeploymentBlock > 0 {
+		return ix.opts.DeploymentBlock, nil
+	}
+
+	hasCode := func(block uint64) (bool, error) {
+		code, err := ix.chain.CodeAt(ctx, ix.opts.Contract, new(big.Int).SetUint64(block))
+		if err != nil {
+			return false, fmt.Errorf("error looking up deployment block of %s: %w", ix.opts.Contract.Hex(), err)
+		}
+		return len(code) > 0, nil
+	}
+
+	deployed, err := hasCode(head)
+	if err != nil {
+		return 0, err
+	}
+	if !deployed {
+		return 0, fmt.Errorf("no contract is deployed at %s", ix.opts.Contract.Hex())
+	}
+
+	// Reading historical code requires an archive node
+	lo, hi := uint64(0), head
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		deployed, err := hasCode(mid)
+		if err != nil {
+			return 0, err
+		}
+		if deployed {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	log.Printf("Purchase indexer: %s was deployed in block %d; configure it as the chain's purchaseManagerDeploymentBlock to skip this lookup", ix.opts.Contract.Hex(), lo)
+	return lo, nil
+}
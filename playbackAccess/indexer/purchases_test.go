@@ -0,0 +1,395 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/loop/playbackAccess/contracts"
+	"github.com/loop/playbackAccess/db"
+	"github.com/loop/playbackAccess/model"
+	"github.com/loop/playbackAccess/redis"
+)
+
+var (
+	purchaseManager = common.HexToAddress("0x00000000000000000000000000000000000000b0")
+	alice           = common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	bob             = common.HexToAddress("0x00000000000000000000000000000000000000b1")
+)
+
+// fakeChain is a chain whose blocks are set by the test. Blocks are told apart
+// by their fork, so that a reorganized block has a different hash.
+type fakeChain struct {
+	headers []*types.Header // by number; headers[0] is genesis
+	logs    map[uint64][]types.Log
+	// deployedAt is the first block with code at purchaseManager
+	deployedAt uint64
+}
+
+func newFakeChain(head uint64) *fakeChain {
+	c := &fakeChain{logs: map[uint64][]types.Log{}}
+	c.headers = []*types.Header{{Number: big.NewInt(0)}}
+	c.extend(head, "main")
+	return c
+}
+
+// extend mines blocks on fork until head.
+func (c *fakeChain) extend(head uint64, fork string) {
+	for n := uint64(len(c.headers)); n <= head; n++ {
+		c.headers = append(c.headers, &types.Header{
+			Number:     new(big.Int).SetUint64(n),
+			ParentHash: c.headers[n-1].Hash(),
+			Extra:      []byte(fork),
+		})
+	}
+}
+
+// reorg replaces the blocks from number on with blocks of fork until head, dropping their purchases.
+func (c *fakeChain) reorg(number, head uint64, fork string) {
+	c.headers = c.headers[:number]
+	for n := range c.logs {
+		if n >= number {
+			delete(c.logs, n)
+		}
+	}
+	c.extend(head, fork)
+}
+
+// purchase records a purchase of the video with tokenId by purchaser in block number.
+func (c *fakeChain) purchase(number uint64, tokenId int64, purchaser common.Address) {
+	c.logs[number] = append(c.logs[number], types.Log{
+		Address:     purchaseManager,
+		Topics:      []common.Hash{contracts.VideoPurchasedTopic, common.BigToHash(big.NewInt(tokenId)), common.BytesToHash(purchaser.Bytes())},
+		BlockNumber: number,
+		BlockHash:   c.headers[number].Hash(),
+		TxHash:      common.BytesToHash([]byte(fmt.Sprintf("%s-%d-%d", c.headers[number].Extra, number, len(c.logs[number])))),
+		Index:       uint(len(c.logs[number])),
+	})
+}
+
+func (c *fakeChain) BlockNumber(ctx context.Context) (uint64, error) {
+	return uint64(len(c.headers) - 1), nil
+}
+
+func (c *fakeChain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if number.Uint64() >= uint64(len(c.headers)) {
+		return nil, ethereum.NotFound
+	}
+	return c.headers[number.Uint64()], nil
+}
+
+func (c *fakeChain) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	for n := q.FromBlock.Uint64(); n <= q.ToBlock.Uint64(); n++ {
+		logs = append(logs, c.logs[n]...)
+	}
+	return logs, nil
+}
+
+func (c *fakeChain) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	if account != purchaseManager || blockNumber.Uint64() < c.deployedAt {
+		return nil, nil
+	}
+	return []byte{0x00}, nil
+}
+
+// memoryStore is a Store with the semantics of db.Client, in memory.
+type memoryStore struct {
+	checkpoint *uint64
+	blocks     map[uint64]string
+	grants     []model.AccessGrant
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{blocks: map[uint64]string{}}
+}
+
+func (s *memoryStore) GetIndexerCheckpoint(ctx context.Context, chainId int64, contract string) (*model.IndexerCheckpoint, error) {
+	if s.checkpoint == nil {
+		return nil, nil
+	}
+	checkpoint := &model.IndexerCheckpoint{ChainId: chainId, Contract: contract, BlockNumber: *s.checkpoint}
+	for n, hash := range s.blocks {
+		checkpoint.RecentBlocks = append(checkpoint.RecentBlocks, model.IndexedBlock{Number: n, Hash: hash})
+	}
+	sort.Slice(checkpoint.RecentBlocks, func(i, j int) bool {
+		return checkpoint.RecentBlocks[i].Number > checkpoint.RecentBlocks[j].Number
+	})
+	return checkpoint, nil
+}
+
+func (s *memoryStore) CommitIndexedRange(ctx context.Context, r db.IndexedRange) error {
+	for _, g := range r.Grants {
+		if !s.hasGrant(func(have model.AccessGrant) bool { return have.TxHash == g.TxHash && have.LogIndex == g.LogIndex }) {
+			s.grants = append(s.grants, g)
+		}
+	}
+	for _, b := range r.Blocks {
+		s.blocks[b.Number] = b.Hash
+	}
+	for n := range s.blocks {
+		if n <= r.Confirmed {
+			delete(s.blocks, n)
+		}
+	}
+	s.checkpoint = &r.ToBlock
+	return nil
+}
+
+func (s *memoryStore) RollbackIndexer(ctx context.Context, chainId int64, contract string, toBlock uint64) ([]model.AccessGrant, error) {
+	var kept, removed []model.AccessGrant
+	for _, g := range s.grants {
+		if g.BlockNumber > toBlock {
+			removed = append(removed, g)
+		} else {
+			kept = append(kept, g)
+		}
+	}
+	s.grants = kept
+	for n := range s.blocks {
+		if n > toBlock {
+			delete(s.blocks, n)
+		}
+	}
+	s.checkpoint = &toBlock
+	return removed, nil
+}
+
+func (s *memoryStore) HasAccessGrant(ctx context.Context, chainId int64, tokenId, address string) (bool, error) {
+	return s.hasGrant(func(g model.AccessGrant) bool { return g.TokenId == tokenId && g.Address == address }), nil
+}
+
+func (s *memoryStore) hasGrant(match func(model.AccessGrant) bool) bool {
+	for _, g := range s.grants {
+		if match(g) {
+			return true
+		}
+	}
+	return false
+}
+
+// holders returns "tokenId:address@block" for every recorded grant, sorted.
+func (s *memoryStore) holders() []string {
+	var holders []string
+	for _, g := range s.grants {
+		holders = append(holders, fmt.Sprintf("%s:%s@%d", g.TokenId, g.Address, g.BlockNumber))
+	}
+	sort.Strings(holders)
+	return holders
+}
+
+func holder(tokenId int64, address common.Address, block uint64) string {
+	return fmt.Sprintf("%d:%s@%d", tokenId, strings.ToLower(address.Hex()), block)
+}
+
+type indexerTest struct {
+	t     *testing.T
+	chain *fakeChain
+	store *memoryStore
+	rdb   *redis.Client
+	ix    *PurchaseIndexer
+}
+
+func newIndexerTest(t *testing.T, chain *fakeChain, opts Options) *indexerTest {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb, err := redis.NewClient("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rdb.Close() })
+
+	opts.ChainId = 84532
+	opts.Contract = purchaseManager
+	opts.AccessTTL = time.Hour
+	store := newMemoryStore()
+	return &indexerTest{t: t, chain: chain, store: store, rdb: rdb, ix: NewPurchaseIndexer(chain, store, rdb, opts)}
+}
+
+// step runs a step of the indexer and checks whether it caught up.
+func (it *indexerTest) step(wantCaughtUp bool) {
+	it.t.Helper()
+	caughtUp, err := it.ix.step(context.Background())
+	if err != nil {
+		it.t.Fatalf("step: %v", err)
+	}
+	if caughtUp != wantCaughtUp {
+		it.t.Fatalf("step caught up = %v, want %v", caughtUp, wantCaughtUp)
+	}
+}
+
+// checkpoint checks the indexer's last processed block and the unconfirmed blocks it keeps.
+func (it *indexerTest) checkpoint(block uint64, recent ...uint64) {
+	it.t.Helper()
+	checkpoint, _ := it.store.GetIndexerCheckpoint(context.Background(), 0, "")
+	if checkpoint == nil || checkpoint.BlockNumber != block {
+		it.t.Fatalf("checkpoint = %+v, want block %d", checkpoint, block)
+	}
+	var numbers []uint64
+	for _, b := range checkpoint.RecentBlocks {
+		numbers = append(numbers, b.Number)
+		if want := it.chain.headers[b.Number].Hash().Hex(); b.Hash != want {
+			it.t.Fatalf("recent block %d = %s, want %s", b.Number, b.Hash, want)
+		}
+	}
+	if fmt.Sprint(numbers) != fmt.Sprint(recent) {
+		it.t.Fatalf("recent blocks = %v, want %v", numbers, recent)
+	}
+}
+
+// grants checks the recorded grants.
+func (it *indexerTest) grants(want ...string) {
+	it.t.Helper()
+	sort.Strings(want)
+	if got := it.store.holders(); fmt.Sprint(got) != fmt.Sprint(want) {
+		it.t.Fatalf("grants = %v, want %v", got, want)
+	}
+}
+
+// cached checks whether address has a cached access record for the video with tokenId.
+func (it *indexerTest) cached(tokenId int64, address common.Address, want bool) {
+	it.t.Helper()
+	_, err := it.rdb.GetAccess(redis.AccessKey(fmt.Sprint(tokenId), strings.ToLower(address.Hex())))
+	if cached := err == nil; cached != want {
+		it.t.Fatalf("access of %s to %d cached = %v, want %v", address.Hex(), tokenId, cached, want)
+	}
+}
+
+func TestPurchaseIndexerBatches(t *testing.T) {
+	chain := newFakeChain(10)
+	chain.purchase(3, 42, alice)
+	chain.purchase(9, 42, bob)
+	it := newIndexerTest(t, chain, Options{DeploymentBlock: 2, Confirmations: 3, BatchSize: 4})
+
+	// Batches of 4 from the deployment block; the hashes of the 3 newest blocks are kept
+	it.step(false)
+	it.checkpoint(5)
+	it.grants(holder(42, alice, 3))
+	it.cached(42, alice, true)
+
+	it.step(false)
+	it.checkpoint(9, 9, 8)
+	it.grants(holder(42, alice, 3), holder(42, bob, 9))
+	it.cached(42, bob, true)
+
+	it.step(true)
+	it.checkpoint(10, 10, 9, 8)
+
+	it.step(true)
+	it.checkpoint(10, 10, 9, 8)
+
+	// Blocks that are confirmed are forgotten
+	chain.extend(12, "main")
+	it.step(true)
+	it.checkpoint(12, 12, 11, 10)
+}
+
+func TestPurchaseIndexerDeploymentBlock(t *testing.T) {
+	chain := newFakeChain(20)
+	chain.deployedAt = 13
+	chain.purchase(13, 7, alice)
+	it := newIndexerTest(t, chain, Options{Confirmations: 3, BatchSize: 100})
+
+	it.step(true)
+	it.checkpoint(20, 20, 19, 18)
+	it.grants(holder(7, alice, 13))
+
+	// Without a deployed contract there is nothing to index
+	chain.deployedAt = 100
+	other := newIndexerTest(t, chain, Options{Confirmations: 3, BatchSize: 100})
+	if _, err := other.ix.step(context.Background()); err == nil {
+		t.Fatal("step without a deployed contract succeeded")
+	}
+}
+
+func TestPurchaseIndexerReorg(t *testing.T) {
+	chain := newFakeChain(10)
+	chain.purchase(6, 42, alice)
+	chain.purchase(9, 42, bob)
+	chain.purchase(9, 43, alice)
+	it := newIndexerTest(t, chain, Options{DeploymentBlock: 1, Confirmations: 4, BatchSize: 100})
+
+	it.step(true)
+	it.checkpoint(10, 10, 9, 8, 7)
+	it.grants(holder(42, alice, 6), holder(42, bob, 9), holder(43, alice, 9))
+
+	// Blocks 9 and 10 are replaced; block 8 is the common ancestor. Bob's purchase
+	// is dropped, and Alice's of video 43 mined again in block 11.
+	chain.reorg(9, 11, "fork")
+	chain.purchase(11, 43, alice)
+	chain.purchase(11, 42, alice)
+
+	it.step(false)
+	it.checkpoint(8, 8, 7)
+	it.grants(holder(42, alice, 6))
+	it.cached(42, bob, false)
+	it.cached(42, alice, true)
+	it.cached(43, alice, false)
+
+	it.step(true)
+	it.checkpoint(11, 11, 10, 9, 8)
+	it.grants(holder(42, alice, 6), holder(42, alice, 11), holder(43, alice, 11))
+	it.cached(43, alice, true)
+
+	// Access stays cached while another grant of the same video remains
+	chain.reorg(10, 12, "fork2")
+	chain.purchase(10, 42, alice)
+	it.step(false)
+	it.checkpoint(9, 9, 8)
+	it.grants(holder(42, alice, 6))
+	it.cached(42, alice, true)
+	it.cached(43, alice, false)
+
+	it.step(true)
+	it.checkpoint(12, 12, 11, 10, 9)
+	it.grants(holder(42, alice, 6), holder(42, alice, 10))
+}
+
+func TestPurchaseIndexerDeepReorg(t *testing.T) {
+	chain := newFakeChain(10)
+	chain.purchase(5, 42, alice)
+	chain.purchase(8, 42, bob)
+	it := newIndexerTest(t, chain, Options{DeploymentBlock: 1, Confirmations: 3, BatchSize: 100})
+
+	it.step(true)
+	it.checkpoint(10, 10, 9, 8)
+
+	// Every kept block changed: roll back to the newest confirmed block
+	chain.reorg(6, 10, "fork")
+	it.step(false)
+	it.checkpoint(7)
+	it.grants(holder(42, alice, 5))
+	it.cached(42, bob, false)
+
+	it.step(true)
+	it.checkpoint(10, 10, 9, 8)
+	it.grants(holder(42, alice, 5))
+}
+
+func TestUnconfirmedBlocksDetectsReorg(t *testing.T) {
+	chain := newFakeChain(5)
+	it := newIndexerTest(t, chain, Options{DeploymentBlock: 1, Confirmations: 3, BatchSize: 100})
+
+	// A parent that is no longer on the chain means it was reorganized while indexing
+	stale := &model.IndexedBlock{Number: 2, Hash: common.Hash{1}.Hex()}
+	if _, err := it.ix.unconfirmedBlocks(context.Background(), 3, 5, stale); err == nil {
+		t.Fatal("unconfirmedBlocks with a stale parent succeeded")
+	}
+
+	parent := &model.IndexedBlock{Number: 2, Hash: chain.headers[2].Hash().Hex()}
+	blocks, err := it.ix.unconfirmedBlocks(context.Background(), 3, 5, parent)
+	if err != nil {
+		t.Fatalf("unconfirmedBlocks: %v", err)
+	}
+	if len(blocks) != 3 || blocks[0].Number != 3 || blocks[2].Hash != chain.headers[5].Hash().Hex() {
+		t.Fatalf("unconfirmedBlocks = %+v", blocks)
+	}
+}
@@ -0,0 +1,232 @@
+// Package evmtest provides minimal contracts for tests that run against go-ethereum's
+// simulated backend. The contracts are assembled from opcodes, as the service has no
+// Solidity toolchain; each builder documents the Solidity it stands in for.
+package evmtest
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Program assembles EVM bytecode. Jump targets and data offsets are referenced by
+// label and resolved by Bytes.
+type Program struct {
+	code   []byte
+	labels map[string]int
+	// fixups maps the offsets of PUSH2 immediates to the labels they refer to
+	fixups map[int]string
+}
+
+// NewProgram returns an empty Program.
+func NewProgram() *Program {
+	return &Program{labels: map[string]int{}, fixups: map[int]string{}}
+}
+
+// Op appends opcodes.
+func (p *Program) Op(ops ...vm.OpCode) *Program {
+	for _, op := range ops {
+		p.code = append(p.code, byte(op))
+	}
+	return p
+}
+
+// Push appends the shortest PUSH of b, PUSH0 if b is empty.
+func (p *Program) Push(b []byte) *Program {
+	if len(b) > 32 {
+		panic(fmt.Sprintf("evmtest: cannot push %d bytes", len(b)))
+	}
+	if len(b) == 0 {
+		return p.Op(vm.PUSH0)
+	}
+	p.code = append(p.code, byte(vm.PUSH1)+byte(len(b)-1))
+	p.code = append(p.code, b...)
+	return p
+}
+
+// PushInt appends the shortest PUSH of n.
+func (p *Program) PushInt(n uint64) *Program {
+	return p.Push(new(big.Int).SetUint64(n).Bytes())
+}
+
+// PushLabel appends a PUSH2 of the offset of label.
+func (p *Program) PushLabel(label string) *Program {
+	p.code = append(p.code, byte(vm.PUSH2))
+	p.fixups[len(p.code)] = label
+	p.code = append(p.code, 0, 0)
+	return p
+}
+
+// Label marks a jump target.
+func (p *Program) Label(label string) *Program {
+	p.Mark(label)
+	return p.Op(vm.JUMPDEST)
+}
+
+// Mark marks the current offset, e.g. of data, without a JUMPDEST.
+func (p *Program) Mark(label string) *Program {
+	if _, ok := p.labels[label]; ok {
+		panic(fmt.Sprintf("evmtest: duplicate label %q", label))
+	}
+	p.labels[label] = len(p.code)
+	return p
+}
+
+// Data appends raw bytes.
+func (p *Program) Data(b []byte) *Program {
+	p.code = append(p.code, b...)
+	return p
+}
+
+// Bytes returns the assembled code.
+func (p *Program) Bytes() []byte {
+	code := append([]byte(nil), p.code...)
+	for offset, label := range p.fixups {
+		target, ok := p.labels[label]
+		if !ok {
+			panic(fmt.Sprintf("evmtest: undefined label %q", label))
+		}
+		code[offset] = byte(target >> 8)
+		code[offset+1] = byte(target)
+	}
+	return code
+}
+
+// Selector returns the 4-byte selector of the function with signature, e.g. "f(uint256)".
+func Selector(signature string) []byte {
+	return crypto.Keccak256([]byte(signature))[:4]
+}
+
+// Deployer returns creation code that deploys runtime.
+func Deployer(runtime []byte) []byte {
+	p := NewProgram()
+	p.PushInt(uint64(len(runtime))).PushLabel("runtime").Op(vm.PUSH0, vm.CODECOPY)
+	p.PushInt(uint64(len(runtime))).Op(vm.PUSH0, vm.RETURN)
+	p.Mark("runtime").Data(runtime)
+	return p.Bytes()
+}
+
+// Wallet returns the runtime code of an EIP-1271 wallet owned by owner:
+//
+//	function isValidSignature(bytes32 hash, bytes calldata sig) external view returns (bytes4) {
+//	    if (sig.length == 65 && ecrecover(hash, uint8(sig[64]), bytes32(sig[0:32]), bytes32(sig[32:64])) == owner) {
+//	        return 0x1626ba7e;
+//	    }
+//	    return 0x00000000;
+//	}
+//
+// Signatures carry v as 27 or 28. Other functions revert.
+func Wallet(owner common.Address) []byte {
+	magic := Selector("isValidSignature(bytes32,bytes)")
+
+	p := NewProgram()
+	p.PushInt(0).Op(vm.CALLDATALOAD).PushInt(0xe0).Op(vm.SHR).Push(magic).Op(vm.EQ).PushLabel("isValidSignature").Op(vm.JUMPI)
+	p.Op(vm.PUSH0, vm.PUSH0, vm.REVERT)
+
+	p.Label("isValidSignature")
+	// Position of the signature's length
+	p.PushInt(36).Op(vm.CALLDATALOAD).PushInt(4).Op(vm.ADD)
+	p.Op(vm.DUP1, vm.CALLDATALOAD).PushInt(65).Op(vm.EQ).PushLabel("recover").Op(vm.JUMPI)
+	p.PushLabel("invalid").Op(vm.JUMP)
+
+	// ecrecover input: hash, v, r, s
+	p.Label("recover")
+	p.PushInt(32).Op(vm.ADD)
+	p.Op(vm.DUP1, vm.CALLDATALOAD).PushInt(64).Op(vm.MSTORE)
+	p.Op(vm.DUP1).PushInt(32).Op(vm.ADD, vm.CALLDATALOAD).PushInt(96).Op(vm.MSTORE)
+	p.PushInt(64).Op(vm.ADD, vm.CALLDATALOAD).PushInt(0).Op(vm.BYTE).PushInt(32).Op(vm.MSTORE)
+	p.PushInt(4).Op(vm.CALLDATALOAD).PushInt(0).Op(vm.MSTORE)
+	// staticcall(gas, 0x01, 0, 128, 128, 32)
+	p.PushInt(32).PushInt(128).PushInt(128).PushInt(0).PushInt(1).Op(vm.GAS, vm.STATICCALL, vm.POP)
+	p.PushInt(128).Op(vm.MLOAD).Push(owner.Bytes()).Op(vm.EQ).PushLabel("valid").Op(vm.JUMPI)
+
+	p.Label("invalid")
+	p.Op(vm.PUSH0, vm.PUSH0, vm.MSTORE).PushInt(32).Op(vm.PUSH0, vm.RETURN)
+
+	p.Label("valid")
+	p.Push(magic).PushInt(0xe0).Op(vm.SHL, vm.PUSH0, vm.MSTORE).PushInt(32).Op(vm.PUSH0, vm.RETURN)
+	return p.Bytes()
+}
+
+// Factory returns the runtime code of a factory that deploys initcode with CREATE2,
+// salted with the first word of its call data, and returns the new address. Calls
+// for an address already deployed return the zero address.
+func Factory(initcode []byte) []byte {
+	p := NewProgram()
+	p.PushInt(uint64(len(initcode))).PushLabel("initcode").Op(vm.PUSH0, vm.CODECOPY)
+	// create2(0, 0, len(initcode), salt)
+	p.Op(vm.PUSH0, vm.CALLDATALOAD).PushInt(uint64(len(initcode))).Op(vm.PUSH0, vm.PUSH0, vm.CREATE2)
+	p.Op(vm.PUSH0, vm.MSTORE).PushInt(32).Op(vm.PUSH0, vm.RETURN)
+	p.Mark("initcode").Data(initcode)
+	return p.Bytes()
+}
+
+// CounterfactualAddress returns the address at which the factory at factory deploys
+// initcode for salt.
+func CounterfactualAddress(factory common.Address, salt common.Hash, initcode []byte) common.Address {
+	return crypto.CreateAddress2(factory, salt, crypto.Keccak256(initcode))
+}
+
+// PurchaseManager returns the runtime code of a stand-in for the PurchaseManager
+// contract's purchase records, with the same ABI:
+//
+//	mapping(bytes32 => bool) purchased; // keccak256(abi.encode(tokenId, purchaser))
+//
+//	function hasPurchasedVideo(uint256 tokenId, address purchaser) external view returns (bool) {
+//	    return purchased[keccak256(abi.encode(tokenId, purchaser))];
+//	}
+//
+// Purchases are recorded in genesis storage at PurchaseSlot. Other functions revert.
+func PurchaseManager() []byte {
+	p := NewProgram()
+	p.PushInt(0).Op(vm.CALLDATALOAD).PushInt(0xe0).Op(vm.SHR).Push(Selector("hasPurchasedVideo(uint256,address)")).Op(vm.EQ).PushLabel("hasPurchasedVideo").Op(vm.JUMPI)
+	p.Op(vm.PUSH0, vm.PUSH0, vm.REVERT)
+
+	p.Label("hasPurchasedVideo")
+	p.PushInt(4).Op(vm.CALLDATALOAD, vm.PUSH0, vm.MSTORE)
+	p.PushInt(36).Op(vm.CALLDATALOAD).PushInt(32).Op(vm.MSTORE)
+	p.PushInt(64).Op(vm.PUSH0, vm.KECCAK256, vm.SLOAD, vm.ISZERO, vm.ISZERO, vm.PUSH0, vm.MSTORE)
+	p.PushInt(32).Op(vm.PUSH0, vm.RETURN)
+	return p.Bytes()
+}
+
+// PurchaseSlot returns the storage slot of PurchaseManager that records a purchase
+// of the video with tokenId by purchaser.
+func PurchaseSlot(tokenId *big.Int, purchaser common.Address) common.Hash {
+	return crypto.Keccak256Hash(common.LeftPadBytes(tokenId.Bytes(), 32), common.LeftPadBytes(purchaser.Bytes(), 32))
+}
+
+// Purchased is the storage value of a recorded purchase.
+var Purchased = common.BigToHash(big.NewInt(1))
+
+// ERC1155 returns the runtime code of a stand-in for an ERC-1155 token's balances,
+// such as the VideoNFT's, with the same ABI:
+//
+//	mapping(bytes32 => uint256) balances; // keccak256(abi.encode(id, account))
+//
+//	function balanceOf(address account, uint256 id) external view returns (uint256) {
+//	    return balances[keccak256(abi.encode(id, account))];
+//	}
+//
+// Balances are set in genesis storage at BalanceSlot. Other functions revert.
+func ERC1155() []byte {
+	p := NewProgram()
+	p.PushInt(0).Op(vm.CALLDATALOAD).PushInt(0xe0).Op(vm.SHR).Push(Selector("balanceOf(address,uint256)")).Op(vm.EQ).PushLabel("balanceOf").Op(vm.JUMPI)
+	p.Op(vm.PUSH0, vm.PUSH0, vm.REVERT)
+
+	p.Label("balanceOf")
+	p.PushInt(36).Op(vm.CALLDATALOAD, vm.PUSH0, vm.MSTORE)
+	p.PushInt(4).Op(vm.CALLDATALOAD).PushInt(32).Op(vm.MSTORE)
+	p.PushInt(64).Op(vm.PUSH0, vm.KECCAK256, vm.SLOAD, vm.PUSH0, vm.MSTORE)
+	p.PushInt(32).Op(vm.PUSH0, vm.RETURN)
+	return p.Bytes()
+}
+
+// BalanceSlot returns the storage slot of ERC1155 that holds the balance of token
+// id of account.
+func BalanceSlot(id *big.Int, account common.Address) common.Hash {
+	return crypto.Keccak256Hash(common.LeftPadBytes(id.Bytes(), 32), common.LeftPadBytes(account.Bytes(), 32))
+}
@@ -0,0 +1,117 @@
+package links
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	redisgo "github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/loop/playbackAccess/redis"
+)
+
+// CachedProvider caches the links of another provider in Redis, so that every
+// instance of the service hands out the same link for a video until shortly
+// before it expires. Concurrent misses for one video and expiry create a single link.
+//
+// One link is cached per video. It is handed to callers whose links may work at
+// least as long; callers whose access ends earlier get a link of their own.
+type CachedProvider struct {
+	provider LinkProvider
+	rdb      *redis.Client
+	// margin is how long before NotAfter a cached link stops being handed out,
+	// so players have time to use it
+	margin time.Duration
+	group  singleflight.Group
+}
+
+// NewCachedProvider returns a provider caching the links of provider in rdb until margin before they expire.
+func NewCachedProvider(provider LinkProvider, rdb *redis.Client, margin time.Duration) *CachedProvider {
+	return &CachedProvider{provider: provider, rdb: rdb, margin: margin}
+}
+
+// Name implements LinkProvider.
+func (p *CachedProvider) Name() string {
+	return p.provider.Name()
+}
+
+// Link implements LinkProvider. notAfter is rounded down to the minute so that
+// concurrent callers can share a link. Redis failures are logged and the link
+// is created without the cache.
+func (p *CachedProvider) Link(ctx context.Context, videoId string, notAfter time.Time) (*Link, error) {
+	key := redis.SharedLinkKey(p.provider.Name(), videoId)
+	notAfter = notAfter.Truncate(time.Minute)
+
+	if link := p.cached(ctx, key); p.usable(link, notAfter) {
+		return link, nil
+	}
+
+	// The shared call must not fail because the caller that started it went away
+	result, err, _ := p.group.Do(fmt.Sprintf("%s:%d", key, notAfter.Unix()), func() (interface{}, error) {
+		return p.create(context.WithoutCancel(ctx), key, videoId, notAfter)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*Link), nil
+}
+
+// usable reports whether link can be handed to a caller whose link must stop working by notAfter.
+func (p *CachedProvider) usable(link *Link, notAfter time.Time) bool {
+	return link != nil && !link.NotAfter.After(notAfter) && time.Until(link.NotAfter) > p.margin
+}
+
+// cached returns the link stored at key, or nil.
+func (p *CachedProvider) cached(ctx context.Context, key string) *Link {
+	data, err := p.rdb.Get(ctx, key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redisgo.Nil) {
+			log.Printf("Warning: failed to read cached link %s: %v", key, err)
+		}
+		return nil
+	}
+
+	var link Link
+	if err := json.Unmarshal(data, &link); err != nil {
+		log.Printf("Warning: invalid cached link %s: %v", key, err)
+		return nil
+	}
+	return &link
+}
+
+// create creates a link and caches it at key until margin before it expires,
+// unless a longer-lived link is cached already.
+func (p *CachedProvider) create(ctx context.Context, key, videoId string, notAfter time.Time) (*Link, error) {
+	// Another instance may have created the link while this one waited
+	cached := p.cached(ctx, key)
+	if p.usable(cached, notAfter) {
+		return cached, nil
+	}
+
+	link, err := p.provider.Link(ctx, videoId, notAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the longest-lived link, which can be handed to the most callers
+	if cached != nil && !link.NotAfter.After(cached.NotAfter) {
+		return link, nil
+	}
+	ttl := time.Until(link.NotAfter) - p.margin
+	if ttl <= 0 {
+		return link, nil
+	}
+	data, err := json.Marshal(link)
+	if err != nil {
+		log.Printf("Warning: failed to encode link %s: %v", key, err)
+		return link, nil
+	}
+	if err := p.rdb.Set(ctx, key, data, ttl).Err(); err != nil {
+		log.Printf("Warning: failed to cache link %s: %v", key, err)
+	}
+	return link, nil
+}
@@ -0,0 +1,161 @@
+package links
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/loop/playbackAccess/redis"
+)
+
+// countingProvider creates a new link for every call, valid until the notAfter asked for.
+type countingProvider struct {
+	calls atomic.Int32
+	// gate, if set, holds calls until it is closed
+	gate chan struct{}
+}
+
+func (p *countingProvider) Name() string {
+	return "counting"
+}
+
+func (p *countingProvider) Link(_ context.Context, videoId string, notAfter time.Time) (*Link, error) {
+	n := p.calls.Add(1)
+	if p.gate != nil {
+		<-p.gate
+	}
+	return &Link{Src: fmt.Sprintf("https://media.test/%s?link=%d", videoId, n), Type: HLSType, NotAfter: notAfter}, nil
+}
+
+func newCachedProvider(t *testing.T, margin time.Duration) (*CachedProvider, *countingProvider, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb, err := redis.NewClient("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rdb.Close() })
+	provider := &countingProvider{}
+	return NewCachedProvider(provider, rdb, margin), provider, mr
+}
+
+func TestCachedProviderSharesLinks(t *testing.T) {
+	cached, provider, _ := newCachedProvider(t, time.Minute)
+	ctx := context.Background()
+	notAfter := time.Now().Add(time.Hour)
+
+	first, err := cached.Link(ctx, "video-1", notAfter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.NotAfter.Equal(notAfter.Truncate(time.Minute)) {
+		t.Errorf("NotAfter = %s, want %s rounded down to the minute", first.NotAfter, notAfter)
+	}
+
+	// Callers whose access lasts as long or longer share the link
+	for _, later := range []time.Time{notAfter, notAfter.Add(time.Hour)} {
+		link, err := cached.Link(ctx, "video-1", later)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link.Src != first.Src {
+			t.Fatalf("Link until %s = %s, want the cached %s", later, link.Src, first.Src)
+		}
+	}
+	if n := provider.calls.Load(); n != 1 {
+		t.Fatalf("provider called %d times, want 1", n)
+	}
+
+	// A caller whose access ends earlier gets a link of its own, and the longer-lived one stays cached
+	earlier, err := cached.Link(ctx, "video-1", notAfter.Add(-30*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if earlier.Src == first.Src {
+		t.Fatal("a caller whose access ends earlier got the cached link")
+	}
+	if link, _ := cached.Link(ctx, "video-1", notAfter); link.Src != first.Src {
+		t.Fatalf("Link = %s, want the cached %s", link.Src, first.Src)
+	}
+
+	// Other videos have links of their own
+	if link, _ := cached.Link(ctx, "video-2", notAfter); link.Src == first.Src {
+		t.Fatal("another video got the cached link")
+	}
+}
+
+func TestCachedProviderExpiry(t *testing.T) {
+	cached, provider, mr := newCachedProvider(t, 10*time.Minute)
+	ctx := context.Background()
+
+	// Links expiring within the margin are not cached
+	if _, err := cached.Link(ctx, "video-1", time.Now().Add(5*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.Link(ctx, "video-1", time.Now().Add(5*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if n := provider.calls.Load(); n != 2 {
+		t.Fatalf("provider called %d times, want 2", n)
+	}
+
+	// Cached links are dropped margin before they expire
+	notAfter := time.Now().Add(time.Hour)
+	first, _ := cached.Link(ctx, "video-1", notAfter)
+	mr.FastForward(51 * time.Minute)
+	if link, _ := cached.Link(ctx, "video-1", notAfter); link.Src == first.Src {
+		t.Fatal("a link within the margin of its expiry was handed out")
+	}
+}
+
+func TestCachedProviderConcurrentMisses(t *testing.T) {
+	cached, provider, _ := newCachedProvider(t, time.Minute)
+	provider.gate = make(chan struct{})
+	notAfter := time.Now().Add(time.Hour)
+
+	var wg sync.WaitGroup
+	srcs := make([]string, 32)
+	for i := range srcs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			link, err := cached.Link(context.Background(), "video-1", notAfter)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			srcs[i] = link.Src
+		}()
+	}
+	// Let the callers pile up on the first miss
+	time.Sleep(50 * time.Millisecond)
+	close(provider.gate)
+	wg.Wait()
+
+	if n := provider.calls.Load(); n != 1 {
+		t.Fatalf("provider called %d times, want 1", n)
+	}
+	for _, src := range srcs {
+		if src != srcs[0] {
+			t.Fatalf("callers got different links: %s and %s", src, srcs[0])
+		}
+	}
+}
+
+func TestCachedProviderWithoutRedis(t *testing.T) {
+	cached, provider, mr := newCachedProvider(t, time.Minute)
+	mr.Close()
+
+	link, err := cached.Link(context.Background(), "video-1", time.Now().Add(time.Hour))
+	if err != nil || link == nil {
+		t.Fatalf("Link = %v, %v; want a link", link, err)
+	}
+	if n := provider.calls.Load(); n != 1 {
+		t.Fatalf("provider called %d times, want 1", n)
+	}
+}
@@ -0,0 +1,117 @@
+package links
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/loop/playbackAccess/contentkey"
+	"github.com/loop/playbackAccess/storj"
+)
+
+// GatewayProvider serves videos through this service instead of handing out
+// prefix-wide Storj links. Links point at the gateway's copy of the video's HLS
+// playlist, read from the bucket through uplink, in which every variant playlist
+// and segment URI is replaced by a gateway URL signed for that single object and
+// the playback session the link was created for.
+//
+// Playlist URLs, the link's included, work for playlistTTL and segment URLs for
+// segmentTTL plus the playback time before the segment, so a leaked URL is useful
+// for minutes. None work after the notAfter of the link; players that pause for
+// longer, or reload the link after playlistTTL, request a new link.
+type GatewayProvider struct {
+	objects     ObjectStore
+	signer      urlSigner
+	playlistTTL time.Duration
+	segmentTTL  time.Duration
+	// keys signs the key URIs of encrypted playlists; it is nil when the key server is disabled
+	keys *contentkey.URISigner
+	now  func() time.Time
+}
+
+// NewGatewayProvider returns a provider serving the objects read with objects, by
+// the provider's Handler at baseURL, and signing URLs with key and key URIs with keys.
+func NewGatewayProvider(objects ObjectStore, key []byte, baseURL string, playlistTTL, segmentTTL time.Duration, keys *contentkey.URISigner) *GatewayProvider {
+	return &GatewayProvider{
+		objects:     objects,
+		signer:      urlSigner{key: key, baseURL: strings.TrimSuffix(baseURL, "/")},
+		playlistTTL: playlistTTL,
+		segmentTTL:  segmentTTL,
+		keys:        keys,
+		now:         time.Now,
+	}
+}
+
+// Name implements LinkProvider.
+func (p *GatewayProvider) Name() string {
+	return ProviderGateway
+}
+
+// Link implements LinkProvider. Every link starts a new playback session.
+func (p *GatewayProvider) Link(_ context.Context, videoId string, notAfter time.Time) (*Link, error) {
+	sid, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	// Signed URLs carry whole seconds
+	notAfter = notAfter.Truncate(time.Second)
+	exp := playlistExpiry(p.now(), notAfter, p.playlistTTL)
+	return &Link{
+		Src:      p.signer.signedURL(videoId, "hls/index.m3u8", sid, exp, notAfter),
+		Type:     HLSType,
+		NotAfter: exp,
+	}, nil
+}
+
+// Close releases the gateway's connections to Storj.
+func (p *GatewayProvider) Close() error {
+	return p.objects.Close()
+}
+
+// Handler serves the gateway below prefix, at <prefix><videoId>/<path>?exp=&end=&sid=&sig=,
+// where path is relative to the video's data directory.
+func (p *GatewayProvider) Handler(prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		videoId, objectPath, sid, end, ok := p.signer.verify(w, r, prefix, p.now())
+		if !ok {
+			return
+		}
+
+		if path.Ext(objectPath) == ".m3u8" {
+			p.servePlaylist(w, r, videoId, objectPath, sid, end)
+			return
+		}
+		ServeObject(w, r, p.objects, videoId+"/data/"+objectPath)
+	})
+}
+
+// servePlaylist serves the playlist at objectPath with its URIs replaced by signed
+// URLs of the same playback session, which ends at notAfter.
+func (p *GatewayProvider) servePlaylist(w http.ResponseWriter, r *http.Request, videoId, objectPath, sid string, notAfter time.Time) {
+	data, err := p.objects.ReadAll(r.Context(), videoId+"/data/"+objectPath, maxPlaylistSize)
+	if err != nil {
+		if errors.Is(err, storj.ErrObjectNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("Error reading playlist: %v", err)
+		http.Error(w, "Failed to read playlist", http.StatusBadGateway)
+		return
+	}
+
+	playlist, err := rewritePlaylist(data, videoId, objectPath, p.now(), notAfter, p.playlistTTL, p.segmentTTL, p.keys, func(target string, exp time.Time) (string, error) {
+		return p.signer.signedURL(videoId, target, sid, exp, notAfter), nil
+	})
+	if err != nil {
+		log.Printf("Error rewriting playlist %s/data/%s: %v", videoId, objectPath, err)
+		http.Error(w, "Invalid playlist", http.StatusBadGateway)
+		return
+	}
+
+	writePlaylist(w, playlist)
+}
@@ -0,0 +1,74 @@
+package links
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// LocalPath is where main mounts the LocalProvider's file handler.
+const LocalPath = "/v1/files/"
+
+// contentTypes are set on HLS files, whose extensions are unknown to many mime.types files.
+var contentTypes = map[string]string{
+	".m3u8": HLSType,
+	".ts":   "video/mp2t",
+	".m4s":  "video/iso.segment",
+	".mp4":  "video/mp4",
+}
+
+// LocalProvider serves videos from a local directory laid out like the bucket
+// (<videoId>/data/hls/index.m3u8). It is meant for development: links are
+// plain URLs and keep working after NotAfter.
+type LocalProvider struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocalProvider returns a provider for the files in dir, served by
+// the provider's Handler at baseURL.
+func NewLocalProvider(dir, baseURL string) *LocalProvider {
+	return &LocalProvider{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// Name implements LinkProvider.
+func (p *LocalProvider) Name() string {
+	return ProviderLocal
+}
+
+// Link implements LinkProvider.
+func (p *LocalProvider) Link(_ context.Context, videoId string, notAfter time.Time) (*Link, error) {
+	return &Link{
+		Src:      p.baseURL + "/" + manifestPath(videoId),
+		Type:     HLSType,
+		NotAfter: notAfter,
+	}, nil
+}
+
+// DownloadLink implements Downloader.
+func (p *LocalProvider) DownloadLink(_ context.Context, key, filename string, notAfter time.Time) (*Link, error) {
+	u := url.URL{Path: "/" + key, RawQuery: url.Values{"download": {filename}}.Encode()}
+	return &Link{Src: p.baseURL + u.String(), Type: objectType(key), NotAfter: notAfter, Filename: filename}, nil
+}
+
+// Handler serves the provider's files below prefix. Directories are not listed.
+// Files requested with a download parameter are sent as attachments of that name.
+func (p *LocalProvider) Handler(prefix string) http.Handler {
+	files := http.StripPrefix(prefix, http.FileServer(http.Dir(p.dir)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		if contentType, ok := contentTypes[path.Ext(r.URL.Path)]; ok {
+			w.Header().Set("Content-Type", contentType)
+		}
+		if filename := r.URL.Query().Get("download"); filename != "" {
+			w.Header().Set("Content-Disposition", attachment(filename))
+		}
+		files.ServeHTTP(w, r)
+	})
+}
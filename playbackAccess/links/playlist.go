@@ -0,0 +1,157 @@
+package links
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loop/playbackAccess/contentkey"
+	"github.com/loop/playbackAccess/hls"
+)
+
+// GatewayPath is where main mounts the handler of providers serving rewritten
+// playlists, the GatewayProvider and the S3Provider.
+const GatewayPath = "/v1/hls/"
+
+// maxPlaylistSize is the size of the largest playlist the gateway rewrites.
+const maxPlaylistSize = 4 << 20
+
+// urlSigner signs and verifies gateway URLs, each for one object in a video's
+// data directory and one playback session.
+type urlSigner struct {
+	// key signs gateway URLs (HMAC-SHA256)
+	key     []byte
+	baseURL string
+}
+
+// newSessionID returns the ID of a new playback session.
+func newSessionID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate playback session ID: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// signedURL returns the gateway URL of the object at objectPath in the video's
+// data directory, signed for the playback session sid until exp. The session
+// ends at end, which is no earlier than exp.
+func (s urlSigner) signedURL(videoId, objectPath, sid string, exp, end time.Time) string {
+	query := url.Values{
+		"exp": {strconv.FormatInt(exp.Unix(), 10)},
+		"end": {strconv.FormatInt(end.Unix(), 10)},
+		"sid": {sid},
+		"sig": {base64.RawURLEncoding.EncodeToString(s.signature(videoId, objectPath, sid, exp.Unix(), end.Unix()))},
+	}
+	u := url.URL{Path: "/" + videoId + "/" + objectPath}
+	return s.baseURL + u.EscapedPath() + "?" + query.Encode()
+}
+
+// signature returns the HMAC of a gateway URL's object, playback session, expiry
+// and session end.
+func (s urlSigner) signature(videoId, objectPath, sid string, exp, end int64) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(strings.Join([]string{"hls", videoId, objectPath, sid, strconv.FormatInt(exp, 10), strconv.FormatInt(end, 10)}, "\n")))
+	return mac.Sum(nil)
+}
+
+// verify checks the signature and expiry of a request below prefix, at
+// <prefix><videoId>/<path>?exp=&end=&sid=&sig=, where path is relative to the
+// video's data directory, and returns when its playback session ends. If the
+// request is not valid, verify responds to it and returns false.
+func (s urlSigner) verify(w http.ResponseWriter, r *http.Request, prefix string, now time.Time) (videoId, objectPath, sid string, end time.Time, ok bool) {
+	rest := strings.TrimPrefix(r.URL.Path, prefix)
+	videoId, objectPath, ok = strings.Cut(rest, "/")
+	if !ok || videoId == "" || objectPath == "" || path.Clean("/"+objectPath) != "/"+objectPath || strings.ContainsAny(rest, "\r\n") {
+		http.NotFound(w, r)
+		return "", "", "", time.Time{}, false
+	}
+
+	query := r.URL.Query()
+	sid = query.Get("sid")
+	unix, errExp := strconv.ParseInt(query.Get("exp"), 10, 64)
+	endUnix, errEnd := strconv.ParseInt(query.Get("end"), 10, 64)
+	sig, errSig := base64.RawURLEncoding.DecodeString(query.Get("sig"))
+	if sid == "" || errExp != nil || errEnd != nil || errSig != nil || !hmac.Equal(sig, s.signature(videoId, objectPath, sid, unix, endUnix)) {
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return "", "", "", time.Time{}, false
+	}
+	if now.Unix() >= unix {
+		http.Error(w, "URL expired", http.StatusForbidden)
+		return "", "", "", time.Time{}, false
+	}
+	return videoId, objectPath, sid, time.Unix(endUnix, 0), true
+}
+
+// rewritePlaylist replaces the URIs of the video's playlist data at objectPath
+// that refer to objects of the video's data directory by sign(target, exp), where
+// target is the object's path in the data directory, and adds key tokens to the
+// URIs of keys. Variant playlists expire playlistTTL from now; segments and keys
+// segmentTTL after they are needed. Nothing outlives the playback session, which
+// ends at notAfter.
+func rewritePlaylist(data []byte, videoId, objectPath string, now, notAfter time.Time, playlistTTL, segmentTTL time.Duration, keys *contentkey.URISigner, sign func(target string, exp time.Time) (string, error)) ([]byte, error) {
+	dir := path.Dir(objectPath)
+	return hls.Rewrite(data, func(uri string, offset time.Duration) (string, error) {
+		// Segments and keys are needed about offset after the playlist was loaded
+		exp := notAfter
+		if segmentExp := now.Add(segmentTTL + offset); segmentExp.Before(exp) {
+			exp = segmentExp
+		}
+
+		target, ok := resolveURI(dir, uri)
+		if !ok {
+			if signed, ok := keys.Sign(videoId, uri, exp); ok {
+				return signed, nil
+			}
+			// URIs of other hosts are left to them
+			return uri, nil
+		}
+		if path.Ext(target) == ".m3u8" {
+			exp = playlistExpiry(now, notAfter, playlistTTL)
+		}
+		return sign(target, exp)
+	})
+}
+
+// playlistExpiry returns when the URL of a playlist signed at now expires: after
+// playlistTTL, so that a leaked playlist URL does not yield freshly signed segment
+// URLs for the rest of the session, but no later than the session's end notAfter.
+// The result is in whole seconds, like signed URLs.
+func playlistExpiry(now, notAfter time.Time, playlistTTL time.Duration) time.Time {
+	exp := now.Add(playlistTTL).Truncate(time.Second)
+	if notAfter.Before(exp) {
+		return notAfter.Truncate(time.Second)
+	}
+	return exp
+}
+
+// writePlaylist sends a rewritten playlist.
+func writePlaylist(w http.ResponseWriter, playlist []byte) {
+	// The playlist's URLs are signed for one playback session
+	w.Header().Set("Content-Type", HLSType)
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(playlist)
+}
+
+// resolveURI resolves a relative playlist URI against dir. It returns false for
+// absolute URIs and for URIs outside the video's data directory.
+func resolveURI(dir, uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+		return "", false
+	}
+	target := path.Join(dir, u.Path)
+	if target == ".." || strings.HasPrefix(target, "../") {
+		return "", false
+	}
+	return target, true
+}
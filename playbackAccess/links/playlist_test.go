@@ -0,0 +1,50 @@
+package links
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loop/playbackAccess/contentkey"
+)
+
+func TestRewritePlaylistKeys(t *testing.T) {
+	keys := contentkey.NewURISigner(make([]byte, contentkey.MasterKeySize), "https://api.test/v1/keys")
+	playlist := "#EXTM3U\n" +
+		"#EXT-X-KEY:METHOD=AES-128,URI=\"https://api.test/v1/keys/42/k1\"\n" +
+		"#EXTINF:6,\n" +
+		"seg0.ts\n" +
+		"#EXT-X-KEY:METHOD=AES-128,URI=\"https://keys.example.com/k2\"\n" +
+		"#EXTINF:6,\n" +
+		"seg1.ts\n"
+	now := time.Now().Truncate(time.Second)
+
+	rewritten, err := rewritePlaylist([]byte(playlist), "video-42", "hls/720p/index.m3u8", now, now.Add(time.Hour), 5*time.Minute, 10*time.Minute, keys, func(target string, _ time.Time) (string, error) {
+		return "signed/" + target, nil
+	})
+	if err != nil {
+		t.Fatalf("rewritePlaylist: %v", err)
+	}
+	lines := strings.Split(string(rewritten), "\n")
+
+	// The key server's URIs carry a token for the video that expires like a segment
+	keyURI := strings.TrimSuffix(strings.TrimPrefix(lines[1], `#EXT-X-KEY:METHOD=AES-128,URI="`), `"`)
+	u, err := url.Parse(keyURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if videoId, err := keys.Verify("42", "k1", u.Query(), now); err != nil || videoId != "video-42" {
+		t.Errorf("key URI %s: Verify = %q, %v", keyURI, videoId, err)
+	}
+	if _, err := keys.Verify("42", "k1", u.Query(), now.Add(10*time.Minute)); err == nil {
+		t.Errorf("key URI %s works after segmentTtl", keyURI)
+	}
+
+	if lines[3] != "signed/hls/720p/seg0.ts" {
+		t.Errorf("segment = %s", lines[3])
+	}
+	if lines[4] != `#EXT-X-KEY:METHOD=AES-128,URI="https://keys.example.com/k2"` {
+		t.Errorf("URI of another key server = %s, want it kept", lines[4])
+	}
+}
@@ -0,0 +1,136 @@
+// Package links creates playable sources for videos. A LinkProvider hands out
+// time-limited links to a video's HLS manifest in one of the supported storage backends;
+// callers decide how long each link may work.
+package links
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"path"
+	"time"
+
+	"github.com/loop/playbackAccess/config"
+	"github.com/loop/playbackAccess/contentkey"
+	"github.com/loop/playbackAccess/storj"
+)
+
+// Provider names, as configured in links.provider.
+const (
+	ProviderStorj   = "storj"
+	ProviderS3      = "s3"
+	ProviderLocal   = "local"
+	ProviderGateway = "gateway"
+)
+
+// HLSType is the MIME type of HLS playlists.
+const HLSType = "application/x-mpegurl"
+
+// Link is a playable source for a video.
+type Link struct {
+	Src  string
+	Type string
+	// NotAfter is when the link stops working
+	NotAfter time.Time
+	// Filename is the name a download link saves its file under, or empty if the
+	// backend names the file after the object
+	Filename string
+}
+
+// LinkProvider returns playable sources for videos.
+type LinkProvider interface {
+	// Name returns the provider name, e.g. ProviderStorj.
+	Name() string
+	// Link returns a link to the HLS manifest of the video with videoId that
+	// stops working at notAfter, or earlier if the backend requires it.
+	Link(ctx context.Context, videoId string, notAfter time.Time) (*Link, error)
+}
+
+// Downloader creates links that download a single object of the bucket as a file.
+type Downloader interface {
+	// DownloadLink returns a link that downloads the object with key as an
+	// attachment named filename, where the backend supports it, and stops
+	// working at notAfter.
+	DownloadLink(ctx context.Context, key, filename string, notAfter time.Time) (*Link, error)
+}
+
+// New returns the LinkProvider selected by cfg.Links.Provider.
+func New(ctx context.Context, cfg *config.Config) (LinkProvider, error) {
+	switch cfg.Links.Provider {
+	case ProviderStorj:
+		return NewStorjProvider(cfg.Storj.AccessGrant, cfg.Storj.Bucket), nil
+	case ProviderS3:
+		s3, gateway := cfg.Links.S3, cfg.Links.Gateway
+		// The key has been validated with the configuration
+		key, _ := gateway.Key()
+		return NewS3Provider(s3.Endpoint, s3.Region, s3.Bucket, s3.AccessKeyID, s3.SecretAccessKey, key, gateway.BaseURL, time.Duration(gateway.PlaylistTTL), time.Duration(gateway.SegmentTTL), KeyURISigner(cfg))
+	case ProviderLocal:
+		return NewLocalProvider(cfg.Links.Local.Dir, cfg.Links.Local.BaseURL), nil
+	case ProviderGateway:
+		gateway := cfg.Links.Gateway
+		// The key has been validated with the configuration
+		key, _ := gateway.Key()
+		objects, err := storj.OpenObjects(ctx, cfg.Storj.AccessGrant, cfg.Storj.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		return NewGatewayProvider(StorjObjects(objects), key, gateway.BaseURL, time.Duration(gateway.PlaylistTTL), time.Duration(gateway.SegmentTTL), KeyURISigner(cfg)), nil
+	default:
+		return nil, fmt.Errorf("unknown link provider %q", cfg.Links.Provider)
+	}
+}
+
+// NewDownloader returns the Downloader for the backend selected by cfg.Links.Provider.
+// The gateway serves playlists and segments only, so with it files are downloaded
+// like with the storj provider: presigned through links.s3, the Storj S3 gateway,
+// when it is set, since only presigned URLs can name the file, and otherwise
+// through Storj's linksharing service.
+func NewDownloader(cfg *config.Config) (Downloader, error) {
+	switch cfg.Links.Provider {
+	case ProviderStorj, ProviderGateway:
+		if cfg.Links.S3.Endpoint == "" {
+			return NewStorjProvider(cfg.Storj.AccessGrant, cfg.Storj.Bucket), nil
+		}
+		fallthrough
+	case ProviderS3:
+		s3 := cfg.Links.S3
+		// Downloads are presigned directly, without playlists
+		return NewS3Provider(s3.Endpoint, s3.Region, s3.Bucket, s3.AccessKeyID, s3.SecretAccessKey, nil, "", 0, 0, nil)
+	case ProviderLocal:
+		return NewLocalProvider(cfg.Links.Local.Dir, cfg.Links.Local.BaseURL), nil
+	default:
+		return nil, fmt.Errorf("unknown link provider %q", cfg.Links.Provider)
+	}
+}
+
+// KeyURISigner returns the signer of the key URIs in encrypted playlists, or nil
+// when the key server is disabled.
+func KeyURISigner(cfg *config.Config) *contentkey.URISigner {
+	if cfg.Keys.MasterKey == "" {
+		return nil
+	}
+	// The key has been validated with the configuration
+	master, _ := cfg.Keys.Master()
+	return contentkey.NewURISigner(master, cfg.Keys.BaseURL)
+}
+
+// attachment returns the Content-Disposition of a download named filename.
+func attachment(filename string) string {
+	if value := mime.FormatMediaType("attachment", map[string]string{"filename": filename}); value != "" {
+		return value
+	}
+	return "attachment"
+}
+
+// objectType returns the MIME type of the object with key.
+func objectType(key string) string {
+	if contentType, ok := contentTypes[path.Ext(key)]; ok {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// manifestPath returns the object key of a video's HLS manifest.
+func manifestPath(videoId string) string {
+	return videoId + "/data/hls/index.m3u8"
+}
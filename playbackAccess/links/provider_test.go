@@ -0,0 +1,32 @@
+package links
+
+import (
+	"testing"
+
+	"github.com/loop/playbackAccess/config"
+)
+
+func TestNewDownloader(t *testing.T) {
+	cfg := config.Default()
+	cfg.Links.Provider = ProviderStorj
+	downloader, err := NewDownloader(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := downloader.(*StorjProvider); !ok {
+		t.Errorf("storj downloader = %T, want linksharing", downloader)
+	}
+
+	// Presigned URLs can name the file, so they are preferred when configured
+	cfg.Links.S3 = config.S3LinksConfig{Endpoint: "https://gateway.storjshare.io", Region: "us-1", Bucket: "videos", AccessKeyID: "AKID", SecretAccessKey: "secret"}
+	for _, provider := range []string{ProviderStorj, ProviderGateway} {
+		cfg.Links.Provider = provider
+		downloader, err := NewDownloader(&cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := downloader.(*S3Provider); !ok {
+			t.Errorf("%s downloader with links.s3 = %T, want presigned URLs", provider, downloader)
+		}
+	}
+}
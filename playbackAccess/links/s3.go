@@ -0,0 +1,300 @@
+package links
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loop/playbackAccess/contentkey"
+)
+
+// maxPresignExpiration is the longest validity SigV4 presigned URLs may have.
+const maxPresignExpiration = 7 * 24 * time.Hour
+
+// playlistFetchExpiration is the validity of the URLs the S3Provider reads
+// playlists with.
+const playlistFetchExpiration = time.Minute
+
+// S3Provider presigns GET URLs (AWS Signature Version 4) for an S3-compatible
+// endpoint such as the Storj S3 gateway or MinIO. URLs are path-style:
+// <endpoint>/<bucket>/<key>.
+//
+// A presigned URL covers a single object, so links point at the provider's copy
+// of the video's HLS playlist, served by its Handler like the GatewayProvider's,
+// in which every variant playlist URI is replaced by a signed URL of the handler
+// and every segment URI by a URL presigned for that segment. Playlist URLs work
+// for playlistTTL and segment URLs for segmentTTL plus the playback time before
+// the segment, and none after the notAfter of the link.
+type S3Provider struct {
+	endpoint        *url.URL
+	region          string
+	bucket          string
+	accessKeyID     string
+	secretAccessKey string
+	signer          urlSigner
+	playlistTTL     time.Duration
+	segmentTTL      time.Duration
+	// keys signs the key URIs of encrypted playlists; it is nil when the key server is disabled
+	keys   *contentkey.URISigner
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewS3Provider returns a provider presigning objects of bucket at endpoint, whose
+// Handler serves playlists at baseURL with URLs signed with key and key URIs
+// signed with keys. Providers that only create download links need none of these.
+func NewS3Provider(endpoint, region, bucket, accessKeyID, secretAccessKey string, key []byte, baseURL string, playlistTTL, segmentTTL time.Duration, keys *contentkey.URISigner) (*S3Provider, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+	}
+
+	return &S3Provider{
+		endpoint:        u,
+		region:          region,
+		bucket:          bucket,
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		signer:          urlSigner{key: key, baseURL: strings.TrimSuffix(baseURL, "/")},
+		playlistTTL:     playlistTTL,
+		segmentTTL:      segmentTTL,
+		keys:            keys,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		now:             time.Now,
+	}, nil
+}
+
+// Name implements LinkProvider.
+func (p *S3Provider) Name() string {
+	return ProviderS3
+}
+
+// Link implements LinkProvider. Every link starts a new playback session.
+func (p *S3Provider) Link(_ context.Context, videoId string, notAfter time.Time) (*Link, error) {
+	sid, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	// Signed URLs carry whole seconds
+	notAfter = notAfter.Truncate(time.Second)
+	exp := playlistExpiry(p.now(), notAfter, p.playlistTTL)
+	return &Link{
+		Src:      p.signer.signedURL(videoId, "hls/index.m3u8", sid, exp, notAfter),
+		Type:     HLSType,
+		NotAfter: exp,
+	}, nil
+}
+
+// Handler serves playlists below prefix, at <prefix><videoId>/<path>?exp=&end=&sid=&sig=,
+// where path is relative to the video's data directory. Segments are read from
+// the endpoint directly.
+func (p *S3Provider) Handler(prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		videoId, objectPath, sid, end, ok := p.signer.verify(w, r, prefix, p.now())
+		if !ok {
+			return
+		}
+		if path.Ext(objectPath) != ".m3u8" {
+			http.NotFound(w, r)
+			return
+		}
+
+		data, err := p.readPlaylist(r.Context(), videoId+"/data/"+objectPath)
+		if err != nil {
+			if errors.Is(err, errPlaylistNotFound) {
+				http.NotFound(w, r)
+				return
+			}
+			log.Printf("Error reading playlist: %v", err)
+			http.Error(w, "Failed to read playlist", http.StatusBadGateway)
+			return
+		}
+
+		playlist, err := rewritePlaylist(data, videoId, objectPath, p.now(), end, p.playlistTTL, p.segmentTTL, p.keys, func(target string, exp time.Time) (string, error) {
+			if path.Ext(target) == ".m3u8" {
+				return p.signer.signedURL(videoId, target, sid, exp, end), nil
+			}
+			link, err := p.link(videoId+"/data/"+target, objectType(target), exp, nil)
+			if err != nil {
+				return "", err
+			}
+			return link.Src, nil
+		})
+		if err != nil {
+			log.Printf("Error rewriting playlist %s/data/%s: %v", videoId, objectPath, err)
+			http.Error(w, "Invalid playlist", http.StatusBadGateway)
+			return
+		}
+
+		writePlaylist(w, playlist)
+	})
+}
+
+// errPlaylistNotFound is returned by readPlaylist for playlists missing from the bucket.
+var errPlaylistNotFound = errors.New("playlist not found")
+
+// readPlaylist reads the playlist with key through a presigned URL.
+func (p *S3Provider) readPlaylist(ctx context.Context, key string) ([]byte, error) {
+	link, err := p.link(key, HLSType, p.now().Add(playlistFetchExpiration), nil)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link.Src, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", errPlaylistNotFound, key)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("failed to read %s: %s", key, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPlaylistSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	if len(data) > maxPlaylistSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", key, maxPlaylistSize)
+	}
+	return data, nil
+}
+
+// DownloadLink implements Downloader. Links work for at most seven days.
+func (p *S3Provider) DownloadLink(_ context.Context, key, filename string, notAfter time.Time) (*Link, error) {
+	// The endpoint sends the response headers named in the signed query
+	link, err := p.link(key, objectType(key), notAfter, map[string]string{
+		"response-content-disposition": attachment(filename),
+	})
+	if err != nil {
+		return nil, err
+	}
+	link.Filename = filename
+	return link, nil
+}
+
+// link presigns the object with key until notAfter, or at most seven days, with
+// the additional query parameters params.
+func (p *S3Provider) link(key, contentType string, notAfter time.Time, params map[string]string) (*Link, error) {
+	now := p.now().UTC()
+	// X-Amz-Expires counts whole seconds from X-Amz-Date
+	expires := min(notAfter.Sub(now), maxPresignExpiration).Truncate(time.Second)
+	if expires < time.Second {
+		return nil, fmt.Errorf("link would expire at %s, before it can be used", notAfter.Format(time.RFC3339))
+	}
+
+	u := *p.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + p.bucket + "/" + key
+
+	return &Link{
+		Src:      p.presign(&u, now, expires, params),
+		Type:     contentType,
+		NotAfter: now.Add(expires),
+	}, nil
+}
+
+// presign returns u with a SigV4 query-string signature for GET requests made
+// before now+expires, carrying the additional query parameters params.
+func (p *S3Provider) presign(u *url.URL, now time.Time, expires time.Duration, params map[string]string) string {
+	amzDate := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + p.region + "/s3/aws4_request"
+
+	query := map[string]string{
+		"X-Amz-Algorithm":     "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":    p.accessKeyID + "/" + scope,
+		"X-Amz-Date":          amzDate,
+		"X-Amz-Expires":       strconv.FormatInt(int64(expires/time.Second), 10),
+		"X-Amz-SignedHeaders": "host",
+	}
+	for name, value := range params {
+		query[name] = value
+	}
+	canonicalQuery := canonicalQueryString(query)
+
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		canonicalURI(u.Path),
+		canonicalQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+p.secretAccessKey), now.Format("20060102"))
+	key = hmacSHA256(key, p.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	return u.Scheme + "://" + u.Host + canonicalURI(u.Path) + "?" + canonicalQuery + "&X-Amz-Signature=" + signature
+}
+
+// canonicalURI encodes each segment of path as SigV4 requires for S3.
+func canonicalURI(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQueryString encodes params sorted by name.
+func canonicalQueryString(params map[string]string) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = uriEncode(name) + "=" + uriEncode(params[name])
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes every byte except the RFC 3986 unreserved characters.
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
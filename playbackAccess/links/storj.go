@@ -0,0 +1,57 @@
+package links
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/loop/playbackAccess/storj"
+)
+
+// StorjProvider shares videos through Storj's linksharing service. Each link is
+// backed by a read-only access grant restricted to the video's data directory,
+// registered with the public Storj auth service.
+type StorjProvider struct {
+	accessGrant string
+	bucket      string
+}
+
+// NewStorjProvider returns a provider sharing objects of bucket with accessGrant.
+func NewStorjProvider(accessGrant, bucket string) *StorjProvider {
+	return &StorjProvider{accessGrant: accessGrant, bucket: bucket}
+}
+
+// Name implements LinkProvider.
+func (p *StorjProvider) Name() string {
+	return ProviderStorj
+}
+
+// Link implements LinkProvider.
+func (p *StorjProvider) Link(ctx context.Context, videoId string, notAfter time.Time) (*Link, error) {
+	// Share the whole data directory so the player can also fetch the segments
+	// the manifest refers to relative to it
+	objectPath := videoId + "/data/"
+
+	baseURL, err := storj.CreateSharedLink(ctx, p.accessGrant, p.bucket, objectPath, notAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	// e.g. https://link.storjshare.io/raw/<key>/<bucket>/<videoId>/data/hls/index.m3u8
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	return &Link{Src: baseURL + "hls/index.m3u8", Type: HLSType, NotAfter: notAfter}, nil
+}
+
+// DownloadLink implements Downloader. Linksharing names the file after the
+// object and cannot be told otherwise, so filename is not used and the link has
+// no Filename; clients that need the name apply it themselves.
+func (p *StorjProvider) DownloadLink(ctx context.Context, key, _ string, notAfter time.Time) (*Link, error) {
+	src, err := storj.CreateSharedLink(ctx, p.accessGrant, p.bucket, key, notAfter)
+	if err != nil {
+		return nil, err
+	}
+	// Linksharing sends the object as an attachment when asked to
+	return &Link{Src: src + "?download=1", Type: objectType(key), NotAfter: notAfter}, nil
+}
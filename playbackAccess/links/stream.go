@@ -0,0 +1,106 @@
+package links
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/loop/playbackAccess/contentkey"
+	"github.com/loop/playbackAccess/hls"
+	"github.com/loop/playbackAccess/storj"
+)
+
+// Object is an object opened for reading, such as a *storj.ObjectReader.
+type Object interface {
+	io.ReadSeekCloser
+	Info() storj.ObjectInfo
+}
+
+// ObjectStore reads the objects of a bucket. Missing objects are reported as
+// storj.ErrObjectNotFound.
+type ObjectStore interface {
+	Open(ctx context.Context, key string) (Object, error)
+	ReadAll(ctx context.Context, key string, limit int64) ([]byte, error)
+	Close() error
+}
+
+// StorjObjects returns the ObjectStore of objects.
+func StorjObjects(objects *storj.Objects) ObjectStore {
+	return storjObjects{objects}
+}
+
+// storjObjects adapts *storj.Objects to ObjectStore.
+type storjObjects struct {
+	*storj.Objects
+}
+
+// Open implements ObjectStore.
+func (o storjObjects) Open(ctx context.Context, key string) (Object, error) {
+	object, err := o.Objects.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// ServeObject streams the object with key from objects. It answers Range and
+// conditional (If-None-Match, If-Range) requests against the object's ETag,
+// which changes whenever the object is uploaded again.
+func ServeObject(w http.ResponseWriter, r *http.Request, objects ObjectStore, key string) {
+	object, err := objects.Open(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, storj.ErrObjectNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("Error opening object: %v", err)
+		http.Error(w, "Failed to read object", http.StatusBadGateway)
+		return
+	}
+	defer object.Close()
+
+	info := object.Info()
+	if contentType, ok := contentTypes[path.Ext(key)]; ok {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.Created.UnixNano(), info.Size))
+	w.Header().Set("Cache-Control", "private")
+
+	// ServeContent handles ranges, conditional requests and HEAD
+	http.ServeContent(w, r, path.Base(key), info.Created, object)
+}
+
+// ServeKeyedPlaylist serves the playlist of the video with videoId at objectPath
+// in its data directory, read from objects, with key tokens that expire at exp
+// added to the URIs of keys. Other URIs are kept as is.
+func ServeKeyedPlaylist(w http.ResponseWriter, r *http.Request, objects ObjectStore, videoId, objectPath string, exp time.Time, keys *contentkey.URISigner) {
+	data, err := objects.ReadAll(r.Context(), videoId+"/data/"+objectPath, maxPlaylistSize)
+	if err != nil {
+		if errors.Is(err, storj.ErrObjectNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("Error reading playlist: %v", err)
+		http.Error(w, "Failed to read playlist", http.StatusBadGateway)
+		return
+	}
+
+	playlist, err := hls.Rewrite(data, func(uri string, _ time.Duration) (string, error) {
+		if signed, ok := keys.Sign(videoId, uri, exp); ok {
+			return signed, nil
+		}
+		return uri, nil
+	})
+	if err != nil {
+		log.Printf("Error rewriting playlist %s/data/%s: %v", videoId, objectPath, err)
+		http.Error(w, "Invalid playlist", http.StatusBadGateway)
+		return
+	}
+
+	writePlaylist(w, playlist)
+}
@@ -5,22 +5,155 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	_ "github.com/joho/godotenv/autoload"
 
 	"github.com/loop/playbackAccess/api"
+	"github.com/loop/playbackAccess/chain"
+	"github.com/loop/playbackAccess/config"
+	"github.com/loop/playbackAccess/db"
+	"github.com/loop/playbackAccess/indexer"
+	"github.com/loop/playbackAccess/links"
+	"github.com/loop/playbackAccess/redis"
+	"github.com/loop/playbackAccess/storj"
 )
 
 func main() {
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML configuration file")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	encryptDir := flag.String("encrypt-hls", "", "encrypt the HLS renditions in this directory with a new content key of -token-id, record the key and exit")
+	tokenId := flag.String("token-id", "", "token ID of the video whose renditions -encrypt-hls encrypts")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	if *printConfig {
+		out, err := cfg.Redacted().YAML()
+		if err != nil {
+			log.Fatalf("Failed to render configuration: %v", err)
+		}
+		fmt.Print(string(out))
+		return
+	}
+
+	if *encryptDir != "" {
+		if cfg.Keys.MasterKey == "" {
+			log.Fatal("Encrypting renditions requires keys.masterKey")
+		}
+		if *tokenId == "" || strings.Trim(*tokenId, "0123456789") != "" {
+			log.Fatalf("Invalid -token-id %q", *tokenId)
+		}
+		dbClient, err := db.NewClient(cfg.Database.URL, db.Config{MaxOpenConns: 1})
+		if err != nil {
+			log.Fatalf("Failed to initialize database client: %v", err)
+		}
+		if err := dbClient.Migrate(context.Background()); err != nil {
+			dbClient.Close()
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+		keyId, err := encryptHLS(context.Background(), cfg, dbClient, *encryptDir, *tokenId)
+		dbClient.Close()
+		if err != nil {
+			log.Fatalf("Failed to encrypt renditions: %v", err)
+		}
+		log.Printf("Encrypted the renditions of video %s with content key %s", *tokenId, keyId)
+		return
+	}
+
+	// Initialize the long-lived clients shared by every request
+	rdb, err := redis.NewClient(cfg.Redis.URL)
+	if err != nil {
+		log.Fatalf("Failed to initialize Redis client: %v", err)
+	}
+
+	dbClient, err := db.NewClient(cfg.Database.URL, db.Config{
+		MaxOpenConns:    cfg.Database.MaxOpenConns,
+		MaxIdleConns:    cfg.Database.MaxIdleConns,
+		ConnMaxLifetime: time.Duration(cfg.Database.ConnMaxLifetime),
+	})
+	if err != nil {
+		rdb.Close()
+		log.Fatalf("Failed to initialize database client: %v", err)
+	}
+	if err := dbClient.Migrate(context.Background()); err != nil {
+		rdb.Close()
+		dbClient.Close()
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	// Connect to the RPC providers of every configured chain
+	chains, err := chain.NewRegistry(cfg.ChainConfigs(), chain.Options{
+		CallTimeout:     time.Duration(cfg.Ethereum.RPCTimeout),
+		FailureCooldown: time.Duration(cfg.Ethereum.FailureCooldown),
+	})
+	if err != nil {
+		rdb.Close()
+		dbClient.Close()
+		log.Fatalf("Failed to initialize chain registry: %v", err)
+	}
+
+	linkProvider, err := links.New(context.Background(), cfg)
+	if err != nil {
+		rdb.Close()
+		dbClient.Close()
+		chains.Close()
+		log.Fatalf("Failed to initialize link provider: %v", err)
+	}
+
+	// Links are shared by every viewer of a video, so create them once per video.
+	// Gateway and S3 links belong to a single playback session and are cheap to create.
+	local, isLocal := linkProvider.(*links.LocalProvider)
+	gateway, isGateway := linkProvider.(*links.GatewayProvider)
+	s3, isS3 := linkProvider.(*links.S3Provider)
+	if !isGateway && !isS3 {
+		linkProvider = links.NewCachedProvider(linkProvider, rdb, time.Duration(cfg.Links.CacheMargin))
+	}
+
+	// The streaming proxy reads videos in proxy mode from the bucket
+	var objects *storj.Objects
+	if cfg.Proxy.SigningKey != "" {
+		if objects, err = storj.OpenObjects(context.Background(), cfg.Storj.AccessGrant, cfg.Storj.Bucket); err != nil {
+			rdb.Close()
+			dbClient.Close()
+			chains.Close()
+			log.Fatalf("Failed to initialize streaming proxy: %v", err)
+		}
+	}
+
+	downloader, err := links.NewDownloader(cfg)
+	if err != nil {
+		rdb.Close()
+		dbClient.Close()
+		chains.Close()
+		log.Fatalf("Failed to initialize download links: %v", err)
+	}
+
+	srv := api.NewServer(cfg, rdb, dbClient, chains, linkProvider, downloader, objects)
+
 	// Set up CORS middleware
 	corsMiddleware := func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Range, Authorization")
+			// Players read these from streamed and proxied media
+			w.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Range, Accept-Ranges, ETag")
 
 			// Handle preflight requests
 			if r.Method == "OPTIONS" {
@@ -33,16 +166,82 @@ func main() {
 	}
 
 	// Set up routes
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", api.Handler)
+	router := api.NewRouter(srv)
+	if isLocal {
+		router.Handle("GET "+links.LocalPath, local.Handler(links.LocalPath))
+	}
+	if isGateway {
+		router.Handle("GET "+links.GatewayPath, gateway.Handler(links.GatewayPath))
+	}
+	if isS3 {
+		router.Handle("GET "+links.GatewayPath, s3.Handler(links.GatewayPath))
+	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	httpServer := &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler: corsMiddleware(router),
 	}
 
-	log.Printf("Server starting on port %s", port)
-	if err := http.ListenAndServe(":"+port, corsMiddleware(mux)); err != nil {
-		log.Fatal(err)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	// Track provider health in the background so failed providers are retried once they recover
+	go chains.Run(ctx, time.Duration(cfg.Ethereum.HealthCheckInterval))
+
+	// Record purchases on the default chain as access grants
+	var background sync.WaitGroup
+	if defaultChain, ok := chains.Chain(cfg.Ethereum.Chain); ok && defaultChain.HasProviders() && cfg.Indexer.Enabled && cfg.PurchaseManager() != "" {
+		purchases := indexer.NewPurchaseIndexer(defaultChain, dbClient, rdb, indexer.Options{
+			ChainId:         defaultChain.ID,
+			Contract:        common.HexToAddress(cfg.PurchaseManager()),
+			DeploymentBlock: cfg.DefaultChain().PurchaseManagerDeploymentBlock,
+			Confirmations:   cfg.Indexer.Confirmations,
+			BatchSize:       cfg.Indexer.BatchSize,
+			PollInterval:    time.Duration(cfg.Indexer.PollInterval),
+			AccessTTL:       time.Duration(cfg.Purchases.CacheTTL),
+		})
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			purchases.Run(ctx)
+		}()
 	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server starting on port %d", cfg.Server.Port)
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			srv.Close()
+			log.Fatal(err)
+		}
+	case <-ctx.Done():
+		log.Println("Shutdown signal received, draining in-flight requests")
+	}
+
+	// Stop accepting new connections and wait for in-flight requests to finish
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout))
+	defer cancel()
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error during server shutdown: %v", err)
+	}
+
+	// Only close the connection pools once no request or indexer can still be using them
+	stop()
+	background.Wait()
+	if err := srv.Close(); err != nil {
+		log.Printf("Error closing clients: %v", err)
+	}
+	if isGateway {
+		if err := gateway.Close(); err != nil {
+			log.Printf("Error closing Storj gateway: %v", err)
+		}
+	}
+
+	log.Println("Server stopped")
 }
@@ -1,6 +1,13 @@
 // Package model provides data models for the playback access API.
 package model
 
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/loop/playbackAccess/acl"
+)
+
 // Video represents a video entity
 type Video struct {
 	Id string `json:"id"`
@@ -38,6 +45,38 @@ type SignedMessage struct {
 type VideoSource struct {
 	Src  string `json:"src"`
 	Type string `json:"type"`
+	// ExpiresAt is when Src stops working, in Unix milliseconds;
+	// players should request a new source before then
+	ExpiresAt int64    `json:"expiresAt"`
+	Session   *Session `json:"session,omitempty"`
+}
+
+// MediaSource is a file of a video in the bucket, as listed in its metadata's sources:
+// the original upload and the HLS manifest.
+type MediaSource struct {
+	// Id is the object key in the bucket
+	Id   string `json:"id"`
+	Src  string `json:"src"`
+	Type string `json:"type"`
+}
+
+// Download is a link that downloads a file of a video.
+type Download struct {
+	Src      string `json:"src"`
+	Type     string `json:"type"`
+	Filename string `json:"filename"`
+	// FilenameSet reports whether Src saves the file as Filename; if not, it is
+	// saved under the object's name and clients apply Filename themselves
+	FilenameSet bool `json:"filenameSet"`
+	// ExpiresAt is when Src stops working, in Unix milliseconds
+	ExpiresAt int64 `json:"expiresAt"`
+}
+
+// Session is a playback session token, sent back as the sig of a "loop.session"
+// authSig to play the same video again without a new signature.
+type Session struct {
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expiresAt"`
 }
 
 // VideoCoverImage represents a video cover image
@@ -56,19 +95,139 @@ type VideoPrice struct {
 
 // VideoAccess represents video access control
 type VideoAccess struct {
-	ACL               interface{} `json:"acl"`
-	Type              string      `json:"type"`
-	Ciphertext        string      `json:"ciphertext,omitempty"`
-	DataToEncryptHash string      `json:"dataToEncryptHash,omitempty"`
+	// Version is the version of the ACL format; records without one are version 1
+	Version           int             `json:"version,omitempty"`
+	ACL               json.RawMessage `json:"acl"`
+	Type              string          `json:"type"`
+	Ciphertext        string          `json:"ciphertext,omitempty"`
+	DataToEncryptHash string          `json:"dataToEncryptHash,omitempty"`
+	// SignerAddress is the address of the Lit-held key that signs lit.action messages
+	SignerAddress string `json:"signerAddress,omitempty"`
+	// Conditions is ACL decoded against the configured chains (see acl.Decode)
+	Conditions acl.Conditions `json:"-"`
+}
+
+// UnmarshalJSON decodes a VideoAccess, rejecting unsupported versions and types.
+// The access control conditions are kept as they are, to be decoded by acl.Decode.
+func (a *VideoAccess) UnmarshalJSON(data []byte) error {
+	// Check the version first; newer versions may not decode as this one
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+	if header.Version < 0 || header.Version > acl.Version {
+		return fmt.Errorf("unsupported playback access version %d", header.Version)
+	}
+
+	type videoAccess VideoAccess
+	var decoded videoAccess
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if decoded.Type != "lit" {
+		return fmt.Errorf("unsupported playback access type %q", decoded.Type)
+	}
+	if len(decoded.ACL) == 0 || string(decoded.ACL) == "null" {
+		return fmt.Errorf("playback access has no acl")
+	}
+
+	*a = VideoAccess(decoded)
+	return nil
 }
 
 // VideoStore represents video metadata stored in Redis
 type VideoStore struct {
-	Id             string       `json:"id"`
-	Visibility     string       `json:"visibility"`
-	IsDownloadable bool         `json:"isDownloadable"`
-	Creator        string       `json:"creator"`
+	Id             string           `json:"id"`
+	Title          string           `json:"title,omitempty"`
+	Visibility     string           `json:"visibility"`
+	IsDownloadable bool             `json:"isDownloadable"`
+	Creator        string           `json:"creator"`
+	Sources        []MediaSource    `json:"sources,omitempty"`
+	Price          *VideoPrice      `json:"price,omitempty"`
+	CoverImage     *VideoCoverImage `json:"coverImage,omitempty"`
+	// PreviewURL is a clip shown on the lock screen of protected videos
+	PreviewUrl     string       `json:"previewUrl,omitempty"`
 	PlaybackAccess *VideoAccess `json:"playbackAccess,omitempty"`
+	// DeliveryMode is DeliveryModeProxy for videos streamed through the proxy; otherwise viewers get links
+	DeliveryMode string `json:"deliveryMode,omitempty"`
+}
+
+// DeliveryModeProxy is the delivery mode of videos streamed through the proxy.
+const DeliveryModeProxy = "proxy"
+
+// VideoMetadata is the public description of a video the embedded player loads
+// before playback (docs/PLAYER_SPEC.md).
+type VideoMetadata struct {
+	Id            string         `json:"id"`
+	TokenId       string         `json:"tokenId"`
+	Title         string         `json:"title"`
+	IsPublic      bool           `json:"isPublic"`
+	PreviewUrl    string         `json:"previewUrl,omitempty"`
+	ThumbnailUrl  string         `json:"thumbnailUrl,omitempty"`
+	UnlockOptions []UnlockOption `json:"unlockOptions"`
+}
+
+// Unlock option types.
+const (
+	UnlockPayment = "payment"
+	UnlockToken   = "token"
+)
+
+// UnlockOption is a way to unlock a protected video: buying it from the
+// PurchaseManager at Contract, or holding a token.
+type UnlockOption struct {
+	Id       string `json:"id"`
+	Type     string `json:"type"`
+	Chain    string `json:"chain"`
+	Contract string `json:"contract,omitempty"`
+	// Price is set for payment options
+	Price *VideoPrice `json:"price,omitempty"`
+	// Token is set for token options
+	Token *TokenRequirement `json:"token,omitempty"`
+}
+
+// TokenRequirement is the balance of a token a viewer must hold: a balance
+// that compares to Amount with Comparator, e.g. ">=" "1".
+type TokenRequirement struct {
+	// Standard is ERC20, ERC721 or ERC1155
+	Standard   string `json:"standard"`
+	TokenId    string `json:"tokenId,omitempty"`
+	Comparator string `json:"comparator"`
+	Amount     string `json:"amount"`
+}
+
+// Reasons a viewer is denied access to a video, which tell the player which
+// lock screen to show (docs/PLAYER_SPEC.md).
+const (
+	// ReasonNotLoggedIn: the viewer sent no credentials, or their sign-in ended
+	ReasonNotLoggedIn = "not_logged_in"
+	// ReasonNotUnlocked: the viewer is signed in but has not unlocked the video
+	ReasonNotUnlocked = "not_unlocked"
+	// ReasonGrantExpired: the viewer's session or signed message has expired
+	ReasonGrantExpired = "grant_expired"
+	// ReasonNonceReused: the viewer's signed message was already used
+	ReasonNonceReused = "nonce_reused"
+	// ReasonSignatureInvalid: the viewer's signature or token is not valid for the video
+	ReasonSignatureInvalid = "signature_invalid"
+	// ReasonVideoNotReady: the video is still being processed
+	ReasonVideoNotReady = "video_not_ready"
+	// ReasonVideoFailed: processing the video failed, so it will never be playable
+	ReasonVideoFailed = "video_failed"
+)
+
+// AccessStatus is the response of the access-status endpoint: a link to play the
+// video with, or why the viewer may not play it.
+type AccessStatus struct {
+	SignedUrl *string `json:"signedUrl"`
+	Access    bool    `json:"access"`
+	Reason    string  `json:"reason,omitempty"`
+	// Code is the error code of the check that failed, for diagnostics
+	Code string `json:"code,omitempty"`
+	// Type and ExpiresAt describe SignedUrl, as in VideoSource
+	Type      string `json:"type,omitempty"`
+	ExpiresAt int64  `json:"expiresAt,omitempty"`
 }
 
 // StandardizedErrorDetail represents the detailed error information.
@@ -87,3 +246,48 @@ type StandardizedErrorResponse struct {
 	Success bool                    `json:"success"` // Always false for errors
 	Error   StandardizedErrorDetail `json:"error"`
 }
+
+// Challenge is a server-issued nonce bound to the signed request it may be used for.
+type Challenge struct {
+	Nonce      string `json:"nonce"`
+	Address    string `json:"address"`
+	TokenId    string `json:"tokenId"`
+	DerivedVia string `json:"derivedVia"`
+	ExpiresAt  int64  `json:"expiresAt"`
+}
+
+// ChallengeRequestBody represents the request body for issuing a challenge
+type ChallengeRequestBody struct {
+	Address    string `json:"address"`
+	TokenId    string `json:"tokenId"`
+	DerivedVia string `json:"derivedVia"`
+}
+
+// AccessGrant is a durable right of Address to play the video with TokenId,
+// recorded from a purchase on the PurchaseManager at Contract.
+type AccessGrant struct {
+	ChainId     int64  `json:"chainId"`
+	Contract    string `json:"contract"`
+	TokenId     string `json:"tokenId"`
+	Address     string `json:"address"` // lowercase hex, as in access keys
+	BlockNumber uint64 `json:"blockNumber"`
+	BlockHash   string `json:"blockHash"`
+	TxHash      string `json:"txHash"`
+	LogIndex    uint   `json:"logIndex"`
+}
+
+// IndexedBlock is a block an indexer has processed, kept while it may still be reorganized.
+type IndexedBlock struct {
+	Number uint64 `json:"number"`
+	Hash   string `json:"hash"`
+}
+
+// IndexerCheckpoint is the progress of an event indexer following a contract.
+type IndexerCheckpoint struct {
+	ChainId  int64  `json:"chainId"`
+	Contract string `json:"contract"`
+	// BlockNumber is the last processed block
+	BlockNumber uint64 `json:"blockNumber"`
+	// RecentBlocks are the processed blocks that are not yet confirmed, newest first
+	RecentBlocks []IndexedBlock `json:"recentBlocks"`
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/loop/playbackAccess/config"
+	"github.com/loop/playbackAccess/contentkey"
+	"github.com/loop/playbackAccess/db"
+	"github.com/loop/playbackAccess/hls"
+)
+
+// encryptedPlaylist is a media playlist being encrypted.
+type encryptedPlaylist struct {
+	path     string
+	playlist []byte
+	segments []hls.Segment
+}
+
+// encryptHLS encrypts the renditions of the video with tokenId in dir, the HLS
+// output of the video's data directory before it is uploaded, under a new content
+// key. The key is wrapped under keys.masterKey and recorded first, so that no
+// rendition is encrypted under a key the key server cannot release. Media playlists
+// and segments are rewritten in place, and every media playlist refers to the key
+// server for the key. It returns the ID of the key.
+func encryptHLS(ctx context.Context, cfg *config.Config, dbClient *db.Client, dir, tokenId string) (string, error) {
+	master, err := cfg.Keys.Master()
+	if err != nil {
+		return "", fmt.Errorf("keys.masterKey: %w", err)
+	}
+
+	key := make([]byte, contentkey.Size)
+	id := make([]byte, 8)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate content key: %w", err)
+	}
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate content key ID: %w", err)
+	}
+	keyId := hex.EncodeToString(id)
+	keyURI := strings.TrimSuffix(cfg.Keys.BaseURL, "/") + "/" + tokenId + "/" + keyId
+
+	// Read every playlist before anything is changed
+	var playlists []encryptedPlaylist
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".m3u8" {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		playlist, segments, err := hls.EncryptPlaylist(data, keyURI)
+		if errors.Is(err, hls.ErrMasterPlaylist) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		playlists = append(playlists, encryptedPlaylist{path: path, playlist: playlist, segments: segments})
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(playlists) == 0 {
+		return "", fmt.Errorf("no media playlists in %s", dir)
+	}
+
+	// Segments listed by several playlists are encrypted once
+	sequences := make(map[string]uint64)
+	for _, p := range playlists {
+		for _, segment := range p.segments {
+			segmentPath, err := segmentFile(dir, filepath.Dir(p.path), segment.URI)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", p.path, err)
+			}
+			if sequence, ok := sequences[segmentPath]; ok && sequence != segment.Sequence {
+				return "", fmt.Errorf("%s is listed with media sequence numbers %d and %d", segmentPath, sequence, segment.Sequence)
+			}
+			sequences[segmentPath] = segment.Sequence
+		}
+	}
+
+	wrapped, err := contentkey.Wrap(master, tokenId, keyId, key)
+	if err != nil {
+		return "", err
+	}
+	if _, err := dbClient.PutContentKey(ctx, tokenId, keyId, wrapped); err != nil {
+		return "", err
+	}
+
+	for segmentPath, sequence := range sequences {
+		data, err := os.ReadFile(segmentPath)
+		if err != nil {
+			return "", err
+		}
+		encrypted, err := hls.EncryptSegment(data, key, sequence)
+		if err != nil {
+			return "", err
+		}
+		if err := replaceFile(segmentPath, encrypted); err != nil {
+			return "", err
+		}
+	}
+	for _, p := range playlists {
+		if err := replaceFile(p.path, p.playlist); err != nil {
+			return "", err
+		}
+	}
+	return keyId, nil
+}
+
+// segmentFile returns the file of a segment URI of a playlist in playlistDir. The
+// file must be in dir.
+func segmentFile(dir, playlistDir, uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+		return "", fmt.Errorf("segment %q is not a relative URI", uri)
+	}
+	path := filepath.Join(playlistDir, filepath.FromSlash(u.Path))
+	if rel, err := filepath.Rel(dir, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("segment %q is outside %s", uri, dir)
+	}
+	return path, nil
+}
+
+// replaceFile replaces the contents of the file at path with data, so that the
+// file is never left half written.
+func replaceFile(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,111 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/loop/playbackAccess/model"
+	"github.com/redis/go-redis/v9"
+)
+
+// challengeKey returns the Redis key holding the challenge for nonce.
+func challengeKey(nonce string) string {
+	return fmt.Sprintf("challenge:%s", nonce)
+}
+
+// SetChallenge stores a challenge until its expiry.
+func (c *Client) SetChallenge(ctx context.Context, challenge *model.Challenge) error {
+	data, err := json.Marshal(challenge)
+	if err != nil {
+		return fmt.Errorf("failed to marshal challenge: %w", err)
+	}
+
+	ttl := time.Until(time.UnixMilli(challenge.ExpiresAt))
+	if ttl <= 0 {
+		return fmt.Errorf("challenge already expired")
+	}
+
+	return c.Set(ctx, challengeKey(challenge.Nonce), data, ttl).Err()
+}
+
+// ErrChallengeRedeemed is returned by GetChallenge and RedeemChallenge for a challenge that was
+// already redeemed and would not yet have expired.
+var ErrChallengeRedeemed = errors.New("challenge already redeemed")
+
+// redeemedChallengeKey returns the Redis key recording that the challenge for nonce
+// was redeemed, kept until the challenge would have expired.
+func redeemedChallengeKey(nonce string) string {
+	return fmt.Sprintf("challenge:redeemed:%s", nonce)
+}
+
+// redeemChallengeScript deletes the challenge at KEYS[1] and returns it, recording
+// the redemption at KEYS[2] for the rest of the challenge's lifetime. It returns 0 if
+// the challenge was already redeemed, and nil if it was never issued or has expired.
+var redeemChallengeScript = redis.NewScript(`
+local data = redis.call("GET", KEYS[1])
+if not data then
+	return redis.call("EXISTS", KEYS[2])
+end
+local ttl = redis.call("PTTL", KEYS[1])
+redis.call("DEL", KEYS[1])
+if ttl > 0 then
+	redis.call("SET", KEYS[2], "1", "PX", ttl)
+end
+return data
+`)
+
+// GetChallenge returns the challenge for nonce without redeeming it.
+// It returns ErrChallengeRedeemed if the challenge was already redeemed, and
+// redis.Nil if no unexpired challenge was issued for nonce.
+func (c *Client) GetChallenge(ctx context.Context, nonce string) (*model.Challenge, error) {
+	data, err := c.Get(ctx, challengeKey(nonce)).Bytes()
+	if err == redis.Nil {
+		redeemed, err := c.Exists(ctx, redeemedChallengeKey(nonce)).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up challenge: %w", err)
+		}
+		if redeemed > 0 {
+			return nil, ErrChallengeRedeemed
+		}
+		return nil, redis.Nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to look up challenge: %w", err)
+	}
+
+	var challenge model.Challenge
+	if err := json.Unmarshal(data, &challenge); err != nil {
+		return nil, fmt.Errorf("failed to parse challenge: %w", err)
+	}
+	return &challenge, nil
+}
+
+// RedeemChallenge atomically fetches and deletes the challenge for nonce,
+// so each challenge can be redeemed at most once.
+// It returns ErrChallengeRedeemed if the challenge was already redeemed, and
+// redis.Nil if no unexpired challenge was issued for nonce.
+func (c *Client) RedeemChallenge(ctx context.Context, nonce string) (*model.Challenge, error) {
+	result, err := redeemChallengeScript.Run(ctx, c, []string{challengeKey(nonce), redeemedChallengeKey(nonce)}).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to redeem challenge: %w", err)
+	}
+
+	data, ok := result.(string)
+	if !ok {
+		if redeemed, _ := result.(int64); redeemed == 1 {
+			return nil, ErrChallengeRedeemed
+		}
+		return nil, redis.Nil
+	}
+
+	var challenge model.Challenge
+	if err := json.Unmarshal([]byte(data), &challenge); err != nil {
+		return nil, fmt.Errorf("failed to parse challenge: %w", err)
+	}
+	return &challenge, nil
+}
@@ -0,0 +1,65 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/loop/playbackAccess/model"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedeemChallenge(t *testing.T) {
+	client, mr := newTestClient(t)
+	ctx := context.Background()
+
+	challenge := &model.Challenge{
+		Nonce:      "n1",
+		Address:    "0xabc",
+		TokenId:    "42",
+		DerivedVia: "siwe",
+		ExpiresAt:  time.Now().Add(time.Minute).UnixMilli(),
+	}
+	if err := client.SetChallenge(ctx, challenge); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := client.GetChallenge(ctx, "n1"); err != nil || *got != *challenge {
+		t.Fatalf("GetChallenge = %+v, %v; want %+v", got, err, challenge)
+	}
+
+	got, err := client.RedeemChallenge(ctx, "n1")
+	if err != nil {
+		t.Fatalf("RedeemChallenge: %v", err)
+	}
+	if *got != *challenge {
+		t.Errorf("RedeemChallenge = %+v, want %+v", got, challenge)
+	}
+
+	if _, err := client.RedeemChallenge(ctx, "n1"); !errors.Is(err, ErrChallengeRedeemed) {
+		t.Errorf("second RedeemChallenge = %v, want ErrChallengeRedeemed", err)
+	}
+	if _, err := client.GetChallenge(ctx, "n1"); !errors.Is(err, ErrChallengeRedeemed) {
+		t.Errorf("GetChallenge of a redeemed challenge = %v, want ErrChallengeRedeemed", err)
+	}
+	if _, err := client.RedeemChallenge(ctx, "n2"); err != redis.Nil {
+		t.Errorf("RedeemChallenge of a nonce never issued = %v, want redis.Nil", err)
+	}
+
+	// The redemption is forgotten once the challenge would have expired
+	mr.FastForward(time.Minute)
+	if _, err := client.RedeemChallenge(ctx, "n1"); err != redis.Nil {
+		t.Errorf("RedeemChallenge after expiry = %v, want redis.Nil", err)
+	}
+
+	// Expired challenges cannot be redeemed
+	challenge.Nonce = "n3"
+	if err := client.SetChallenge(ctx, challenge); err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(time.Minute)
+	if _, err := client.RedeemChallenge(ctx, "n3"); err != redis.Nil {
+		t.Errorf("RedeemChallenge of an expired challenge = %v, want redis.Nil", err)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"os"
 	"time"
 
 	"github.com/loop/playbackAccess/model"
@@ -19,12 +18,10 @@ type Client struct {
 	ctx context.Context
 }
 
-// NewClient initializes and returns a Redis client.
-// It reads the Redis URL from the REDIS_URL environment variable.
-func NewClient() (*Client, error) {
-	url := os.Getenv("REDIS_URL")
+// NewClient initializes and returns a Redis client for the given Redis URL.
+func NewClient(url string) (*Client, error) {
 	if url == "" {
-		return nil, fmt.Errorf("REDIS_URL environment variable is not set")
+		return nil, fmt.Errorf("Redis URL is not set")
 	}
 
 	opts, err := redis.ParseURL(url)
@@ -63,9 +60,10 @@ func (c *Client) SetVideoMetadata(tokenKey string, videoStore *model.VideoStore)
 	return c.Set(c.ctx, tokenKey, data, 0).Err()
 }
 
-// SetNonce sets a nonce in Redis with expiration.
-func (c *Client) SetNonce(nonceKey string, exp int64) error {
-	return c.Set(c.ctx, nonceKey, exp, time.Until(time.UnixMilli(exp))).Err()
+// AccessKey returns the Redis key of the access record of address for the video with tokenId.
+// Addresses are lowercase.
+func AccessKey(tokenId, address string) string {
+	return fmt.Sprintf("access:%s:%s", tokenId, address)
 }
 
 // SetAccess sets an access record in Redis with expiration.
@@ -77,3 +75,28 @@ func (c *Client) SetAccess(accessKey string, exp int64) error {
 func (c *Client) GetAccess(accessKey string) (string, error) {
 	return c.Get(c.ctx, accessKey).Result()
 }
+
+// DeleteAccess removes an access record from Redis.
+func (c *Client) DeleteAccess(accessKey string) error {
+	return c.Del(c.ctx, accessKey).Err()
+}
+
+// SharedLinkKey returns the Redis key of the cached link to the video with videoId
+// created by the named link provider.
+func SharedLinkKey(provider, videoId string) string {
+	return fmt.Sprintf("link:%s:%s", provider, videoId)
+}
+
+// AccessExpiry returns when an access record expires, or the zero time if it
+// does not expire or does not exist.
+func (c *Client) AccessExpiry(accessKey string) (time.Time, error) {
+	ttl, err := c.PTTL(c.ctx, accessKey).Result()
+	if err != nil {
+		return time.Time{}, err
+	}
+	// Negative TTLs mean that the key has no expiry or is missing
+	if ttl < 0 {
+		return time.Time{}, nil
+	}
+	return time.Now().Add(ttl), nil
+}
@@ -0,0 +1,33 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// rateLimitKey returns the Redis key counting the requests of key in the window starting at start.
+func rateLimitKey(key string, start time.Time) string {
+	return fmt.Sprintf("ratelimit:%s:%d", key, start.Unix())
+}
+
+// Allow counts a request of key against a limit of limit requests per fixed window,
+// shared by every instance of the service. It reports whether the request is
+// within the limit and, if it is not, how long until the next window starts.
+func (c *Client) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	now := time.Now()
+	start := now.Truncate(window)
+	counter := rateLimitKey(key, start)
+
+	pipe := c.TxPipeline()
+	count := pipe.Incr(ctx, counter)
+	pipe.Expire(ctx, counter, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, 0, fmt.Errorf("failed to count request of %s: %w", key, err)
+	}
+
+	if count.Val() > int64(limit) {
+		return false, start.Add(window).Sub(now), nil
+	}
+	return true, 0, nil
+}
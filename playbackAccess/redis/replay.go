@@ -0,0 +1,108 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// minReplayTTL is the shortest time a consumed key is remembered, so that a
+// value that is about to expire cannot be replayed within the same instant.
+const minReplayTTL = time.Second
+
+// ReplayGuard records single-use values such as signed-message nonces.
+type ReplayGuard interface {
+	// Consume atomically marks key as used until expiresAt.
+	// It returns true if this call consumed the key and false if the key
+	// had already been consumed. Of any number of concurrent calls for the
+	// same key, exactly one returns true.
+	Consume(ctx context.Context, key string, expiresAt time.Time) (bool, error)
+	// Used reports whether key has been consumed and is still remembered,
+	// without consuming it.
+	Used(ctx context.Context, key string) (bool, error)
+}
+
+// redisReplayGuard implements ReplayGuard with a single SET NX per key,
+// which is atomic across every instance of the service.
+type redisReplayGuard struct {
+	client *Client
+}
+
+// NewReplayGuard returns a ReplayGuard backed by Redis.
+func NewReplayGuard(client *Client) ReplayGuard {
+	return &redisReplayGuard{client: client}
+}
+
+// Consume implements ReplayGuard.
+func (g *redisReplayGuard) Consume(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	ttl := time.Until(expiresAt)
+	if ttl < minReplayTTL {
+		ttl = minReplayTTL
+	}
+
+	ok, err := g.client.SetNX(ctx, key, expiresAt.UnixMilli(), ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to consume %s: %w", key, err)
+	}
+	return ok, nil
+}
+
+// Used implements ReplayGuard.
+func (g *redisReplayGuard) Used(ctx context.Context, key string) (bool, error) {
+	n, err := g.client.Exists(ctx, key).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to look up %s: %w", key, err)
+	}
+	return n > 0, nil
+}
+
+// MemoryReplayGuard implements ReplayGuard in process memory.
+// It is intended for tests and single-instance development setups.
+type MemoryReplayGuard struct {
+	mu   sync.Mutex
+	used map[string]time.Time
+	now  func() time.Time
+}
+
+// NewMemoryReplayGuard returns an empty in-memory ReplayGuard.
+func NewMemoryReplayGuard() *MemoryReplayGuard {
+	return &MemoryReplayGuard{
+		used: make(map[string]time.Time),
+		now:  time.Now,
+	}
+}
+
+// Consume implements ReplayGuard.
+func (g *MemoryReplayGuard) Consume(_ context.Context, key string, expiresAt time.Time) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	if exp, ok := g.used[key]; ok && now.Before(exp) {
+		return false, nil
+	}
+
+	if minExp := now.Add(minReplayTTL); expiresAt.Before(minExp) {
+		expiresAt = minExp
+	}
+	g.used[key] = expiresAt
+
+	// Drop expired entries so the map does not grow without bound
+	for k, exp := range g.used {
+		if !now.Before(exp) {
+			delete(g.used, k)
+		}
+	}
+
+	return true, nil
+}
+
+// Used implements ReplayGuard.
+func (g *MemoryReplayGuard) Used(_ context.Context, key string) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	exp, ok := g.used[key]
+	return ok && g.now().Before(exp), nil
+}
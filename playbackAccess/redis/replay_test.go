@@ -0,0 +1,119 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// racers is the number of goroutines that race to consume the same key.
+const racers = 64
+
+func newTestClient(t *testing.T) (*Client, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client, err := NewClient("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, mr
+}
+
+// raceConsume consumes key from racers goroutines at once and returns how many succeeded.
+func raceConsume(t *testing.T, guard ReplayGuard, key string, expiresAt time.Time) int {
+	t.Helper()
+
+	var wins atomic.Int32
+	var start, done sync.WaitGroup
+	start.Add(1)
+	for i := 0; i < racers; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			start.Wait()
+			ok, err := guard.Consume(context.Background(), key, expiresAt)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if ok {
+				wins.Add(1)
+			}
+		}()
+	}
+	start.Done()
+	done.Wait()
+	return int(wins.Load())
+}
+
+func TestReplayGuardConcurrentConsume(t *testing.T) {
+	client, _ := newTestClient(t)
+	guards := map[string]ReplayGuard{
+		"memory": NewMemoryReplayGuard(),
+		"redis":  NewReplayGuard(client),
+	}
+
+	for name, guard := range guards {
+		t.Run(name, func(t *testing.T) {
+			expiresAt := time.Now().Add(time.Minute)
+			for _, key := range []string{"nonce:a", "nonce:b"} {
+				if wins := raceConsume(t, guard, key, expiresAt); wins != 1 {
+					t.Fatalf("%d of %d concurrent consumers of %s won, want 1", wins, racers, key)
+				}
+			}
+			if ok, err := guard.Consume(context.Background(), "nonce:a", expiresAt); err != nil || ok {
+				t.Fatalf("Consume of a used key = %v, %v; want false, nil", ok, err)
+			}
+			if used, err := guard.Used(context.Background(), "nonce:a"); err != nil || !used {
+				t.Fatalf("Used of a used key = %v, %v; want true, nil", used, err)
+			}
+			if used, err := guard.Used(context.Background(), "nonce:c"); err != nil || used {
+				t.Fatalf("Used of an unused key = %v, %v; want false, nil", used, err)
+			}
+		})
+	}
+}
+
+func TestMemoryReplayGuardExpiry(t *testing.T) {
+	guard := NewMemoryReplayGuard()
+	now := time.Now()
+	guard.now = func() time.Time { return now }
+
+	if ok, _ := guard.Consume(context.Background(), "nonce", now.Add(time.Minute)); !ok {
+		t.Fatal("first Consume = false, want true")
+	}
+	now = now.Add(30 * time.Second)
+	if ok, _ := guard.Consume(context.Background(), "nonce", now.Add(time.Minute)); ok {
+		t.Fatal("Consume before expiry = true, want false")
+	}
+	now = now.Add(time.Minute)
+	if ok, _ := guard.Consume(context.Background(), "nonce", now.Add(time.Minute)); !ok {
+		t.Fatal("Consume after expiry = false, want true")
+	}
+
+	// Keys that expire at once are still remembered for minReplayTTL
+	if ok, _ := guard.Consume(context.Background(), "expired", now.Add(-time.Minute)); !ok {
+		t.Fatal("first Consume of an expired key = false, want true")
+	}
+	if ok, _ := guard.Consume(context.Background(), "expired", now.Add(-time.Minute)); ok {
+		t.Fatal("second Consume of an expired key = true, want false")
+	}
+}
+
+func TestRedisReplayGuardExpiry(t *testing.T) {
+	client, mr := newTestClient(t)
+	guard := NewReplayGuard(client)
+
+	if ok, _ := guard.Consume(context.Background(), "nonce", time.Now().Add(time.Minute)); !ok {
+		t.Fatal("first Consume = false, want true")
+	}
+	mr.FastForward(2 * time.Minute)
+	if ok, _ := guard.Consume(context.Background(), "nonce", time.Now().Add(time.Minute)); !ok {
+		t.Fatal("Consume after expiry = false, want true")
+	}
+}
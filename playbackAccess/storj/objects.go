@@ -0,0 +1,152 @@
+package storj
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"storj.io/uplink"
+)
+
+// ErrObjectNotFound is returned when an object does not exist.
+var ErrObjectNotFound = uplink.ErrObjectNotFound
+
+// Objects reads the objects of one bucket through uplink, without a round-trip
+// through the linksharing service. It is safe for concurrent use.
+type Objects struct {
+	project *uplink.Project
+	bucket  string
+}
+
+// OpenObjects opens the bucket with accessGrant. Connections are made when objects are read.
+// Call Close to release them.
+func OpenObjects(ctx context.Context, accessGrant, bucketName string) (*Objects, error) {
+	access, err := uplink.ParseAccess(accessGrant)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse access grant: %w", err)
+	}
+
+	project, err := uplink.OpenProject(ctx, access)
+	if err != nil {
+		return nil, fmt.Errorf("could not open project: %w", err)
+	}
+
+	return &Objects{project: project, bucket: bucketName}, nil
+}
+
+// ReadAll returns the content of the object with key, which must not exceed limit bytes.
+func (o *Objects) ReadAll(ctx context.Context, key string, limit int64) ([]byte, error) {
+	download, err := o.project.DownloadObject(ctx, o.bucket, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not download %s: %w", key, err)
+	}
+	defer download.Close()
+
+	if size := download.Info().System.ContentLength; size > limit {
+		return nil, fmt.Errorf("object %s has %d bytes, more than %d", key, size, limit)
+	}
+	data, err := io.ReadAll(io.LimitReader(download, limit))
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// ObjectInfo describes an object.
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	Created time.Time
+}
+
+// Open returns a reader of the object with key. The object is downloaded from
+// the current offset on the first Read after opening or seeking, so seeking is
+// cheap. The caller must close the reader.
+func (o *Objects) Open(ctx context.Context, key string) (*ObjectReader, error) {
+	object, err := o.project.StatObject(ctx, o.bucket, key)
+	if err != nil {
+		return nil, fmt.Errorf("could not stat %s: %w", key, err)
+	}
+
+	return &ObjectReader{
+		ctx:     ctx,
+		objects: o,
+		info: ObjectInfo{
+			Key:     object.Key,
+			Size:    object.System.ContentLength,
+			Created: object.System.Created,
+		},
+	}, nil
+}
+
+// ObjectReader reads an object. It implements io.ReadSeekCloser.
+type ObjectReader struct {
+	ctx      context.Context
+	objects  *Objects
+	info     ObjectInfo
+	offset   int64
+	download *uplink.Download
+}
+
+// Info returns the object's description.
+func (r *ObjectReader) Info() ObjectInfo {
+	return r.info
+}
+
+// Read implements io.Reader.
+func (r *ObjectReader) Read(p []byte) (int, error) {
+	if r.offset >= r.info.Size {
+		return 0, io.EOF
+	}
+	if r.download == nil {
+		download, err := r.objects.project.DownloadObject(r.ctx, r.objects.bucket, r.info.Key, &uplink.DownloadOptions{Offset: r.offset, Length: -1})
+		if err != nil {
+			return 0, fmt.Errorf("could not download %s: %w", r.info.Key, err)
+		}
+		r.download = download
+	}
+
+	n, err := r.download.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.info.Size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset %d", offset)
+	}
+
+	if offset != r.offset && r.download != nil {
+		// The next Read downloads from the new offset
+		r.download.Close()
+		r.download = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// Close implements io.Closer.
+func (r *ObjectReader) Close() error {
+	if r.download == nil {
+		return nil
+	}
+	err := r.download.Close()
+	r.download = nil
+	return err
+}
+
+// Close releases the connections to the satellite and storage nodes.
+func (o *Objects) Close() error {
+	return o.project.Close()
+}
@@ -5,7 +5,6 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
 	"strings"
 	"time"
 
@@ -28,6 +27,11 @@ const defaultExpiration = 4 * time.Hour
 //   - string: the public URL for the video
 //   - error: any error that occurred during the process
 func CreatePublicSharedLink(ctx context.Context, accessGrant, bucketName, objectKey string) (string, error) {
+	return CreateSharedLink(ctx, accessGrant, bucketName, objectKey, time.Now().Add(defaultExpiration))
+}
+
+// CreateSharedLink is like CreatePublicSharedLink, but the link stops working at notAfter.
+func CreateSharedLink(ctx context.Context, accessGrant, bucketName, objectKey string, notAfter time.Time) (string, error) {
 	log.Printf("Creating public shared link for bucket: %s, object: %s", bucketName, objectKey)
 
 	// Define configuration for the storj sharing site
@@ -45,7 +49,7 @@ func CreatePublicSharedLink(ctx context.Context, accessGrant, bucketName, object
 	restrictedAccess, err := access.Share(
 		uplink.Permission{
 			AllowDownload: true,
-			NotAfter:      time.Now().Add(defaultExpiration),
+			NotAfter:      notAfter,
 		},
 		uplink.SharePrefix{
 			Bucket: bucketName,
@@ -69,12 +73,6 @@ func CreatePublicSharedLink(ctx context.Context, accessGrant, bucketName, object
 
 	// Convert to raw URL
 	rawUrl := strings.Replace(url, "/s/", "/raw/", 1)
-	log.Printf("Public shared link created: %s", rawUrl)
 
 	return rawUrl, nil
 }
-
-// GetStorjConfig retrieves Storj configuration from environment variables.
-func GetStorjConfig() (accessGrant, bucket string) {
-	return os.Getenv("LINK_SHARE_ACCESS_GRANT"), os.Getenv("S3_VIDEO_BUCKET")
-}
@@ -10,6 +10,12 @@ export const LIT_ACTION_IPFS_CID = IS_PRODUCTION
 
 export const ACC_TOKEN_PLACEHOLDER = "TOKEN_PLACEHOLDER";
 
+/**
+ * Version of the playbackAccess ACL format. The playback service rejects
+ * versions it does not understand.
+ */
+export const ACL_VERSION = 1;
+
 export const LIT_CLIENT_OPTIONS = {
   alertWhenUnauthorized: false,
   litNetwork: LIT_NETWORK.DatilTest,
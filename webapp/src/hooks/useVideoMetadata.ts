@@ -4,7 +4,7 @@ import { useAccessControl } from "@/contexts/AccessControlContext";
 import { VideoMetadata, VideoMetadataSchema } from "@/validations/videoSchemas";
 import { v7 as uuidv7 } from "uuid";
 import { convertToLitFormat } from "@/features/accessControl/utils/litConversion";
-import { ACC_TOKEN_PLACEHOLDER } from "@/config/litConfig";
+import { ACC_TOKEN_PLACEHOLDER, ACL_VERSION } from "@/config/litConfig";
 import { VideoCoverImage } from "@/types";
 
 interface UseVideoMetadataReturn {
@@ -88,6 +88,7 @@ export function useVideoMetadata(): UseVideoMetadataReturn {
     // }
 
     return {
+      version: ACL_VERSION,
       acl: litConditions as unknown as Record<string, unknown>[],
       type: "lit" as const,
     };
@@ -5,7 +5,7 @@ import {
 } from "@/services/server/database/videoService";
 import { ContractService } from "@/services/server/contracts/contractService";
 import { LitService } from "@/services/server/encryption/litService.server";
-import { ACC_TOKEN_PLACEHOLDER } from "@/config/litConfig";
+import { ACC_TOKEN_PLACEHOLDER, ACL_VERSION } from "@/config/litConfig";
 import { Wallet } from "ethers";
 import { VideoMetadata } from "@/types";
 import { updateCID } from "./updateCID";
@@ -51,7 +51,13 @@ export const mintNFT = task({
             videoId: payload.videoId,
           }
         );
-        newMetadata.playbackAccess = encryptedAccess;
+        // Record the signer so the playback service can verify that
+        // lit.action messages were signed by this video's key
+        newMetadata.playbackAccess = {
+          version: ACL_VERSION,
+          ...encryptedAccess,
+          signerAddress: wallet.address,
+        };
 
         await litService.disconnect();
       }
@@ -42,10 +42,14 @@ export interface VideoPrice {
  * Represents video access control.
  */
 export interface VideoAccess {
+  /** Version of the ACL format; absent means version 1. */
+  version?: number;
   acl: UnifiedAccessControlConditions;
   type: "lit";
   ciphertext?: string;
   dataToEncryptHash?: string;
+  /** Address of the Lit-held key that signs lit.action playback messages. */
+  signerAddress?: string;
 }
 
 /**
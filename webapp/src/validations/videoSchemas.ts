@@ -31,10 +31,12 @@ const VideoPriceSchema = z.object({
  * Schema for validating video access control.
  */
 const VideoAccessSchema = z.object({
+  version: z.number().int().positive().optional(),
   acl: z.array(z.unknown()),
   type: z.literal("lit"),
   ciphertext: z.string().optional(),
   dataToEncryptHash: z.string().optional(),
+  signerAddress: z.string().optional(),
 });
 
 const VideoCoverImageSchema = z.object({